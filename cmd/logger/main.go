@@ -1,22 +1,101 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
 
+	"github.com/kxrty/loggerv2/internal/deadletter"
+	"github.com/kxrty/loggerv2/internal/evtx"
+	"github.com/kxrty/loggerv2/internal/framing"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/parser"
 	"github.com/kxrty/loggerv2/internal/processor"
+	"github.com/kxrty/loggerv2/internal/rules"
 )
 
 func main() {
 	inputFile := flag.String("input", "", "Входной файл с логами")
 	outputFile := flag.String("output", "", "Выходной файл для результатов (по умолчанию stdout)")
+	outputFormat := flag.String("output-format", "pretty", "Формат вывода: "+strings.Join(processor.EncoderFormats, ", ")+" (-format задает формат входных данных)")
+	rulesFile := flag.String("rules", "", "Файл правил классификации событий (только JSON). Без \"include_defaults\": true заменяет все встроенные правила")
+	jsonProfiles := flag.String("json-profiles", "", "Файл профилей сопоставления полей JSON логов")
+	kvProfiles := flag.String("kv-profiles", "", "Файл профилей сопоставления полей логов ключ=значение")
+	kvPairSeparator := flag.String("kv-pair-separator", "", "Разделитель пар ключ=значение (по умолчанию пробелы)")
+	kvValueSeparator := flag.String("kv-value-separator", "=", "Разделитель ключа и значения")
+	grokPatterns := flag.String("grok-patterns", "", "Файл дополнительных шаблонов grok (ИМЯ выражение)")
+	grokProfiles := flag.String("grok-profiles", "", "Файл профилей парсера grok (JSON)")
+	parserName := flag.String("parser", "", "Разбирать все строки указанным парсером (syslog, cef, leef, json, kv, grok, ...) вместо автоопределения")
+	origin := flag.Bool("origin", false, "Добавлять в события origin: исходную строку, тип лога, время приема, входной файл и версию парсера")
+	omitRaw := flag.Bool("omit-raw", false, "Не выводить исходную строку (origin.raw)")
+	lenient := flag.Bool("lenient", false, "Не отбрасывать неразобранные строки: выдавать их событием СИСТЕМНОЕ_СОБЫТИЕ с parse_status и parse_error")
+	stableIDs := flag.Bool("stable-ids", false, "Вычислять event_id по содержимому события (одинаковые строки - одинаковый id)")
+	dedupWindow := flag.Duration("dedup-window", 0, "Окно дедупликации одинаковых событий (0 - отключена)")
+	dedupMode := flag.String("dedup-mode", "drop", "Обработка повторов: drop (отбрасывать) или count (выдавать с dedup_count)")
+	dedupMax := flag.Int("dedup-max-entries", processor.DefaultDedupMaxEntries, "Максимум запоминаемых событий для дедупликации")
+	timezone := flag.String("timezone", "UTC", "Часовой пояс источников для меток времени без смещения (например, Europe/Moscow)")
+	hostTimezones := flag.String("host-timezones", "", "Часовые пояса отдельных хостов: host1=Europe/Moscow,host2=Asia/Omsk")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "Число параллельных обработчиков")
+	ordered := flag.Bool("ordered", true, "Сохранять порядок строк в выходных данных")
+	format := flag.String("format", "auto", "Формат входных данных: auto (построчно, тип определяется автоматически) xml (экспорт журнала Windows <Events>), evtx (файл журнала Windows .evtx) или auditd (audit.log со сборкой событий из записей). Формат вывода задает -output-format")
+	framingMode := flag.String("framing", "newline", "Разбиение входа на записи: newline (строка), xml (элемент XML, см. -xml-element), regex (начало записи по -record-start) или octet (octet-counting)")
+	xmlElement := flag.String("xml-element", framing.DefaultXMLElement, "Элемент XML, образующий запись, для -framing xml")
+	recordStart := flag.String("record-start", "", "Выражение начала записи для -framing regex (например, ^\\d{4}-\\d{2}-\\d{2})")
+	maxRecordSize := flag.Int("max-record-size", framing.DefaultMaxRecordSize, "Максимальный размер записи в байтах; более длинные записи пропускаются с ошибкой")
+	deadLetterFile := flag.String("dead-letter", "", "Файл для строк, которые не удалось разобрать (JSON на строку: строка, файл, номер строки, тип лога, ошибка)")
+	replayFile := flag.String("replay", "", "Повторно обработать записи файла dead-letter вместо -input")
 	flag.Parse()
 
 	proc := processor.NewProcessor()
+	proc.SetWorkers(*workers)
+	proc.SetOrdered(*ordered)
+	proc.SetLenient(*lenient)
+	proc.SetOrigin(*origin)
 
-	var scanner *bufio.Scanner
+	if *rulesFile != "" {
+		engine, err := rules.LoadFile(*rulesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка загрузки правил: %v\n", err)
+			os.Exit(1)
+		}
+		proc.SetRules(engine)
+	}
+
+	if err := proc.ConfigureTimezones(*timezone, *hostTimezones); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки часовых поясов: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonProfiles != "" {
+		if err := proc.LoadJSONProfiles(*jsonProfiles); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка загрузки профилей JSON: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := proc.ConfigureKV(*kvProfiles, *kvPairSeparator, *kvValueSeparator); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки парсера KV: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := proc.ConfigureGrok(*grokPatterns, *grokProfiles); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки парсера grok: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := proc.ConfigureDedup(*stableIDs, *dedupWindow, *dedupMode, *dedupMax); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки дедупликации: %v\n", err)
+		os.Exit(1)
+	}
+
+	var input io.Reader = os.Stdin
 	
 	if *inputFile != "" {
 		file, err := os.Open(*inputFile)
@@ -25,9 +104,7 @@ func main() {
 			os.Exit(1)
 		}
 		defer file.Close()
-		scanner = bufio.NewScanner(file)
-	} else {
-		scanner = bufio.NewScanner(os.Stdin)
+		input = file
 	}
 
 	var output *os.File
@@ -43,43 +120,358 @@ func main() {
 		output = os.Stdout
 	}
 
-	lineNum := 0
-	successCount := 0
-	errorCount := 0
+	encoder, err := processor.NewEncoder(*outputFormat, output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка выбора формата вывода: %v\n", err)
+		os.Exit(1)
+	}
+	if *omitRaw {
+		encoder = processor.OmitRaw(encoder)
+	}
 
-	for scanner.Scan() {
-		lineNum++
-		logLine := scanner.Text()
-		
-		if logLine == "" {
-			continue
+	var deadLetter deadletter.Sink
+	if *deadLetterFile != "" {
+		if *deadLetterFile == *replayFile {
+			fmt.Fprintf(os.Stderr, "Файл -dead-letter должен отличаться от -replay\n")
+			os.Exit(1)
 		}
+		file, err := os.OpenFile(*deadLetterFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка открытия файла dead-letter: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		deadLetter = deadletter.NewWriterSink(file)
+	}
 
-		event, err := proc.Process(logLine)
+	// Повтор: строки берутся из dead-letter, снова не разобранные
+	// записываются в -dead-letter
+	if *replayFile != "" {
+		stats, err := replayDeadLetters(proc, *replayFile, encoder, deadLetter)
+		flushDedup(proc, encoder)
+		closeEncoder(encoder)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Ошибка обработки строки %d: %v\n", lineNum, err)
-			errorCount++
-			continue
+			fmt.Fprintf(os.Stderr, "Ошибка чтения dead-letter: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "\nПовторная обработка завершена:\n")
+		fmt.Fprintf(os.Stderr, "  Успешно: %d\n", stats.Replayed)
+		fmt.Fprintf(os.Stderr, "  Ошибок: %d\n", stats.Failed)
+		if stats.Duplicates > 0 {
+			fmt.Fprintf(os.Stderr, "  Повторов: %d\n", stats.Duplicates)
 		}
+		return
+	}
 
-		jsonOutput, err := proc.ConvertToJSON(event)
+	switch *format {
+	case "auto", "xml", "evtx", "auditd":
+	default:
+		fmt.Fprintf(os.Stderr, "Неизвестный формат входных данных: %s\n", *format)
+		for _, name := range processor.EncoderFormats {
+			if name == *format {
+				fmt.Fprintf(os.Stderr, "Формат вывода задается флагом -output-format\n")
+			}
+		}
+		os.Exit(1)
+	}
+	// Для xml, evtx и auditd парсер и границы записей задает формат
+	if *format != "auto" && (*parserName != "" || *framingMode != "newline") {
+		fmt.Fprintf(os.Stderr, "Флаги -parser и -framing используются только с -format auto\n")
+		os.Exit(1)
+	}
+
+	source := *inputFile
+	if source == "" {
+		source = "stdin"
+	}
+
+	// Журнал аудита собирает события из нескольких строк, поэтому
+	// разбирается последовательно
+	if *format == "auditd" {
+		stats, err := processAuditd(proc, input, encoder, deadLetter, source)
+		flushDedup(proc, encoder)
+		closeEncoder(encoder)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Ошибка преобразования в JSON строки %d: %v\n", lineNum, err)
-			errorCount++
-			continue
+			fmt.Fprintf(os.Stderr, "Ошибка чтения журнала аудита: %v\n", err)
+			os.Exit(1)
 		}
+		stats.print()
+		return
+	}
+
+	// Экспорт журнала Windows и записи EVTX разбираются парсером xml по
+	// одному элементу <Event>, как строки в режиме auto
+	var reader recordReader
+	unit := "строки"
+	switch *format {
+	case "xml":
+		*parserName = "xml"
+		reader, err = newRecordReader(input, "xml", "Event", "", *maxRecordSize)
+	case "evtx":
+		*parserName = "xml"
+		unit = "записи"
+		var evtxReader *evtx.Reader
+		if evtxReader, err = evtx.NewReader(input); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка чтения EVTX: %v\n", err)
+			os.Exit(1)
+		}
+		reader = evtxRecords{evtxReader}
+	default:
+		reader, err = newRecordReader(input, *framingMode, *xmlElement, *recordStart, *maxRecordSize)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки кадрирования: %v\n", err)
+		os.Exit(1)
+	}
+
+	var stats runStats
+
+	// Чтение идет в отдельной горутине, разбор - пулом воркеров. Слишком
+	// длинные и поврежденные записи пропускаются с сообщением об ошибке.
+	// recordLines хранит номера строк входа для записей, находящихся в
+	// обработке.
+	var readErr error
+	var skippedCount int
+	var recordLines sync.Map
+	lines := make(chan string, *workers)
+	go func() {
+		defer close(lines)
+		sent := 0
+		for {
+			record, err := reader.Next()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+			stats.records++
+			if record.Err != nil {
+				if record.Line > 0 {
+					fmt.Fprintf(os.Stderr, "Ошибка чтения %s %d: %v\n", unit, record.Line, record.Err)
+				} else {
+					fmt.Fprintf(os.Stderr, "Ошибка чтения: %v\n", record.Err)
+				}
+				skippedCount++
+				continue
+			}
+			if strings.TrimSpace(record.Text) == "" {
+				continue
+			}
+			sent++
+			recordLines.Store(sent, record.Line)
+			lines <- record.Text
+		}
+	}()
+
+	// С -parser все строки разбираются одним парсером без автоопределения
+	var results <-chan processor.Result
+	if *parserName != "" {
+		results, err = proc.ProcessStreamWith(context.Background(), *parserName, lines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка выбора парсера: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		results = proc.ProcessStream(context.Background(), lines)
+	}
+
+	failures := &failureReporter{proc: proc, sink: deadLetter, source: source, parser: *parserName, unit: unit}
+	for result := range results {
+		value, _ := recordLines.LoadAndDelete(result.Line)
+		line, _ := value.(int)
 
-		fmt.Fprintln(output, jsonOutput)
-		successCount++
+		if errors.Is(result.Err, processor.ErrDuplicate) {
+			stats.duplicates++
+			continue
+		}
+		if result.Err != nil {
+			failures.report(&stats, result.Raw, line, errors.Unwrap(result.Err))
+			continue
+		}
+		stats.emit(encoder, result.Event, source, unit, line)
 	}
+	flushDedup(proc, encoder)
+	closeEncoder(encoder)
+	stats.errors += skippedCount
 
-	if err := scanner.Err(); err != nil {
+	if err := readErr; err != nil {
 		fmt.Fprintf(os.Stderr, "Ошибка чтения входных данных: %v\n", err)
 		os.Exit(1)
 	}
 
+	stats.print()
+}
+
+// recordReader выдает записи входа (framing.Reader, evtxRecords)
+type recordReader interface {
+	Next() (framing.Record, error)
+}
+
+// evtxRecords выдает XML записей файла .evtx; Line - идентификатор записи
+type evtxRecords struct {
+	reader *evtx.Reader
+}
+
+func (r evtxRecords) Next() (framing.Record, error) {
+	record, err := r.reader.Next()
+	if errors.Is(err, evtx.ErrCorrupt) {
+		return framing.Record{Err: err}, nil
+	}
+	if err != nil {
+		return framing.Record{}, err
+	}
+	return framing.Record{Text: record.XML, Line: int(record.ID)}, nil
+}
+
+// runStats - итоги обработки входа
+type runStats struct {
+	records    int
+	success    int
+	errors     int
+	duplicates int
+	dead       int
+}
+
+// emit выводит событие записи line входа source
+func (s *runStats) emit(encoder processor.Encoder, event *models.GOSTEvent, source, unit string, line int) {
+	if event.Origin != nil {
+		event.Origin.Input = source
+	}
+	if err := encoder.Encode(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка вывода события %s %d: %v\n", unit, line, err)
+		s.errors++
+		return
+	}
+	s.success++
+}
+
+func (s *runStats) print() {
 	fmt.Fprintf(os.Stderr, "\nОбработка завершена:\n")
-	fmt.Fprintf(os.Stderr, "  Успешно: %d\n", successCount)
-	fmt.Fprintf(os.Stderr, "  Ошибок: %d\n", errorCount)
-	fmt.Fprintf(os.Stderr, "  Всего строк: %d\n", lineNum)
+	fmt.Fprintf(os.Stderr, "  Успешно: %d\n", s.success)
+	fmt.Fprintf(os.Stderr, "  Ошибок: %d\n", s.errors)
+	if s.duplicates > 0 {
+		fmt.Fprintf(os.Stderr, "  Повторов: %d\n", s.duplicates)
+	}
+	if s.dead > 0 {
+		fmt.Fprintf(os.Stderr, "  В dead-letter: %d\n", s.dead)
+	}
+	fmt.Fprintf(os.Stderr, "  Всего записей: %d\n", s.records)
+}
+
+// failureReporter выводит ошибки разбора и сохраняет неразобранные записи
+// в dead-letter
+type failureReporter struct {
+	proc   *processor.Processor
+	sink   deadletter.Sink
+	source string
+	parser string
+	unit   string
+}
+
+func (r *failureReporter) report(stats *runStats, raw string, line int, cause error) {
+	fmt.Fprintf(os.Stderr, "Ошибка обработки %s %d: %v\n", r.unit, line, cause)
+	stats.errors++
+	if r.sink == nil {
+		return
+	}
+
+	record := deadletter.NewRecord(r.proc, raw, r.parser, cause)
+	record.Source, record.Line = r.source, line
+	if err := r.sink.Write(record); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	stats.dead++
+}
+
+// processAuditd читает audit.log, объединяя записи одного события. События
+// проходят завершающие шаги процессора (Origin, идентификаторы,
+// дедупликация); неверные строки обрабатываются как в режиме auto: в
+// мягком режиме выдаются событием, иначе сохраняются в dead-letter.
+func processAuditd(proc *processor.Processor, input io.Reader, encoder processor.Encoder, deadLetter deadletter.Sink, source string) (runStats, error) {
+	var stats runStats
+
+	prs, ok := proc.Parser("auditd")
+	if !ok {
+		return stats, fmt.Errorf("парсер auditd не зарегистрирован")
+	}
+	auditParser, ok := prs.(*parser.AuditdParser)
+	if !ok {
+		return stats, fmt.Errorf("парсер auditd не поддерживает потоковый разбор")
+	}
+
+	failures := &failureReporter{proc: proc, sink: deadLetter, source: source, parser: "auditd", unit: "строки"}
+	err := auditParser.ParseRecords(input, func(event *models.GOSTEvent, raw string, line int) error {
+		stats.records++
+		events, err := proc.Finish("auditd", raw, []*models.GOSTEvent{event})
+		if errors.Is(err, processor.ErrDuplicate) {
+			stats.duplicates++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			stats.emit(encoder, event, source, "строки", line)
+		}
+		return nil
+	}, func(line int, raw string, err error) {
+		stats.records++
+		event, processErr := proc.ProcessWith("auditd", raw)
+		switch {
+		case errors.Is(processErr, processor.ErrDuplicate):
+			stats.duplicates++
+		case processErr != nil:
+			failures.report(&stats, raw, line, err)
+		default:
+			stats.emit(encoder, event, source, "строки", line)
+		}
+	})
+	return stats, err
+}
+
+// replayDeadLetters повторно обрабатывает записи файла dead-letter
+func replayDeadLetters(proc *processor.Processor, path string, encoder processor.Encoder, failed deadletter.Sink) (deadletter.ReplayStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return deadletter.ReplayStats{}, err
+	}
+	defer file.Close()
+
+	return deadletter.Replay(proc, file, encoder.Encode, failed)
+}
+
+// newRecordReader создает чтение записей входа по способу кадрирования
+func newRecordReader(input io.Reader, mode, element, start string, maxSize int) (*framing.Reader, error) {
+	cfg := framing.ReaderConfig{Element: element, MaxSize: maxSize}
+
+	var err error
+	if cfg.Mode, err = framing.ParseMode(mode); err != nil {
+		return nil, err
+	}
+	if start != "" {
+		if cfg.Start, err = regexp.Compile(start); err != nil {
+			return nil, fmt.Errorf("неверное выражение начала записи: %w", err)
+		}
+	}
+	return framing.NewReader(input, cfg)
+}
+
+// flushDedup выводит события с числом отброшенных повторов, которые еще
+// не получило ни одно событие (-dedup-mode drop)
+func flushDedup(proc *processor.Processor, encoder processor.Encoder) {
+	for _, event := range proc.FlushDedup(true) {
+		if err := encoder.Encode(event); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка вывода события: %v\n", err)
+		}
+	}
+}
+
+// closeEncoder завершает вывод; ошибка записи прерывает программу
+func closeEncoder(encoder processor.Encoder) {
+	if err := encoder.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка записи выходных данных: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/collector"
+	"github.com/kxrty/loggerv2/internal/deadletter"
+	"github.com/kxrty/loggerv2/internal/processor"
+	"github.com/kxrty/loggerv2/internal/queue"
+	"github.com/kxrty/loggerv2/internal/rules"
+	"github.com/kxrty/loggerv2/internal/siem"
+)
+
+func main() {
+	udpAddr := flag.String("udp", ":514", "Адрес UDP слушателя (пусто - отключен)")
+	tcpAddr := flag.String("tcp", ":514", "Адрес TCP слушателя (пусто - отключен)")
+	tlsAddr := flag.String("tls", "", "Адрес TLS слушателя, обычно :6514 (пусто - отключен)")
+	tlsCert := flag.String("tls-cert", "", "Сертификат сервера (PEM)")
+	tlsKey := flag.String("tls-key", "", "Закрытый ключ сервера (PEM)")
+	tlsCA := flag.String("tls-ca", "", "CA для проверки клиентских сертификатов (PEM)")
+	tcpFraming := flag.String("tcp-framing", "auto", "Кадрирование TCP слушателя: auto, octet-counting или non-transparent")
+	tlsFraming := flag.String("tls-framing", "auto", "Кадрирование TLS слушателя: auto, octet-counting или non-transparent")
+	maxConns := flag.Int("max-conns", collector.DefaultMaxConnections, "Максимум одновременных соединений на слушатель")
+	maxMessage := flag.Int("max-message", collector.DefaultMaxMessageSize, "Максимальный размер сообщения в байтах")
+	idleTimeout := flag.Duration("idle-timeout", collector.DefaultIdleTimeout, "Таймаут простоя соединения")
+	outputFile := flag.String("output", "", "Файл для нормализованных событий (по умолчанию stdout)")
+	deadLetterFile := flag.String("dead-letter", "", "Файл для сообщений, которые не удалось разобрать (JSON на строку; повтор - logger -replay)")
+	forwardSyslog := flag.String("forward-syslog", "", "Адрес SIEM для пересылки по Syslog (host:port)")
+	forwardProtocol := flag.String("forward-protocol", "udp", "Протокол пересылки по Syslog (udp, tcp или tls)")
+	forwardFraming := flag.String("forward-framing", "", "Кадрирование для TCP/TLS: non-transparent или octet-counting")
+	forwardFacility := flag.Int("forward-facility", siem.DefaultFacility, "Syslog facility пересылаемых событий (1-23)")
+	forwardAppName := flag.String("forward-app-name", siem.DefaultAppName, "APP-NAME для событий без приложения")
+	forwardCA := flag.String("forward-tls-ca", "", "CA для проверки сертификата SIEM (PEM)")
+	forwardCert := flag.String("forward-tls-cert", "", "Клиентский сертификат для TLS пересылки (PEM)")
+	forwardKey := flag.String("forward-tls-key", "", "Закрытый ключ клиентского сертификата (PEM)")
+	forwardSyslogFilter := flag.String("forward-syslog-filter", "", "Фильтр событий для пересылки по Syslog, например \"severity >= ВЫСОКИЙ\"")
+	forwardHTTP := flag.String("forward-http", "", "URL SIEM для пересылки по HTTP")
+	forwardToken := flag.String("forward-token", "", "Токен авторизации для HTTP пересылки")
+	forwardHTTPFilter := flag.String("forward-http-filter", "", "Фильтр событий для пересылки по HTTP")
+	queueDir := flag.String("queue-dir", "", "Каталог очереди на диске для пересылки в SIEM (пусто - без очереди)")
+	queueMaxSize := flag.Int64("queue-max-size", 1<<30, "Максимальный размер очереди каждого получателя в байтах (0 - без ограничения)")
+	queueOverflow := flag.String("queue-overflow", "drop-oldest", "Поведение при переполнении очереди: reject, drop-oldest или block")
+	rulesFile := flag.String("rules", "", "Файл правил классификации событий (только JSON). Без \"include_defaults\": true заменяет все встроенные правила")
+	jsonProfiles := flag.String("json-profiles", "", "Файл профилей сопоставления полей JSON логов")
+	kvProfiles := flag.String("kv-profiles", "", "Файл профилей сопоставления полей логов ключ=значение")
+	kvPairSeparator := flag.String("kv-pair-separator", "", "Разделитель пар ключ=значение (по умолчанию пробелы)")
+	kvValueSeparator := flag.String("kv-value-separator", "=", "Разделитель ключа и значения")
+	grokPatterns := flag.String("grok-patterns", "", "Файл дополнительных шаблонов grok (ИМЯ выражение)")
+	grokProfiles := flag.String("grok-profiles", "", "Файл профилей парсера grok (JSON)")
+	sourceParsers := flag.String("source-parsers", "", "Парсеры отдельных источников вместо автоопределения: 10.0.0.5=grok,10.0.1.0/24=json")
+	origin := flag.Bool("origin", false, "Добавлять в события origin: исходную строку, тип лога, время приема, слушатель и версию парсера")
+	omitRaw := flag.String("omit-raw", "", "Выходы без исходной строки origin.raw через запятую: output, syslog, http")
+	lenient := flag.Bool("lenient", false, "Не отбрасывать неразобранные строки: выдавать их событием СИСТЕМНОЕ_СОБЫТИЕ с parse_status и parse_error")
+	stableIDs := flag.Bool("stable-ids", false, "Вычислять event_id по содержимому события (одинаковые строки - одинаковый id)")
+	dedupWindow := flag.Duration("dedup-window", 0, "Окно дедупликации одинаковых событий (0 - отключена)")
+	dedupMode := flag.String("dedup-mode", "drop", "Обработка повторов: drop (отбрасывать) или count (выдавать с dedup_count)")
+	dedupMax := flag.Int("dedup-max-entries", processor.DefaultDedupMaxEntries, "Максимум запоминаемых событий для дедупликации")
+	timezone := flag.String("timezone", "UTC", "Часовой пояс источников для меток времени без смещения (например, Europe/Moscow)")
+	hostTimezones := flag.String("host-timezones", "", "Часовые пояса отдельных хостов: host1=Europe/Moscow,host2=Asia/Omsk")
+	statsInterval := flag.Duration("stats-interval", time.Minute, "Интервал вывода счетчиков (0 - отключен)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "Время на завершение обработки при остановке")
+	flag.Parse()
+
+	proc := processor.NewProcessor()
+	proc.SetLenient(*lenient)
+	proc.SetOrigin(*origin)
+	if *rulesFile != "" {
+		engine, err := rules.LoadFile(*rulesFile)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки правил: %v", err)
+		}
+		proc.SetRules(engine)
+	}
+	if err := proc.ConfigureTimezones(*timezone, *hostTimezones); err != nil {
+		log.Fatalf("Ошибка настройки часовых поясов: %v", err)
+	}
+	if *jsonProfiles != "" {
+		if err := proc.LoadJSONProfiles(*jsonProfiles); err != nil {
+			log.Fatalf("Ошибка загрузки профилей JSON: %v", err)
+		}
+	}
+	if err := proc.ConfigureKV(*kvProfiles, *kvPairSeparator, *kvValueSeparator); err != nil {
+		log.Fatalf("Ошибка настройки парсера KV: %v", err)
+	}
+	if err := proc.ConfigureGrok(*grokPatterns, *grokProfiles); err != nil {
+		log.Fatalf("Ошибка настройки парсера grok: %v", err)
+	}
+	if err := proc.ConfigureDedup(*stableIDs, *dedupWindow, *dedupMode, *dedupMax); err != nil {
+		log.Fatalf("Ошибка настройки дедупликации: %v", err)
+	}
+	sources, err := collector.ParseSourceParsers(*sourceParsers)
+	if err != nil {
+		log.Fatalf("Ошибка настройки парсеров источников: %v", err)
+	}
+	withoutRaw, err := parseOmitRaw(*omitRaw)
+	if err != nil {
+		log.Fatalf("Ошибка настройки -omit-raw: %v", err)
+	}
+
+	var outputs []collector.Output
+	var routes []siem.Route
+	queued := make(map[string]*siem.QueuedForwarder)
+
+	// withQueue оборачивает получателя SIEM очередью на диске, если она включена
+	withQueue := func(name string, target siem.Forwarder) siem.Forwarder {
+		if *queueDir == "" {
+			return target
+		}
+		overflow, err := queue.ParseOverflowPolicy(*queueOverflow)
+		if err != nil {
+			log.Fatalf("Ошибка настройки очереди: %v", err)
+		}
+		q, err := queue.Open(filepath.Join(*queueDir, name), queue.Options{
+			MaxSize:  *queueMaxSize,
+			Overflow: overflow,
+		})
+		if err != nil {
+			log.Fatalf("Ошибка открытия очереди %s: %v", name, err)
+		}
+		stats := q.Stats()
+		if stats.CorruptBytes > 0 {
+			log.Printf("Очередь %s: отброшено %d байт поврежденных данных", name, stats.CorruptBytes)
+		}
+		if stats.Records > 0 {
+			log.Printf("Очередь %s: %d событий ожидают доставки", name, stats.Records)
+		}
+		f := siem.NewQueuedForwarder(target, q)
+		queued[name] = f
+		return f
+	}
+
+	var writerOutput *collector.WriterOutput
+	if *outputFile != "" {
+		file, err := os.OpenFile(*outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatalf("Ошибка открытия выходного файла: %v", err)
+		}
+		defer file.Close()
+		writerOutput = collector.NewWriterOutput(file)
+	} else if *forwardSyslog == "" && *forwardHTTP == "" {
+		writerOutput = collector.NewWriterOutput(os.Stdout)
+	}
+	if writerOutput != nil {
+		writerOutput.SetOmitRaw(withoutRaw["output"])
+		outputs = append(outputs, writerOutput)
+	}
+
+	if *forwardSyslog != "" {
+		host, portStr, err := net.SplitHostPort(*forwardSyslog)
+		if err != nil {
+			log.Fatalf("Адрес SIEM должен быть в формате host:port: %v", err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			log.Fatalf("Неверный порт SIEM: %s", portStr)
+		}
+
+		syslogCfg := siem.SyslogConfig{
+			Host:     host,
+			Port:     port,
+			Protocol: *forwardProtocol,
+			Framing:  *forwardFraming,
+			Facility: *forwardFacility,
+			AppName:  *forwardAppName,
+		}
+		if *forwardProtocol == "tls" {
+			syslogCfg.TLSConfig, err = siem.NewTLSConfig(*forwardCA, *forwardCert, *forwardKey)
+			if err != nil {
+				log.Fatalf("Ошибка настройки TLS пересылки: %v", err)
+			}
+		}
+
+		forwarder, err := siem.NewSyslogForwarderWithConfig(syslogCfg)
+		if err != nil {
+			log.Fatalf("Ошибка настройки пересылки по Syslog: %v", err)
+		}
+		defer forwarder.Close()
+		routes = append(routes, siem.Route{
+			Name:      "syslog",
+			Forwarder: withQueue("syslog", forwarder),
+			Filter:    *forwardSyslogFilter,
+			OmitRaw:   withoutRaw["syslog"],
+		})
+	}
+
+	if *forwardHTTP != "" {
+		routes = append(routes, siem.Route{
+			Name:      "http",
+			Forwarder: withQueue("http", siem.NewHTTPForwarder(*forwardHTTP, *forwardToken, nil)),
+			Filter:    *forwardHTTPFilter,
+			OmitRaw:   withoutRaw["http"],
+		})
+	}
+
+	// Каждый получатель SIEM работает независимо: со своим фильтром,
+	// буфером и повторами. Получатели с очередью на диске пишут в нее
+	// синхронно, минуя буфер в памяти
+	router, err := siem.NewRouter(routes...)
+	if err != nil {
+		log.Fatalf("Ошибка настройки пересылки: %v", err)
+	}
+	if len(routes) > 0 {
+		outputs = append(outputs, router)
+	}
+
+	cfg := collector.Config{
+		UDPAddr:        *udpAddr,
+		TCPAddr:        *tcpAddr,
+		TLSAddr:        *tlsAddr,
+		TCPFraming:     *tcpFraming,
+		TLSFraming:     *tlsFraming,
+		MaxConnections: *maxConns,
+		MaxMessageSize: *maxMessage,
+		IdleTimeout:    *idleTimeout,
+		SourceParsers:  sources,
+	}
+
+	if *deadLetterFile != "" {
+		file, err := os.OpenFile(*deadLetterFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatalf("Ошибка открытия файла dead-letter: %v", err)
+		}
+		defer file.Close()
+		cfg.DeadLetter = deadletter.NewWriterSink(file)
+	}
+
+	if *tlsAddr != "" {
+		tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			log.Fatalf("Ошибка настройки TLS: %v", err)
+		}
+		cfg.TLSConfig = tlsConfig
+	}
+
+	c := collector.New(cfg, proc, outputs...)
+	if err := c.Start(); err != nil {
+		log.Fatalf("Ошибка запуска коллектора: %v", err)
+	}
+
+	for _, name := range []string{"udp", "tcp", "tls"} {
+		if addr := c.Addr(name); addr != nil {
+			log.Printf("Слушатель %s: %s", name, addr)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	var ticker <-chan time.Time
+	if *statsInterval > 0 {
+		t := time.NewTicker(*statsInterval)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+loop:
+	for {
+		select {
+		case <-ticker:
+			logStats(c, router, queued)
+		case sig := <-signals:
+			log.Printf("Получен сигнал %s, остановка...", sig)
+			break loop
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		log.Printf("Соединения закрыты принудительно: %v", err)
+	}
+
+	// Недоставленные события остаются в очереди до следующего запуска
+	if err := router.Close(); err != nil {
+		log.Printf("Ошибка остановки пересылки: %v", err)
+	}
+
+	logStats(c, router, queued)
+}
+
+func loadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("для TLS необходимы -tls-cert и -tls-key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки сертификата: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в файле %s нет сертификатов", caFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+func logStats(c *collector.Collector, router *siem.Router, queued map[string]*siem.QueuedForwarder) {
+	for _, s := range c.Stats() {
+		log.Printf("%s: принято=%d обработано=%d ошибок_разбора=%d дубликатов=%d ошибок_вывода=%d соединений=%d/%d отклонено=%d слишком_больших=%d",
+			s.Listener, s.Received, s.Processed, s.ParseErrors, s.Duplicates, s.OutputErrors,
+			s.ActiveConnections, s.TotalConnections, s.Rejected, s.Oversized)
+	}
+	for _, s := range router.Stats() {
+		log.Printf("получатель %s: отобрано=%d отправлено=%d ошибок=%d отброшено=%d повторов=%d в_буфере=%d",
+			s.Name, s.Matched, s.Sent, s.Failed, s.Dropped, s.Retries, s.Pending)
+	}
+	for name, f := range queued {
+		s := f.Stats()
+		log.Printf("очередь %s: ожидают=%d (%d байт) доставлено=%d повторов=%d отброшено=%d повреждено=%d (%d байт при открытии)",
+			name, s.Records, s.Bytes, s.Delivered, s.Retries, s.Dropped, s.Corrupt, s.CorruptBytes)
+	}
+}
+
+// parseOmitRaw разбирает список выходов без исходной строки: output, syslog,
+// http
+func parseOmitRaw(spec string) (map[string]bool, error) {
+	outputs := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+		case "output", "syslog", "http":
+			outputs[name] = true
+		default:
+			return nil, fmt.Errorf("неизвестный выход: %s", name)
+		}
+	}
+	return outputs, nil
+}
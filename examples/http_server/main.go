@@ -131,16 +131,8 @@ func main() {
 		logLine := strings.TrimSpace(string(body))
 		logType := proc.DetectLogType(logLine)
 
-		typeNames := map[processor.LogType]string{
-			processor.LogTypeSyslog: "Syslog",
-			processor.LogTypeCEF:    "CEF",
-			processor.LogTypeLEEF:   "LEEF",
-			processor.LogTypeXML:    "XML",
-			processor.LogTypeUnknown: "Unknown",
-		}
-
 		response := map[string]string{
-			"log_type": typeNames[logType],
+			"log_type": proc.LogTypeName(logType),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -11,7 +11,7 @@ import (
 )
 
 func main() {
-	fmt.Println("=== Пример интеграции с SIEM ===\n")
+	fmt.Print("=== Пример интеграции с SIEM ===\n\n")
 
 	// Создаем процессор логов
 	proc := processor.NewProcessor()
@@ -23,7 +23,7 @@ func main() {
 		"LEEF:1.0|IBM|QRadar|7.3|Login|usrName=admin\tresult=success\tsev=3",
 	}
 
-	fmt.Println("--- Сценарий 1: Отправка в SIEM через Syslog (UDP) ---\n")
+	fmt.Print("--- Сценарий 1: Отправка в SIEM через Syslog (UDP) ---\n\n")
 	
 	// ВАЖНО: Замените на адрес вашего SIEM
 	// Пример для локального тестирования (если SIEM недоступен):
@@ -32,7 +32,7 @@ func main() {
 	// Для демонстрации покажем, как это работало бы:
 	fmt.Println("Подключение к SIEM через Syslog...")
 	fmt.Println("  Адрес: siem.example.com:514 (UDP)")
-	fmt.Println("  Формат: RFC 5424 с JSON payload\n")
+	fmt.Print("  Формат: RFC 5424 с JSON payload\n\n")
 
 	// Обработка и форматирование для отправки
 	for i, logLine := range logs {
@@ -50,13 +50,13 @@ func main() {
 		fmt.Println()
 	}
 
-	fmt.Println("--- Сценарий 2: Отправка через HTTP API (Splunk HEC, Elastic) ---\n")
+	fmt.Print("--- Сценарий 2: Отправка через HTTP API (Splunk HEC, Elastic) ---\n\n")
 	
 	// Пример для Splunk HTTP Event Collector
 	fmt.Println("Конфигурация для Splunk HEC:")
 	fmt.Println("  URL: https://splunk.example.com:8088/services/collector/event")
 	fmt.Println("  Токен: ********-****-****-****-************")
-	fmt.Println("  Формат: JSON с ГОСТ полями\n")
+	fmt.Print("  Формат: JSON с ГОСТ полями\n\n")
 
 	_ = siem.NewHTTPForwarder(
 		"https://splunk.example.com:8088/services/collector/event",
@@ -70,12 +70,12 @@ func main() {
 	events, _ := proc.ProcessBatch(logs)
 
 	fmt.Printf("Подготовлено %d событий для отправки\n", len(events))
-	fmt.Println("В реальной ситуации здесь произойдет отправка через HTTP POST\n")
+	fmt.Print("В реальной ситуации здесь произойдет отправка через HTTP POST\n\n")
 
 	// В реальном использовании:
 	// err = httpForwarder.ForwardBatch(events)
 
-	fmt.Println("--- Сценарий 3: Интеграция через File Monitoring ---\n")
+	fmt.Print("--- Сценарий 3: Интеграция через File Monitoring ---\n\n")
 	
 	fmt.Println("Запись нормализованных логов в файл для SIEM:")
 	outputFile := "normalized_logs.json"
@@ -103,9 +103,9 @@ func main() {
 	writer.Flush()
 
 	fmt.Printf("\nФайл %s готов для мониторинга SIEM агентом\n", outputFile)
-	fmt.Println("(Splunk Universal Forwarder, Filebeat, NXLog, etc.)\n")
+	fmt.Print("(Splunk Universal Forwarder, Filebeat, NXLog, etc.)\n\n")
 
-	fmt.Println("--- Поддерживаемые SIEM системы ---\n")
+	fmt.Print("--- Поддерживаемые SIEM системы ---\n\n")
 	fmt.Println("✓ Splunk (через HEC или файлы)")
 	fmt.Println("✓ Elastic Stack (через HTTP API)")
 	fmt.Println("✓ IBM QRadar (через Syslog)")
@@ -0,0 +1,646 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/deadletter"
+	"github.com/kxrty/loggerv2/internal/framing"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/processor"
+)
+
+// Значения по умолчанию
+const (
+	DefaultMaxConnections = 1000
+	DefaultMaxMessageSize = 64 * 1024
+	DefaultIdleTimeout    = 5 * time.Minute
+)
+
+// ErrMessageTooLarge - датаграмма UDP больше MaxMessageSize; она не
+// разбирается, так как усечена при чтении
+var ErrMessageTooLarge = errors.New("сообщение больше максимального размера")
+
+// drainIdle - сколько соединение может молчать при остановке, прежде чем
+// оно будет закрыто: данные, уже отправленные клиентом, успевают дойти
+const drainIdle = 200 * time.Millisecond
+
+// Output принимает нормализованные события (siem.HTTPForwarder,
+// siem.SyslogForwarder, WriterOutput и т.д.)
+type Output interface {
+	Forward(event *models.GOSTEvent) error
+}
+
+// Config описывает слушатели коллектора. Пустой адрес отключает слушатель.
+type Config struct {
+	UDPAddr string
+	TCPAddr string
+	TLSAddr string
+
+	// TLSConfig обязателен, если задан TLSAddr
+	TLSConfig *tls.Config
+
+	// TCPFraming и TLSFraming - кадрирование потоковых слушателей: auto
+	// (по умолчанию), octet-counting или non-transparent (см. framing.Split)
+	TCPFraming string
+	TLSFraming string
+
+	// MaxConnections ограничивает число одновременных соединений
+	// на каждый потоковый слушатель (TCP, TLS)
+	MaxConnections int
+	// MaxMessageSize - максимальный размер одного сообщения в байтах
+	MaxMessageSize int
+	// IdleTimeout закрывает соединения без данных дольше указанного времени
+	IdleTimeout time.Duration
+
+	// SourceParsers закрепляет за источниками (IP-адрес или подсеть CIDR)
+	// парсер по имени вместо автоопределения формата. При пересечении
+	// подсетей выбирается наиболее узкая.
+	SourceParsers map[string]string
+
+	// DeadLetter сохраняет сообщения, которые не удалось разобрать
+	DeadLetter deadletter.Sink
+}
+
+// Stats - снимок счетчиков слушателя
+type Stats struct {
+	Listener          string
+	Received          int64
+	Processed         int64
+	ParseErrors       int64
+	Duplicates        int64
+	OutputErrors      int64
+	ActiveConnections int64
+	TotalConnections  int64
+	Rejected          int64
+	// Oversized - датаграммы UDP больше MaxMessageSize (не разбираются)
+	Oversized int64
+}
+
+// counters - счетчики слушателя
+type counters struct {
+	received     atomic.Int64
+	processed    atomic.Int64
+	parseErrors  atomic.Int64
+	duplicates   atomic.Int64
+	outputErrors atomic.Int64
+	active       atomic.Int64
+	total        atomic.Int64
+	rejected     atomic.Int64
+	oversized    atomic.Int64
+}
+
+// listener - запущенный слушатель
+type listener struct {
+	name     string
+	stream   net.Listener
+	packet   net.PacketConn
+	slots    chan struct{}
+	split    bufio.SplitFunc
+	counters counters
+}
+
+// sourceParser - подсеть источников с закрепленным парсером
+type sourceParser struct {
+	network *net.IPNet
+	parser  string
+}
+
+// Collector принимает syslog сообщения по UDP, TCP и TLS и передает
+// нормализованные события в выходы
+type Collector struct {
+	cfg     Config
+	proc    *processor.Processor
+	outputs []Output
+	sources []sourceParser
+
+	mu        sync.Mutex
+	listeners []*listener
+	conns     map[net.Conn]struct{}
+	closing   bool
+	// drainUntil - срок ctx, переданного в Shutdown (нулевой - без срока)
+	drainUntil time.Time
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// New создает коллектор
+func New(cfg Config, proc *processor.Processor, outputs ...Output) *Collector {
+	if cfg.MaxConnections <= 0 {
+		cfg.MaxConnections = DefaultMaxConnections
+	}
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+
+	return &Collector{
+		cfg:     cfg,
+		proc:    proc,
+		outputs: outputs,
+		conns:   make(map[net.Conn]struct{}),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start открывает все настроенные слушатели и начинает прием сообщений
+func (c *Collector) Start() error {
+	if c.cfg.UDPAddr == "" && c.cfg.TCPAddr == "" && c.cfg.TLSAddr == "" {
+		return fmt.Errorf("не задан ни один слушатель")
+	}
+
+	sources, err := c.compileSources()
+	if err != nil {
+		return err
+	}
+	c.sources = sources
+
+	if c.cfg.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", c.cfg.UDPAddr)
+		if err != nil {
+			c.closeListeners()
+			return fmt.Errorf("ошибка запуска UDP слушателя: %w", err)
+		}
+		c.addListener(&listener{name: "udp", packet: conn})
+	}
+
+	if c.cfg.TCPAddr != "" {
+		split, err := framing.Split(c.cfg.TCPFraming, c.cfg.MaxMessageSize)
+		if err != nil {
+			c.closeListeners()
+			return fmt.Errorf("TCP слушатель: %w", err)
+		}
+		ln, err := net.Listen("tcp", c.cfg.TCPAddr)
+		if err != nil {
+			c.closeListeners()
+			return fmt.Errorf("ошибка запуска TCP слушателя: %w", err)
+		}
+		c.addListener(&listener{name: "tcp", stream: ln, split: split})
+	}
+
+	if c.cfg.TLSAddr != "" {
+		if c.cfg.TLSConfig == nil {
+			c.closeListeners()
+			return fmt.Errorf("для TLS слушателя не задана конфигурация TLS")
+		}
+		split, err := framing.Split(c.cfg.TLSFraming, c.cfg.MaxMessageSize)
+		if err != nil {
+			c.closeListeners()
+			return fmt.Errorf("TLS слушатель: %w", err)
+		}
+		ln, err := tls.Listen("tcp", c.cfg.TLSAddr, c.cfg.TLSConfig)
+		if err != nil {
+			c.closeListeners()
+			return fmt.Errorf("ошибка запуска TLS слушателя: %w", err)
+		}
+		c.addListener(&listener{name: "tls", stream: ln, split: split})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if window := c.proc.DedupWindow(); window > 0 {
+		c.wg.Add(1)
+		go c.expireDedup(window)
+	}
+	for _, l := range c.listeners {
+		c.wg.Add(1)
+		if l.packet != nil {
+			go c.serveUDP(l)
+		} else {
+			l.slots = make(chan struct{}, c.cfg.MaxConnections)
+			go c.serveStream(l)
+		}
+	}
+
+	return nil
+}
+
+// Addr возвращает фактический адрес слушателя ("udp", "tcp" или "tls")
+func (c *Collector) Addr(name string) net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range c.listeners {
+		if l.name != name {
+			continue
+		}
+		if l.packet != nil {
+			return l.packet.LocalAddr()
+		}
+		return l.stream.Addr()
+	}
+	return nil
+}
+
+// Stats возвращает снимок счетчиков всех слушателей
+func (c *Collector) Stats() []Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]Stats, 0, len(c.listeners))
+	for _, l := range c.listeners {
+		stats = append(stats, Stats{
+			Listener:          l.name,
+			Received:          l.counters.received.Load(),
+			Processed:         l.counters.processed.Load(),
+			ParseErrors:       l.counters.parseErrors.Load(),
+			Duplicates:        l.counters.duplicates.Load(),
+			OutputErrors:      l.counters.outputErrors.Load(),
+			ActiveConnections: l.counters.active.Load(),
+			TotalConnections:  l.counters.total.Load(),
+			Rejected:          l.counters.rejected.Load(),
+			Oversized:         l.counters.oversized.Load(),
+		})
+	}
+	return stats
+}
+
+// Shutdown прекращает прием новых соединений и ждет, пока открытые
+// соединения дочитают данные: соединение закрывается, когда клиент
+// завершил его или молчит дольше drainIdle. По истечении ctx соединения
+// закрываются принудительно.
+func (c *Collector) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closing {
+		close(c.stop)
+	}
+	c.closing = true
+	c.drainUntil, _ = ctx.Deadline()
+	c.mu.Unlock()
+
+	c.closeListeners()
+
+	// Соединения, ожидающие данных с таймаутом простоя, переводятся на
+	// короткий таймаут остановки
+	c.mu.Lock()
+	for conn := range c.conns {
+		conn.SetReadDeadline(c.readDeadline())
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	// Числа отброшенных повторов выдаются и для незакрытых окон
+	defer func() { c.forward(c.proc.FlushDedup(true)) }()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		for conn := range c.conns {
+			conn.Close()
+		}
+		c.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// expireDedup раз в окно дедупликации выдает события с числом отброшенных
+// повторов для истекших окон
+func (c *Collector) expireDedup(window time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.forward(c.proc.FlushDedup(false))
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// forward передает события FlushDedup в выходы
+func (c *Collector) forward(events []*models.GOSTEvent) {
+	for _, event := range events {
+		for _, out := range c.outputs {
+			if err := out.Forward(event); err != nil {
+				log.Printf("collector: ошибка вывода события: %v", err)
+			}
+		}
+	}
+}
+
+func (c *Collector) addListener(l *listener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, l)
+}
+
+func (c *Collector) closeListeners() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range c.listeners {
+		if l.packet != nil {
+			l.packet.Close()
+		} else {
+			l.stream.Close()
+		}
+	}
+}
+
+func (c *Collector) serveUDP(l *listener) {
+	defer c.wg.Done()
+
+	// Лишний байт буфера отличает датаграмму предельного размера от
+	// усеченной при чтении
+	buf := make([]byte, c.cfg.MaxMessageSize+1)
+	for {
+		n, addr, err := l.packet.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("collector: ошибка чтения UDP: %v", err)
+			}
+			return
+		}
+		if n > c.cfg.MaxMessageSize {
+			l.counters.oversized.Add(1)
+			if c.cfg.DeadLetter != nil {
+				record := deadletter.NewRecord(c.proc, string(buf[:c.cfg.MaxMessageSize]), c.sourceParser(addr), ErrMessageTooLarge)
+				record.Source = l.name + "://" + addr.String()
+				if err := c.cfg.DeadLetter.Write(record); err != nil {
+					log.Printf("collector: %v", err)
+				}
+			}
+			continue
+		}
+
+		msg := strings.TrimRight(string(buf[:n]), "\r\n\x00")
+		c.handle(l, msg, addr)
+	}
+}
+
+func (c *Collector) serveStream(l *listener) {
+	defer c.wg.Done()
+
+	for {
+		conn, err := l.stream.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("collector: ошибка приема соединения %s: %v", l.name, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			l.counters.rejected.Add(1)
+			conn.Close()
+			continue
+		}
+
+		if !c.track(conn) {
+			<-l.slots
+			conn.Close()
+			return
+		}
+
+		l.counters.total.Add(1)
+		l.counters.active.Add(1)
+		c.wg.Add(1)
+		go func() {
+			defer func() {
+				c.untrack(conn)
+				conn.Close()
+				l.counters.active.Add(-1)
+				<-l.slots
+				c.wg.Done()
+			}()
+			c.serveConn(l, conn)
+		}()
+	}
+}
+
+// serveConn читает кадры из соединения с кадрированием слушателя
+func (c *Collector) serveConn(l *listener, conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), c.cfg.MaxMessageSize+framingOverhead)
+	scanner.Split(l.split)
+
+	for {
+		c.mu.Lock()
+		conn.SetReadDeadline(c.readDeadline())
+		c.mu.Unlock()
+		if !scanner.Scan() {
+			break
+		}
+		c.handle(l, scanner.Text(), conn.RemoteAddr())
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+		log.Printf("collector: %s соединение %s закрыто: %v", l.name, conn.RemoteAddr(), err)
+	}
+}
+
+// framingOverhead - запас буфера под префикс MSG-LEN и разделитель
+const framingOverhead = 16
+
+func (c *Collector) handle(l *listener, msg string, addr net.Addr) {
+	if strings.TrimSpace(msg) == "" {
+		return
+	}
+	l.counters.received.Add(1)
+
+	var event *models.GOSTEvent
+	var err error
+	name := c.sourceParser(addr)
+	if name != "" {
+		event, err = c.proc.ProcessWith(name, msg)
+	} else {
+		event, err = c.proc.Process(msg)
+	}
+	if errors.Is(err, processor.ErrDuplicate) {
+		l.counters.duplicates.Add(1)
+		return
+	}
+	if err != nil {
+		l.counters.parseErrors.Add(1)
+		if c.cfg.DeadLetter != nil {
+			record := deadletter.NewRecord(c.proc, msg, name, err)
+			record.Source = l.name + "://" + addr.String()
+			if err := c.cfg.DeadLetter.Write(record); err != nil {
+				log.Printf("collector: %v", err)
+			}
+		}
+		return
+	}
+
+	if event.AdditionalData == nil {
+		event.AdditionalData = make(map[string]interface{})
+	}
+	event.AdditionalData["collector_listener"] = l.name
+	if event.Origin != nil {
+		event.Origin.Input = l.name + "://" + addr.String()
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		event.AdditionalData["collector_peer"] = host
+		if event.Source.IPAddress == "" {
+			event.Source.IPAddress = host
+		}
+	}
+
+	failed := false
+	for _, out := range c.outputs {
+		if err := out.Forward(event); err != nil {
+			failed = true
+			log.Printf("collector: ошибка вывода события: %v", err)
+		}
+	}
+	if failed {
+		l.counters.outputErrors.Add(1)
+		return
+	}
+	l.counters.processed.Add(1)
+}
+
+// compileSources проверяет SourceParsers; подсети упорядочиваются от узких
+// к широким
+func (c *Collector) compileSources() ([]sourceParser, error) {
+	sources := make([]sourceParser, 0, len(c.cfg.SourceParsers))
+	for source, name := range c.cfg.SourceParsers {
+		if _, ok := c.proc.Parser(name); !ok {
+			return nil, fmt.Errorf("источник %s: парсер %q не зарегистрирован", source, name)
+		}
+
+		network, err := parseSource(source)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, sourceParser{network: network, parser: name})
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		si, _ := sources[i].network.Mask.Size()
+		sj, _ := sources[j].network.Mask.Size()
+		if si != sj {
+			return si > sj
+		}
+		return sources[i].network.String() < sources[j].network.String()
+	})
+	return sources, nil
+}
+
+// ParseSourceParsers разбирает список источников с парсерами вида
+// "10.0.0.5=grok,10.0.1.0/24=json" для Config.SourceParsers
+func ParseSourceParsers(spec string) (map[string]string, error) {
+	sources := make(map[string]string)
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		source, name, ok := strings.Cut(item, "=")
+		source, name = strings.TrimSpace(source), strings.TrimSpace(name)
+		if !ok || source == "" || name == "" {
+			return nil, fmt.Errorf("ожидается адрес=парсер: %s", item)
+		}
+		if _, err := parseSource(source); err != nil {
+			return nil, err
+		}
+		sources[source] = name
+	}
+
+	return sources, nil
+}
+
+// parseSource разбирает IP-адрес или подсеть CIDR
+func parseSource(source string) (*net.IPNet, error) {
+	if strings.Contains(source, "/") {
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, fmt.Errorf("неверная подсеть источника %q: %w", source, err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return nil, fmt.Errorf("неверный адрес источника %q", source)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// sourceParser возвращает парсер, закрепленный за адресом отправителя
+func (c *Collector) sourceParser(addr net.Addr) string {
+	if len(c.sources) == 0 || addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	for _, source := range c.sources {
+		if source.network.Contains(ip) {
+			return source.parser
+		}
+	}
+	return ""
+}
+
+// readDeadline возвращает срок чтения следующего кадра: таймаут простоя,
+// а при остановке - drainIdle, но не позже срока Shutdown. Вызывается
+// под c.mu.
+func (c *Collector) readDeadline() time.Time {
+	if !c.closing {
+		return time.Now().Add(c.cfg.IdleTimeout)
+	}
+	deadline := time.Now().Add(drainIdle)
+	if !c.drainUntil.IsZero() && c.drainUntil.Before(deadline) {
+		return c.drainUntil
+	}
+	return deadline
+}
+
+func (c *Collector) track(conn net.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return false
+	}
+	c.conns[conn] = struct{}{}
+	return true
+}
+
+func (c *Collector) untrack(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, conn)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
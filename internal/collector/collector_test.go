@@ -0,0 +1,285 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/deadletter"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/processor"
+)
+
+type memoryOutput struct {
+	mu     sync.Mutex
+	events []*models.GOSTEvent
+}
+
+func (o *memoryOutput) Forward(event *models.GOSTEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+	return nil
+}
+
+func (o *memoryOutput) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.events)
+}
+
+type memoryDeadLetter struct {
+	mu      sync.Mutex
+	records []*deadletter.Record
+}
+
+func (s *memoryDeadLetter) Write(record *deadletter.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for condition")
+}
+
+func TestCollector_TCPAndUDP(t *testing.T) {
+	out := &memoryOutput{}
+	dead := &memoryDeadLetter{}
+	c := New(Config{UDPAddr: "127.0.0.1:0", TCPAddr: "127.0.0.1:0", DeadLetter: dead}, processor.NewProcessor(), out)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	udp, err := net.Dial("udp", c.Addr("udp").String())
+	if err != nil {
+		t.Fatalf("Dial UDP failed: %v", err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, "<134>Oct 11 22:14:15 host su: udp message\n")
+
+	tcp, err := net.Dial("tcp", c.Addr("tcp").String())
+	if err != nil {
+		t.Fatalf("Dial TCP failed: %v", err)
+	}
+	msg := "<134>Oct 11 22:14:15 host app: octet\nframed"
+	fmt.Fprintf(tcp, "%d %s", len(msg), msg)
+	fmt.Fprint(tcp, "<134>Oct 11 22:14:15 host app: newline framed\n")
+	fmt.Fprint(tcp, "not a log line\n")
+
+	waitFor(t, func() bool { return out.count() == 3 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	tcp.Close()
+
+	var tcpStats Stats
+	for _, s := range c.Stats() {
+		if s.Listener == "tcp" {
+			tcpStats = s
+		}
+	}
+
+	if tcpStats.Received != 3 || tcpStats.Processed != 2 || tcpStats.ParseErrors != 1 {
+		t.Errorf("Unexpected TCP stats: %+v", tcpStats)
+	}
+	if len(dead.records) != 1 || dead.records[0].Raw != "not a log line" || dead.records[0].LogType != "unknown" ||
+		dead.records[0].Source != "tcp://"+tcp.LocalAddr().String() {
+		t.Errorf("Unexpected dead-letter records %+v", dead.records)
+	}
+	if tcpStats.ActiveConnections != 0 {
+		t.Errorf("Expected no active connections after shutdown, got %d", tcpStats.ActiveConnections)
+	}
+}
+
+func TestCollector_ConnectionLimit(t *testing.T) {
+	c := New(Config{TCPAddr: "127.0.0.1:0", MaxConnections: 1}, processor.NewProcessor(), &memoryOutput{})
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	first, err := net.Dial("tcp", c.Addr("tcp").String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer first.Close()
+	waitFor(t, func() bool { return c.Stats()[0].ActiveConnections == 1 })
+
+	second, err := net.Dial("tcp", c.Addr("tcp").String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer second.Close()
+
+	waitFor(t, func() bool { return c.Stats()[0].Rejected == 1 })
+}
+
+func TestCollector_SourceParsers(t *testing.T) {
+	out := &memoryOutput{}
+	cfg := Config{UDPAddr: "127.0.0.1:0", SourceParsers: map[string]string{"127.0.0.0/8": "syslog", "127.0.0.1": "grok"}}
+	c := New(cfg, processor.NewProcessor(), out)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	udp, err := net.Dial("udp", c.Addr("udp").String())
+	if err != nil {
+		t.Fatalf("Dial UDP failed: %v", err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, `<190>Oct 11 22:14:15 web01 nginx: 10.0.0.7 - - [11/Oct/2025:22:14:15 +0300] "GET /admin HTTP/1.1" 403 153 "-" "curl/8.0"`)
+
+	waitFor(t, func() bool { return out.count() == 1 })
+
+	event := out.events[0]
+	if event.AdditionalData["grok_profile"] != "http-access" || event.Action != "access_denied" {
+		t.Errorf("Expected event parsed by grok, got %s %v", event.Action, event.AdditionalData)
+	}
+	if event.Source.Hostname != "web01" || event.Source.IPAddress != "10.0.0.7" {
+		t.Errorf("Unexpected source %+v", event.Source)
+	}
+
+	for _, sources := range []map[string]string{{"10.0.0.0/33": "grok"}, {"10.0.0.1": "missing"}, {"host": "grok"}} {
+		c := New(Config{UDPAddr: "127.0.0.1:0", SourceParsers: sources}, processor.NewProcessor())
+		if err := c.Start(); err == nil {
+			c.Shutdown(context.Background())
+			t.Errorf("Expected error for source parsers %v", sources)
+		}
+	}
+}
+
+func TestCollector_Framing(t *testing.T) {
+	if err := New(Config{TCPAddr: "127.0.0.1:0", TCPFraming: "lf"}, processor.NewProcessor()).Start(); err == nil {
+		t.Fatal("Expected error for unknown framing")
+	}
+
+	out := &memoryOutput{}
+	c := New(Config{TCPAddr: "127.0.0.1:0", SourceParsers: map[string]string{"127.0.0.1": "grok"}}, processor.NewProcessor(), out)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	tcp, err := net.Dial("tcp", c.Addr("tcp").String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer tcp.Close()
+
+	// Строка с IP-адресом в начале не должна разрывать соединение
+	fmt.Fprint(tcp, "10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] \"GET / HTTP/1.1\" 200 612 \"-\" \"curl/8.0\"\n")
+	fmt.Fprint(tcp, "10.0.0.2 - - [11/Oct/2025:22:14:16 +0000] \"GET / HTTP/1.1\" 200 612 \"-\" \"curl/8.0\"\n")
+
+	waitFor(t, func() bool { return out.count() == 2 })
+}
+
+func TestCollector_DedupFlushOnShutdown(t *testing.T) {
+	proc := processor.NewProcessor()
+	proc.SetDedup(processor.DedupConfig{Window: time.Hour})
+
+	out := &memoryOutput{}
+	c := New(Config{TCPAddr: "127.0.0.1:0"}, proc, out)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	tcp, err := net.Dial("tcp", c.Addr("tcp").String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Fprint(tcp, "<134>Oct 11 22:14:15 host app: repeated\n")
+	}
+	waitFor(t, func() bool { return c.Stats()[0].Duplicates == 2 })
+	tcp.Close()
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// Окно не истекло, но число отброшенных повторов не теряется
+	if out.count() != 2 || out.events[1].AdditionalData["dedup_suppressed"] != 2 {
+		t.Errorf("Expected event with dedup_suppressed after shutdown, got %d events", out.count())
+	}
+}
+
+func TestCollector_ShutdownDrainsConnections(t *testing.T) {
+	out := &memoryOutput{}
+	c := New(Config{TCPAddr: "127.0.0.1:0"}, processor.NewProcessor(), out)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	tcp, err := net.Dial("tcp", c.Addr("tcp").String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer tcp.Close()
+
+	// Кадры, отправленные до остановки, но еще не прочитанные, не теряются
+	const burst = 2000
+	var frames []byte
+	for i := 0; i < burst; i++ {
+		frames = append(frames, fmt.Sprintf("<134>Oct 11 22:14:15 host app: message %d\n", i)...)
+	}
+	if _, err := tcp.Write(frames); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if got := out.count(); got != burst {
+		t.Errorf("Expected %d events after shutdown, got %d", burst, got)
+	}
+}
+
+func TestCollector_OversizedDatagram(t *testing.T) {
+	out := &memoryOutput{}
+	dead := &memoryDeadLetter{}
+	c := New(Config{UDPAddr: "127.0.0.1:0", MaxMessageSize: 64, DeadLetter: dead}, processor.NewProcessor(), out)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	udp, err := net.Dial("udp", c.Addr("udp").String())
+	if err != nil {
+		t.Fatalf("Dial UDP failed: %v", err)
+	}
+	defer udp.Close()
+	fmt.Fprintf(udp, "<134>Oct 11 22:14:15 host app: %0100d", 0)
+	fmt.Fprint(udp, "<134>Oct 11 22:14:15 host app: fits")
+
+	waitFor(t, func() bool { return out.count() == 1 })
+
+	stats := c.Stats()[0]
+	if stats.Oversized != 1 || stats.Received != 1 {
+		t.Errorf("Expected 1 oversized and 1 received datagram, got %+v", stats)
+	}
+	dead.mu.Lock()
+	defer dead.mu.Unlock()
+	if len(dead.records) != 1 || len(dead.records[0].Raw) != 64 {
+		t.Errorf("Expected truncated datagram in dead-letter, got %+v", dead.records)
+	}
+}
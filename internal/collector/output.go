@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// WriterOutput записывает события в io.Writer по одному JSON объекту на строку
+type WriterOutput struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	omitRaw bool
+}
+
+// NewWriterOutput создает вывод в io.Writer (файл, stdout)
+func NewWriterOutput(w io.Writer) *WriterOutput {
+	return &WriterOutput{encoder: json.NewEncoder(w)}
+}
+
+// SetOmitRaw задает, удаляется ли из событий исходная строка (Origin.Raw)
+func (o *WriterOutput) SetOmitRaw(omit bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.omitRaw = omit
+}
+
+// Forward записывает событие
+func (o *WriterOutput) Forward(event *models.GOSTEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.omitRaw {
+		event = event.WithoutRaw()
+	}
+
+	if err := o.encoder.Encode(event); err != nil {
+		return fmt.Errorf("ошибка записи события: %w", err)
+	}
+	return nil
+}
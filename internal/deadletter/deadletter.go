@@ -0,0 +1,133 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/processor"
+)
+
+// Record - строка, которую не удалось разобрать
+type Record struct {
+	Raw string `json:"raw"`
+	// Source - входной файл или адрес источника
+	Source string `json:"source,omitempty"`
+	// Line - номер строки во входном файле
+	Line int `json:"line,omitempty"`
+	// LogType - имя определенного типа лога (unknown, если не определен)
+	LogType string `json:"log_type"`
+	// Parser - парсер, заданный для строки явно (-parser, SourceParsers)
+	Parser string    `json:"parser,omitempty"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// NewRecord создает запись для строки raw, которую proc не разобрал.
+// parserName - парсер, которым разбиралась строка (пусто - автоопределение).
+func NewRecord(proc *processor.Processor, raw, parserName string, err error) *Record {
+	logType := parserName
+	if logType == "" {
+		logType = proc.LogTypeName(proc.DetectLogType(raw))
+	}
+	return &Record{
+		Raw:     raw,
+		LogType: logType,
+		Parser:  parserName,
+		Error:   err.Error(),
+		Time:    time.Now().UTC(),
+	}
+}
+
+// Sink принимает неразобранные записи
+type Sink interface {
+	Write(record *Record) error
+}
+
+// WriterSink записывает записи в io.Writer по одному JSON объекту на строку
+type WriterSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewWriterSink создает хранилище в io.Writer (файл, stderr)
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{encoder: json.NewEncoder(w)}
+}
+
+// Write записывает запись
+func (s *WriterSink) Write(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.encoder.Encode(record); err != nil {
+		return fmt.Errorf("ошибка записи в dead-letter: %w", err)
+	}
+	return nil
+}
+
+// Read читает записи, сохраненные WriterSink, и передает их fn
+func Read(r io.Reader, fn func(record *Record) error) error {
+	decoder := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("запись %d: %w", n, err)
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayStats - итоги повторной обработки
+type ReplayStats struct {
+	Replayed   int
+	Failed     int
+	Duplicates int
+}
+
+// Replay повторно обрабатывает записи из r (например, после исправления
+// правил или парсеров). Разобранные события передаются emit, записи,
+// которые снова не разобраны, - в failed (если задан) с новой ошибкой.
+// Записи с Parser разбираются тем же парсером.
+func Replay(proc *processor.Processor, r io.Reader, emit func(event *models.GOSTEvent) error, failed Sink) (ReplayStats, error) {
+	var stats ReplayStats
+
+	err := Read(r, func(record *Record) error {
+		var event *models.GOSTEvent
+		var err error
+		if record.Parser != "" {
+			event, err = proc.ProcessWith(record.Parser, record.Raw)
+		} else {
+			event, err = proc.Process(record.Raw)
+		}
+
+		switch {
+		case errors.Is(err, processor.ErrDuplicate):
+			stats.Duplicates++
+			return nil
+		case err != nil:
+			stats.Failed++
+			if failed == nil {
+				return nil
+			}
+			retry := NewRecord(proc, record.Raw, record.Parser, err)
+			retry.Source, retry.Line = record.Source, record.Line
+			return failed.Write(retry)
+		}
+
+		if event.Origin != nil {
+			event.Origin.Input = record.Source
+		}
+		stats.Replayed++
+		return emit(event)
+	})
+	return stats, err
+}
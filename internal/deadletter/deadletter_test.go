@@ -0,0 +1,103 @@
+package deadletter
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/processor"
+)
+
+func TestWriterSink_ReadBack(t *testing.T) {
+	proc := processor.NewProcessor()
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+
+	record := NewRecord(proc, "CEF:0|broken", "", errors.New("неверный формат CEF"))
+	record.Source, record.Line = "fw.log", 7
+	if err := sink.Write(record); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := sink.Write(NewRecord(proc, "free text", "grok", errors.New("нет совпадений"))); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("Expected one JSON object per line, got %q", buf.String())
+	}
+
+	var records []*Record
+	if err := Read(&buf, func(r *Record) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	first := records[0]
+	if first.Raw != "CEF:0|broken" || first.Source != "fw.log" || first.Line != 7 || first.LogType != "cef" || first.Error != "неверный формат CEF" || first.Time.IsZero() {
+		t.Errorf("Unexpected record %+v", first)
+	}
+	if records[1].LogType != "grok" || records[1].Parser != "grok" {
+		t.Errorf("Expected forced parser to be recorded, got %+v", records[1])
+	}
+	if NewRecord(proc, "free text", "", errors.New("x")).LogType != "unknown" {
+		t.Error("Expected unknown log type")
+	}
+
+	if err := Read(strings.NewReader("{\"raw\": \"x\"}\nnot json\n"), func(*Record) error { return nil }); err == nil {
+		t.Error("Expected error for malformed record")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	proc := processor.NewProcessor()
+
+	var stored bytes.Buffer
+	sink := NewWriterSink(&stored)
+	for _, line := range []string{
+		"<134>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+		"free text",
+		`{"message": "login"}`,
+	} {
+		record := NewRecord(proc, line, "", errors.New("ошибка"))
+		record.Source, record.Line = "in.log", 1
+		sink.Write(record)
+	}
+	// Строка, которую можно разобрать только явно заданным парсером
+	sink.Write(&Record{Raw: "10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] \"GET / HTTP/1.1\" 200 612", Parser: "syslog", LogType: "syslog"})
+
+	var events []*models.GOSTEvent
+	var failed bytes.Buffer
+	stats, err := Replay(proc, &stored, func(event *models.GOSTEvent) error {
+		events = append(events, event)
+		return nil
+	}, NewWriterSink(&failed))
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	if stats.Replayed != 2 || stats.Failed != 2 || len(events) != 2 {
+		t.Fatalf("Unexpected stats %+v (%d events)", stats, len(events))
+	}
+	if events[0].Source.Hostname != "mymachine" {
+		t.Errorf("Unexpected replayed event %+v", events[0])
+	}
+
+	var retried []*Record
+	Read(&failed, func(r *Record) error {
+		retried = append(retried, r)
+		return nil
+	})
+	if len(retried) != 2 || retried[0].Raw != "free text" || retried[0].Source != "in.log" || retried[0].Line != 1 || retried[0].Error == "ошибка" {
+		t.Errorf("Unexpected failed records %+v", retried)
+	}
+	if retried[1].Parser != "syslog" {
+		t.Errorf("Expected parser to be kept, got %+v", retried[1])
+	}
+}
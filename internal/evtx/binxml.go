@@ -0,0 +1,772 @@
+package evtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Токены двоичного XML; бит tokenMore у элементов означает наличие
+// атрибутов, у атрибутов и значений - что за ними следуют еще
+const (
+	tokenEOF                  = 0x00
+	tokenOpenStartElement     = 0x01
+	tokenCloseStartElement    = 0x02
+	tokenCloseEmptyElement    = 0x03
+	tokenEndElement           = 0x04
+	tokenValue                = 0x05
+	tokenAttribute            = 0x06
+	tokenCDATA                = 0x07
+	tokenCharRef              = 0x08
+	tokenEntityRef            = 0x09
+	tokenPITarget             = 0x0a
+	tokenPIData               = 0x0b
+	tokenTemplateInstance     = 0x0c
+	tokenNormalSubstitution   = 0x0d
+	tokenOptionalSubstitution = 0x0e
+	tokenFragmentHeader       = 0x0f
+
+	tokenMore = 0x40
+)
+
+// Типы значений подстановок
+const (
+	typeNull       = 0x00
+	typeString     = 0x01
+	typeAnsiString = 0x02
+	typeInt8       = 0x03
+	typeUint8      = 0x04
+	typeInt16      = 0x05
+	typeUint16     = 0x06
+	typeInt32      = 0x07
+	typeUint32     = 0x08
+	typeInt64      = 0x09
+	typeUint64     = 0x0a
+	typeReal32     = 0x0b
+	typeReal64     = 0x0c
+	typeBool       = 0x0d
+	typeBinary     = 0x0e
+	typeGUID       = 0x0f
+	typeSizeT      = 0x10
+	typeFileTime   = 0x11
+	typeSystemTime = 0x12
+	typeSID        = 0x13
+	typeHexInt32   = 0x14
+	typeHexInt64   = 0x15
+	typeBinXML     = 0x21
+
+	typeArray = 0x80
+)
+
+// maxDepth ограничивает вложенность шаблонов и элементов
+const maxDepth = 64
+
+// node - узел разобранного двоичного XML: element, text, rawXML,
+// substitution или instance
+type node interface{}
+
+type element struct {
+	name     string
+	attrs    []attribute
+	children []node
+}
+
+type attribute struct {
+	name  string
+	value []node
+}
+
+// text - значение, при выводе экранируется
+type text string
+
+// rawXML - готовая разметка (CDATA, ссылки на символы и сущности)
+type rawXML string
+
+// substitution - место для значения из экземпляра шаблона
+type substitution struct {
+	index    int
+	optional bool
+}
+
+// instance - экземпляр шаблона со значениями подстановок
+type instance struct {
+	template []node
+	values   []value
+}
+
+// value - значение подстановки; offset - смещение данных в чанке, нужно
+// для вложенного двоичного XML
+type value struct {
+	kind   byte
+	data   []byte
+	offset int
+}
+
+// chunk - чанк файла; смещения имен и шаблонов отсчитываются от его начала
+type chunk struct {
+	data      []byte
+	pos       int
+	end       int
+	names     map[uint32]string
+	templates map[uint32][]node
+}
+
+// binReader разбирает двоичный XML в пределах [pos, end) чанка
+type binReader struct {
+	c     *chunk
+	pos   int
+	end   int
+	depth int
+}
+
+// render разбирает фрагмент двоичного XML и выводит его как текст XML
+func (c *chunk) render(start, end int) (string, error) {
+	r := &binReader{c: c, pos: start, end: end}
+	nodes, err := r.fragment()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := c.write(&b, nodes, nil, 0); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (r *binReader) need(n int) error {
+	if n < 0 || r.pos+n > r.end {
+		return fmt.Errorf("выход за границу данных по смещению %d", r.pos)
+	}
+	return nil
+}
+
+func (r *binReader) peek() (byte, error) {
+	if err := r.need(1); err != nil {
+		return 0, err
+	}
+	return r.c.data[r.pos], nil
+}
+
+func (r *binReader) byte() (byte, error) {
+	b, err := r.peek()
+	r.pos++
+	return b, err
+}
+
+func (r *binReader) uint16() (uint16, error) {
+	if err := r.need(2); err != nil {
+		return 0, err
+	}
+	v := binary.LittleEndian.Uint16(r.c.data[r.pos:])
+	r.pos += 2
+	return v, nil
+}
+
+func (r *binReader) uint32() (uint32, error) {
+	if err := r.need(4); err != nil {
+		return 0, err
+	}
+	v := binary.LittleEndian.Uint32(r.c.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+func (r *binReader) skip(n int) error {
+	if err := r.need(n); err != nil {
+		return err
+	}
+	r.pos += n
+	return nil
+}
+
+// utf16String читает строку из count символов UTF-16LE
+func (r *binReader) utf16String(count int) (string, error) {
+	if err := r.need(count * 2); err != nil {
+		return "", err
+	}
+	s := decodeUTF16(r.c.data[r.pos : r.pos+count*2])
+	r.pos += count * 2
+	return s, nil
+}
+
+// fragment разбирает узлы до токена EOF или конца данных
+func (r *binReader) fragment() ([]node, error) {
+	nodes, token, err := r.content()
+	if err != nil {
+		return nil, err
+	}
+	if token == tokenEndElement {
+		return nil, fmt.Errorf("лишний конец элемента по смещению %d", r.pos-1)
+	}
+	return nodes, nil
+}
+
+// content разбирает узлы до конца элемента или фрагмента и возвращает
+// завершивший их токен
+func (r *binReader) content() ([]node, byte, error) {
+	r.depth++
+	defer func() { r.depth-- }()
+	if r.depth > maxDepth {
+		return nil, 0, fmt.Errorf("слишком глубокая вложенность")
+	}
+
+	var nodes []node
+	for r.pos < r.end {
+		token, err := r.peek()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch token &^ tokenMore {
+		case tokenEOF:
+			r.pos++
+			return nodes, tokenEOF, nil
+		case tokenEndElement:
+			r.pos++
+			return nodes, tokenEndElement, nil
+		case tokenFragmentHeader:
+			if err := r.skip(4); err != nil {
+				return nil, 0, err
+			}
+		case tokenOpenStartElement:
+			el, err := r.element()
+			if err != nil {
+				return nil, 0, err
+			}
+			nodes = append(nodes, el)
+		case tokenTemplateInstance:
+			inst, err := r.instance()
+			if err != nil {
+				return nil, 0, err
+			}
+			nodes = append(nodes, inst)
+		case tokenPITarget:
+			pi, err := r.processingInstruction()
+			if err != nil {
+				return nil, 0, err
+			}
+			nodes = append(nodes, pi)
+		default:
+			n, err := r.valueNode()
+			if err != nil {
+				return nil, 0, err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+
+	return nodes, tokenEOF, nil
+}
+
+// element разбирает элемент с атрибутами и содержимым
+func (r *binReader) element() (*element, error) {
+	token, _ := r.byte()
+	// Идентификатор зависимости и размер элемента
+	if err := r.skip(6); err != nil {
+		return nil, err
+	}
+
+	name, err := r.name()
+	if err != nil {
+		return nil, err
+	}
+	el := &element{name: name}
+
+	if token&tokenMore != 0 {
+		// Размер списка атрибутов
+		if err := r.skip(4); err != nil {
+			return nil, err
+		}
+		for {
+			next, err := r.peek()
+			if err != nil {
+				return nil, err
+			}
+			if next&^tokenMore != tokenAttribute {
+				break
+			}
+			r.pos++
+
+			attr := attribute{}
+			if attr.name, err = r.name(); err != nil {
+				return nil, err
+			}
+			if attr.value, err = r.attributeValue(); err != nil {
+				return nil, err
+			}
+			el.attrs = append(el.attrs, attr)
+		}
+	}
+
+	closing, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch closing {
+	case tokenCloseEmptyElement:
+		return el, nil
+	case tokenCloseStartElement:
+		children, end, err := r.content()
+		if err != nil {
+			return nil, err
+		}
+		if end != tokenEndElement {
+			return nil, fmt.Errorf("элемент %s не закрыт", name)
+		}
+		el.children = children
+		return el, nil
+	}
+	return nil, fmt.Errorf("неожиданный токен 0x%02x в элементе %s", closing, name)
+}
+
+// attributeValue разбирает значения, следующие за именем атрибута
+func (r *binReader) attributeValue() ([]node, error) {
+	var nodes []node
+	for {
+		token, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch token &^ tokenMore {
+		case tokenValue, tokenCharRef, tokenEntityRef, tokenNormalSubstitution, tokenOptionalSubstitution:
+		default:
+			return nodes, nil
+		}
+
+		n, err := r.valueNode()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+// valueNode разбирает текстовое значение, ссылку или подстановку
+func (r *binReader) valueNode() (node, error) {
+	token, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token &^ tokenMore {
+	case tokenValue:
+		kind, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if kind != typeString {
+			return nil, fmt.Errorf("неподдерживаемый тип значения 0x%02x", kind)
+		}
+		count, err := r.uint16()
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.utf16String(int(count))
+		return text(s), err
+
+	case tokenCDATA:
+		count, err := r.uint16()
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.utf16String(int(count))
+		return rawXML("<![CDATA[" + s + "]]>"), err
+
+	case tokenCharRef:
+		ref, err := r.uint16()
+		return rawXML(fmt.Sprintf("&#%d;", ref)), err
+
+	case tokenEntityRef:
+		name, err := r.name()
+		return rawXML("&" + name + ";"), err
+
+	case tokenNormalSubstitution, tokenOptionalSubstitution:
+		index, err := r.uint16()
+		if err != nil {
+			return nil, err
+		}
+		// Тип значения задается в массиве подстановок экземпляра
+		if err := r.skip(1); err != nil {
+			return nil, err
+		}
+		return substitution{index: int(index), optional: token == tokenOptionalSubstitution}, nil
+	}
+
+	return nil, fmt.Errorf("неизвестный токен 0x%02x по смещению %d", token, r.pos-1)
+}
+
+// processingInstruction разбирает пару PITarget + PIData
+func (r *binReader) processingInstruction() (node, error) {
+	r.pos++
+	target, err := r.name()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if token != tokenPIData {
+		return rawXML("<?" + target + "?>"), nil
+	}
+	count, err := r.uint16()
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.utf16String(int(count))
+	return rawXML("<?" + target + " " + data + "?>"), err
+}
+
+// name читает смещение имени; имя, встреченное в чанке впервые, записано
+// сразу за смещением
+func (r *binReader) name() (string, error) {
+	offset, err := r.uint32()
+	if err != nil {
+		return "", err
+	}
+
+	name, size, err := r.c.name(offset)
+	if err != nil {
+		return "", err
+	}
+	if int(offset) == r.pos {
+		r.pos += size
+	}
+	return name, nil
+}
+
+// name возвращает имя по смещению: смещение следующего имени (4 байта),
+// хеш (2), число символов (2), символы UTF-16LE и завершающий ноль
+func (c *chunk) name(offset uint32) (string, int, error) {
+	start := int(offset)
+	if start+8 > len(c.data) {
+		return "", 0, fmt.Errorf("неверное смещение имени %d", offset)
+	}
+	count := int(binary.LittleEndian.Uint16(c.data[start+6:]))
+	size := 8 + count*2 + 2
+	if start+size > len(c.data) {
+		return "", 0, fmt.Errorf("неверная длина имени по смещению %d", offset)
+	}
+
+	if name, ok := c.names[offset]; ok {
+		return name, size, nil
+	}
+	name := decodeUTF16(c.data[start+8 : start+8+count*2])
+	c.names[offset] = name
+	return name, size, nil
+}
+
+// instance разбирает экземпляр шаблона: ссылку на определение (или само
+// определение при первом использовании в чанке) и массив подстановок
+func (r *binReader) instance() (node, error) {
+	// Токен и неизвестный байт, идентификатор шаблона
+	if err := r.skip(6); err != nil {
+		return nil, err
+	}
+	offset, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	template, size, err := r.c.template(offset, r.depth)
+	if err != nil {
+		return nil, err
+	}
+	if int(offset) == r.pos {
+		if err := r.skip(size); err != nil {
+			return nil, err
+		}
+	}
+
+	count, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.need(int(count) * 4); err != nil {
+		return nil, err
+	}
+
+	values := make([]value, count)
+	for i := range values {
+		size, _ := r.uint16()
+		kind, _ := r.byte()
+		r.pos++
+		values[i] = value{kind: kind, data: make([]byte, size)}
+	}
+	for i := range values {
+		size := len(values[i].data)
+		if err := r.need(size); err != nil {
+			return nil, err
+		}
+		values[i].offset = r.pos
+		values[i].data = r.c.data[r.pos : r.pos+size]
+		r.pos += size
+	}
+
+	return &instance{template: template, values: values}, nil
+}
+
+// template возвращает определение шаблона: смещение следующего
+// определения (4 байта), GUID (16), размер данных (4) и фрагмент
+func (c *chunk) template(offset uint32, depth int) ([]node, int, error) {
+	start := int(offset)
+	if start+24 > len(c.data) {
+		return nil, 0, fmt.Errorf("неверное смещение шаблона %d", offset)
+	}
+	size := int(binary.LittleEndian.Uint32(c.data[start+20:]))
+	if start+24+size > len(c.data) {
+		return nil, 0, fmt.Errorf("неверный размер шаблона по смещению %d", offset)
+	}
+
+	if nodes, ok := c.templates[offset]; ok {
+		return nodes, 24 + size, nil
+	}
+
+	r := &binReader{c: c, pos: start + 24, end: start + 24 + size, depth: depth}
+	nodes, err := r.fragment()
+	if err != nil {
+		return nil, 0, fmt.Errorf("шаблон по смещению %d: %w", offset, err)
+	}
+	c.templates[offset] = nodes
+	return nodes, 24 + size, nil
+}
+
+// write выводит узлы как XML, подставляя значения экземпляра шаблона
+func (c *chunk) write(b *strings.Builder, nodes []node, values []value, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("слишком глубокая вложенность")
+	}
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *element:
+			b.WriteString("<" + n.name)
+			for _, attr := range n.attrs {
+				if omitted(attr.value, values) {
+					continue
+				}
+				var v strings.Builder
+				if err := c.write(&v, attr.value, values, depth+1); err != nil {
+					return err
+				}
+				b.WriteString(" " + attr.name + `="` + v.String() + `"`)
+			}
+			if len(n.children) == 0 {
+				b.WriteString("/>")
+				continue
+			}
+			b.WriteString(">")
+			if err := c.write(b, n.children, values, depth+1); err != nil {
+				return err
+			}
+			b.WriteString("</" + n.name + ">")
+
+		case text:
+			b.WriteString(escapeXML(string(n)))
+
+		case rawXML:
+			b.WriteString(string(n))
+
+		case substitution:
+			if n.index >= len(values) {
+				return fmt.Errorf("нет значения подстановки %d", n.index)
+			}
+			if err := c.writeValue(b, values[n.index], depth); err != nil {
+				return fmt.Errorf("подстановка %d: %w", n.index, err)
+			}
+
+		case *instance:
+			if err := c.write(b, n.template, n.values, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// omitted - атрибут состоит из одной необязательной подстановки без значения
+func omitted(nodes []node, values []value) bool {
+	if len(nodes) != 1 {
+		return false
+	}
+	sub, ok := nodes[0].(substitution)
+	if !ok || !sub.optional || sub.index >= len(values) {
+		return false
+	}
+	v := values[sub.index]
+	return v.kind == typeNull || len(v.data) == 0
+}
+
+// writeValue выводит значение подстановки; вложенный двоичный XML
+// разбирается по месту
+func (c *chunk) writeValue(b *strings.Builder, v value, depth int) error {
+	if v.kind == typeBinXML {
+		r := &binReader{c: c, pos: v.offset, end: v.offset + len(v.data), depth: depth}
+		nodes, err := r.fragment()
+		if err != nil {
+			return err
+		}
+		return c.write(b, nodes, nil, depth+1)
+	}
+
+	s, err := formatValue(v.kind, v.data)
+	if err != nil {
+		return err
+	}
+	b.WriteString(escapeXML(s))
+	return nil
+}
+
+// valueSizes - размеры значений фиксированной длины (для массивов)
+var valueSizes = map[byte]int{
+	typeInt8: 1, typeUint8: 1, typeInt16: 2, typeUint16: 2,
+	typeInt32: 4, typeUint32: 4, typeInt64: 8, typeUint64: 8,
+	typeReal32: 4, typeReal64: 8, typeBool: 4, typeGUID: 16,
+	typeFileTime: 8, typeSystemTime: 16, typeHexInt32: 4, typeHexInt64: 8,
+}
+
+// formatValue выводит значение так же, как его отображает Windows
+func formatValue(kind byte, data []byte) (string, error) {
+	if kind&typeArray != 0 {
+		return formatArray(kind&^typeArray, data)
+	}
+
+	if size, ok := valueSizes[kind]; ok && len(data) < size {
+		return "", fmt.Errorf("значение типа 0x%02x: %d байт", kind, len(data))
+	}
+
+	le := binary.LittleEndian
+	switch kind {
+	case typeNull:
+		return "", nil
+	case typeString:
+		return strings.TrimRight(decodeUTF16(data), "\x00"), nil
+	case typeAnsiString:
+		return strings.TrimRight(string(data), "\x00"), nil
+	case typeInt8:
+		return strconv.Itoa(int(int8(data[0]))), nil
+	case typeUint8:
+		return strconv.Itoa(int(data[0])), nil
+	case typeInt16:
+		return strconv.Itoa(int(int16(le.Uint16(data)))), nil
+	case typeUint16:
+		return strconv.Itoa(int(le.Uint16(data))), nil
+	case typeInt32:
+		return strconv.Itoa(int(int32(le.Uint32(data)))), nil
+	case typeUint32:
+		return strconv.FormatUint(uint64(le.Uint32(data)), 10), nil
+	case typeInt64:
+		return strconv.FormatInt(int64(le.Uint64(data)), 10), nil
+	case typeUint64:
+		return strconv.FormatUint(le.Uint64(data), 10), nil
+	case typeReal32:
+		return strconv.FormatFloat(float64(math.Float32frombits(le.Uint32(data))), 'g', -1, 32), nil
+	case typeReal64:
+		return strconv.FormatFloat(math.Float64frombits(le.Uint64(data)), 'g', -1, 64), nil
+	case typeBool:
+		return strconv.FormatBool(le.Uint32(data) != 0), nil
+	case typeBinary:
+		return strings.ToUpper(hex.EncodeToString(data)), nil
+	case typeGUID:
+		return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", le.Uint32(data), le.Uint16(data[4:]), le.Uint16(data[6:]), data[8:10], data[10:16]), nil
+	case typeSizeT, typeHexInt32, typeHexInt64:
+		if len(data) == 4 {
+			return fmt.Sprintf("0x%x", le.Uint32(data)), nil
+		}
+		if len(data) == 8 {
+			return fmt.Sprintf("0x%x", le.Uint64(data)), nil
+		}
+		return "", fmt.Errorf("значение типа 0x%02x: %d байт", kind, len(data))
+	case typeFileTime:
+		t := filetime(le.Uint64(data))
+		return t.Format("2006-01-02T15:04:05.0000000Z"), nil
+	case typeSystemTime:
+		return fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d.%03dZ",
+			le.Uint16(data), le.Uint16(data[2:]), le.Uint16(data[6:]),
+			le.Uint16(data[8:]), le.Uint16(data[10:]), le.Uint16(data[12:]), le.Uint16(data[14:])), nil
+	case typeSID:
+		return formatSID(data)
+	}
+
+	return "", fmt.Errorf("неподдерживаемый тип значения 0x%02x", kind)
+}
+
+// formatArray выводит массив значений через запятую
+func formatArray(kind byte, data []byte) (string, error) {
+	var items []string
+
+	switch kind {
+	case typeString:
+		items = strings.Split(strings.TrimRight(decodeUTF16(data), "\x00"), "\x00")
+	case typeAnsiString:
+		items = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	default:
+		size, ok := valueSizes[kind]
+		if !ok {
+			return "", fmt.Errorf("неподдерживаемый тип массива 0x%02x", kind)
+		}
+		for i := 0; i+size <= len(data); i += size {
+			item, err := formatValue(kind, data[i:i+size])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+	}
+
+	return strings.Join(items, ", "), nil
+}
+
+// formatSID выводит SID в виде S-1-5-21-...
+func formatSID(data []byte) (string, error) {
+	if len(data) < 8 || len(data) < 8+int(data[1])*4 {
+		return "", fmt.Errorf("неверная длина SID: %d байт", len(data))
+	}
+
+	var authority uint64
+	for _, b := range data[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	sid := fmt.Sprintf("S-%d-%d", data[0], authority)
+	for i := 0; i < int(data[1]); i++ {
+		sid += "-" + strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data[8+i*4:])), 10)
+	}
+	return sid, nil
+}
+
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// escapeXML экранирует текст; управляющие символы, недопустимые в XML,
+// отбрасываются
+func escapeXML(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,262 @@
+// Package evtx читает файлы журналов Windows (.evtx) без Windows API:
+// заголовок файла, чанки по 64 КиБ и записи с двоичным XML (BinXML),
+// которые преобразуются в XML события.
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/parser"
+)
+
+// Размеры структур файла
+const (
+	fileHeaderSize   = 128
+	chunkSize        = 65536
+	chunkHeaderSize  = 512
+	recordHeaderSize = 24
+)
+
+var (
+	fileSignature   = []byte("ElfFile\x00")
+	chunkSignature  = []byte("ElfChnk\x00")
+	recordSignature = []byte("**\x00\x00")
+)
+
+var (
+	// ErrNotEVTX возвращается, если у файла нет заголовка EVTX
+	ErrNotEVTX = errors.New("не файл EVTX")
+	// ErrCorrupt - поврежденный чанк или запись; Reader пропускает их,
+	// и чтение можно продолжить
+	ErrCorrupt = errors.New("поврежденные данные EVTX")
+)
+
+// FileHeader - заголовок файла EVTX
+type FileHeader struct {
+	FirstChunk   uint64
+	LastChunk    uint64
+	NextRecordID uint64
+	MajorVersion uint16
+	MinorVersion uint16
+	Chunks       uint16
+	// Dirty - файл не был корректно закрыт, последние записи могут
+	// отсутствовать
+	Dirty bool
+}
+
+// Record - запись журнала
+type Record struct {
+	ID      uint64
+	Written time.Time
+	// XML - событие в том же виде, что выдает wevtutil qe /f:xml
+	XML string
+}
+
+// Event разбирает XML записи в структуру парсера XML
+func (r *Record) Event() (parser.Event, error) {
+	var event parser.Event
+	if err := xml.Unmarshal([]byte(r.XML), &event); err != nil {
+		return event, fmt.Errorf("запись %d: %w", r.ID, err)
+	}
+	return event, nil
+}
+
+// Reader последовательно читает записи EVTX. Файл читается потоком по
+// чанкам, поэтому подходит и stdin.
+type Reader struct {
+	r      io.Reader
+	header FileHeader
+	buf    []byte
+	index  int
+	chunk  *chunk
+	err    error
+}
+
+// NewReader читает заголовок файла
+func NewReader(r io.Reader) (*Reader, error) {
+	head := make([]byte, fileHeaderSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotEVTX, err)
+	}
+	if !bytes.Equal(head[:8], fileSignature) {
+		return nil, ErrNotEVTX
+	}
+
+	header := FileHeader{
+		FirstChunk:   binary.LittleEndian.Uint64(head[8:]),
+		LastChunk:    binary.LittleEndian.Uint64(head[16:]),
+		NextRecordID: binary.LittleEndian.Uint64(head[24:]),
+		MinorVersion: binary.LittleEndian.Uint16(head[36:]),
+		MajorVersion: binary.LittleEndian.Uint16(head[38:]),
+		Chunks:       binary.LittleEndian.Uint16(head[42:]),
+		Dirty:        binary.LittleEndian.Uint32(head[120:])&1 != 0,
+	}
+	if header.MajorVersion != 3 {
+		return nil, fmt.Errorf("%w: неподдерживаемая версия %d.%d", ErrNotEVTX, header.MajorVersion, header.MinorVersion)
+	}
+
+	// Заголовок занимает блок размером header block size (4096 байт)
+	blockSize := int64(binary.LittleEndian.Uint16(head[40:]))
+	if blockSize < fileHeaderSize {
+		return nil, fmt.Errorf("%w: размер заголовка %d", ErrNotEVTX, blockSize)
+	}
+	if _, err := io.CopyN(io.Discard, r, blockSize-fileHeaderSize); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotEVTX, err)
+	}
+
+	return &Reader{r: r, header: header, buf: make([]byte, chunkSize)}, nil
+}
+
+// Header возвращает заголовок файла
+func (r *Reader) Header() FileHeader {
+	return r.header
+}
+
+// Next возвращает следующую запись или io.EOF. Ошибка ErrCorrupt относится
+// к одному чанку или записи - следующий вызов Next продолжает чтение.
+func (r *Reader) Next() (*Record, error) {
+	for {
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		if r.chunk == nil {
+			if err := r.nextChunk(); err != nil {
+				return nil, err
+			}
+			if r.chunk == nil {
+				continue
+			}
+		}
+
+		record, err := r.chunk.next()
+		if err == io.EOF {
+			r.chunk = nil
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("чанк %d: %w", r.index-1, err)
+		}
+		return record, nil
+	}
+}
+
+// nextChunk читает следующий чанк; пустые (незаполненные) чанки
+// пропускаются
+func (r *Reader) nextChunk() error {
+	n, err := io.ReadFull(r.r, r.buf)
+	switch {
+	case err == io.EOF:
+		r.err = io.EOF
+		return r.err
+	case err == io.ErrUnexpectedEOF:
+		r.err = fmt.Errorf("%w: чанк %d обрезан (%d байт)", ErrCorrupt, r.index, n)
+		return r.err
+	case err != nil:
+		r.err = fmt.Errorf("ошибка чтения чанка %d: %w", r.index, err)
+		return r.err
+	}
+
+	index := r.index
+	r.index++
+
+	if !bytes.Equal(r.buf[:8], chunkSignature) {
+		if isZero(r.buf[:chunkHeaderSize]) {
+			return nil
+		}
+		return fmt.Errorf("%w: чанк %d без сигнатуры", ErrCorrupt, index)
+	}
+
+	c, err := newChunk(append([]byte(nil), r.buf...))
+	if err != nil {
+		return fmt.Errorf("чанк %d: %w", index, err)
+	}
+	r.chunk = c
+	return nil
+}
+
+// newChunk проверяет заголовок и контрольные суммы чанка
+func newChunk(data []byte) (*chunk, error) {
+	headerCRC := crc32.NewIEEE()
+	headerCRC.Write(data[:120])
+	headerCRC.Write(data[128:chunkHeaderSize])
+	if headerCRC.Sum32() != binary.LittleEndian.Uint32(data[124:]) {
+		return nil, fmt.Errorf("%w: неверная контрольная сумма заголовка", ErrCorrupt)
+	}
+
+	free := int(binary.LittleEndian.Uint32(data[48:]))
+	if free < chunkHeaderSize || free > len(data) {
+		return nil, fmt.Errorf("%w: неверное смещение конца записей %d", ErrCorrupt, free)
+	}
+	if crc32.ChecksumIEEE(data[chunkHeaderSize:free]) != binary.LittleEndian.Uint32(data[52:]) {
+		return nil, fmt.Errorf("%w: неверная контрольная сумма записей", ErrCorrupt)
+	}
+
+	return &chunk{
+		data:      data,
+		pos:       chunkHeaderSize,
+		end:       free,
+		names:     make(map[uint32]string),
+		templates: make(map[uint32][]node),
+	}, nil
+}
+
+// next возвращает следующую запись чанка или io.EOF
+func (c *chunk) next() (*Record, error) {
+	if c.pos+recordHeaderSize > c.end {
+		return nil, io.EOF
+	}
+
+	offset := c.pos
+	data := c.data[offset:c.end]
+	if !bytes.Equal(data[:4], recordSignature) {
+		c.pos = c.end
+		return nil, fmt.Errorf("%w: нет сигнатуры записи по смещению %d", ErrCorrupt, offset)
+	}
+
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size < recordHeaderSize+4 || size > len(data) || binary.LittleEndian.Uint32(data[size-4:]) != uint32(size) {
+		c.pos = c.end
+		return nil, fmt.Errorf("%w: неверный размер записи по смещению %d", ErrCorrupt, offset)
+	}
+	c.pos += size
+
+	record := &Record{
+		ID:      binary.LittleEndian.Uint64(data[8:]),
+		Written: filetime(binary.LittleEndian.Uint64(data[16:])),
+	}
+
+	xmlText, err := c.render(offset+recordHeaderSize, offset+size-4)
+	if err != nil {
+		return nil, fmt.Errorf("запись %d: %w: %v", record.ID, ErrCorrupt, err)
+	}
+	record.XML = xmlText
+
+	return record, nil
+}
+
+// filetime переводит FILETIME (100 нс с 1601-01-01) во время UTC
+func filetime(value uint64) time.Time {
+	const epochDelta = 116444736000000000
+	if value < epochDelta {
+		return time.Time{}
+	}
+	ticks := value - epochDelta
+	return time.Unix(int64(ticks/10000000), int64(ticks%10000000)*100).UTC()
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,252 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/parser"
+)
+
+func readAll(t *testing.T, r *Reader) ([]*Record, []error) {
+	t.Helper()
+
+	var records []*Record
+	var errs []error
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, errs
+		}
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("Next failed: %v", err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		records = append(records, record)
+	}
+}
+
+func TestReader_Records(t *testing.T) {
+	data, err := os.ReadFile("testdata/security.evtx")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if h := r.Header(); h.Chunks != 2 || h.MajorVersion != 3 || h.NextRecordID != 7 {
+		t.Errorf("Unexpected header %+v", h)
+	}
+
+	records, errs := readAll(t, r)
+	if len(errs) > 0 || len(records) != 6 {
+		t.Fatalf("Expected 6 records, got %d (errors: %v)", len(records), errs)
+	}
+	for i, record := range records {
+		if record.ID != uint64(i+1) {
+			t.Errorf("Expected record %d, got %d", i+1, record.ID)
+		}
+	}
+
+	// Шаблон, определенный в записи, и подстановки разных типов
+	logon, err := records[0].Event()
+	if err != nil {
+		t.Fatalf("Event failed: %v", err)
+	}
+	if logon.System.EventID != 4624 || logon.System.Keywords != "0x8020000000000000" {
+		t.Errorf("Unexpected system %+v", logon.System)
+	}
+	if logon.System.TimeCreated.SystemTime != "2025-10-11T22:14:15.1234567Z" {
+		t.Errorf("Unexpected TimeCreated %q", logon.System.TimeCreated.SystemTime)
+	}
+	if logon.System.Correlation.ActivityID != "{A1B2C3D4-0000-0000-0000-000000000001}" {
+		t.Errorf("Unexpected ActivityID %q", logon.System.Correlation.ActivityID)
+	}
+	fields := make(map[string]string)
+	for _, d := range logon.EventData.Data {
+		fields[d.Name] = d.Value
+	}
+	if fields["TargetUserSid"] != "S-1-5-21-1004336348-1177238915-682003330-1104" || fields["ProcessId"] != "0x2d4" {
+		t.Errorf("Unexpected event data %v", fields)
+	}
+
+	// Повторное использование шаблона; пустая необязательная подстановка
+	// убирает атрибут
+	again, _ := records[2].Event()
+	if again.System.EventID != 4624 || again.System.Correlation.ActivityID != "" {
+		t.Errorf("Unexpected reused template event %+v", again.System)
+	}
+
+	// Вложенный BinXML классического провайдера
+	service, _ := records[3].Event()
+	if len(service.EventData.Data) != 2 || service.EventData.Data[0].Value != "Windows Update" {
+		t.Errorf("Unexpected nested event data %+v", service.EventData)
+	}
+	if service.EventData.Binary != "777561757365727600" {
+		t.Errorf("Unexpected binary %q", service.EventData.Binary)
+	}
+
+	// Экранирование и второй чанк
+	if !strings.Contains(records[4].XML, `&quot;whoami &amp; net user&quot; &gt;`) {
+		t.Errorf("Expected escaped command line, got %s", records[4].XML)
+	}
+}
+
+func TestReader_XMLParserMapping(t *testing.T) {
+	file, err := os.Open("testdata/security.evtx")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer file.Close()
+
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	records, _ := readAll(t, r)
+
+	event, err := records[1].Event()
+	if err != nil {
+		t.Fatalf("Event failed: %v", err)
+	}
+
+	gost := parser.NewXMLParser().ConvertEvent(event)
+	if gost.Action != "logon_failed" || gost.Result != models.ResultFailure {
+		t.Errorf("Expected failed logon, got %s/%s", gost.Action, gost.Result)
+	}
+	if gost.SubjectAccount == nil || gost.SubjectAccount.Username != "admin" {
+		t.Errorf("Unexpected subject %+v", gost.SubjectAccount)
+	}
+	if gost.Source.IPAddress != "192.0.2.10" || gost.TimestampSynthesized {
+		t.Errorf("Unexpected source %+v", gost.Source)
+	}
+}
+
+func TestReader_CorruptChunk(t *testing.T) {
+	data, err := os.ReadFile("testdata/security.evtx")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// Повреждаем запись в первом чанке - он пропускается целиком
+	data[4096+chunkHeaderSize+100] ^= 0xff
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	records, errs := readAll(t, r)
+	if len(errs) != 1 {
+		t.Errorf("Expected 1 chunk error, got %v", errs)
+	}
+	if len(records) != 2 || records[0].ID != 5 {
+		t.Errorf("Expected records of the second chunk, got %d", len(records))
+	}
+
+	// Обрезанный файл
+	r, err = NewReader(bytes.NewReader(data[:4096+chunkSize+1000]))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if _, err := r.Next(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+	if _, err := r.Next(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for truncated chunk, got %v", err)
+	}
+
+	if _, err := NewReader(strings.NewReader("<Event/>")); !errors.Is(err, ErrNotEVTX) {
+		t.Errorf("Expected ErrNotEVTX, got %v", err)
+	}
+}
+
+// windowsExport - ожидаемое содержимое файла testdata/windows/<имя>.evtx,
+// экспортированного из журнала Windows (wevtutil epl или "Сохранить все
+// события как"). Ожидания записываются в <имя>.json по выводу
+// wevtutil qe <имя>.evtx /lf:true /f:xml на той же машине.
+type windowsExport struct {
+	Records int `json:"records"`
+	Events  []struct {
+		RecordID uint64            `json:"record_id"`
+		EventID  int               `json:"event_id"`
+		Provider string            `json:"provider"`
+		Data     map[string]string `json:"data"`
+	} `json:"events"`
+}
+
+func TestReader_WindowsExports(t *testing.T) {
+	// security.evtx создан generate.go из этого же пакета, поэтому общую
+	// ошибку чтения формата он не выявит. Файлы из Windows проверяют
+	// чтение чанков, таблицы строк и шаблонов независимо от генератора.
+	files, _ := filepath.Glob("testdata/windows/*.evtx")
+	if len(files) == 0 {
+		t.Skip("нет файлов, экспортированных из Windows, в testdata/windows")
+	}
+
+	for _, path := range files {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(strings.TrimSuffix(path, ".evtx") + ".json")
+			if err != nil {
+				t.Fatalf("Expected file with expected events: %v", err)
+			}
+			var want windowsExport
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer file.Close()
+			r, err := NewReader(file)
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+			records, errs := readAll(t, r)
+			if len(errs) > 0 || len(records) != want.Records {
+				t.Fatalf("Expected %d records, got %d (errors: %v)", want.Records, len(records), errs)
+			}
+
+			byID := make(map[uint64]*Record, len(records))
+			for _, record := range records {
+				byID[record.ID] = record
+			}
+			for _, expected := range want.Events {
+				record, ok := byID[expected.RecordID]
+				if !ok {
+					t.Errorf("Record %d not found", expected.RecordID)
+					continue
+				}
+				event, err := record.Event()
+				if err != nil {
+					t.Errorf("Event failed: %v", err)
+					continue
+				}
+				if event.System.EventID != expected.EventID || event.System.Provider.Name != expected.Provider {
+					t.Errorf("Record %d: unexpected system %+v", expected.RecordID, event.System)
+				}
+				fields := make(map[string]string)
+				for _, d := range event.EventData.Data {
+					fields[d.Name] = d.Value
+				}
+				for name, value := range expected.Data {
+					if fields[name] != value {
+						t.Errorf("Record %d: expected %s=%q, got %q", expected.RecordID, name, value, fields[name])
+					}
+				}
+			}
+		})
+	}
+}
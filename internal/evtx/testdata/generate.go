@@ -0,0 +1,544 @@
+//go:build ignore
+
+// generate создает security.evtx - образец журнала для тестов пакета evtx.
+// Структура файла повторяет журналы Windows: заголовок 4096 байт, чанки по
+// 64 КиБ, шаблоны BinXML с подстановками, определенные при первом
+// использовании в чанке, вложенный BinXML классических провайдеров.
+//
+//	go run generate.go
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash/crc32"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	chunkSize       = 65536
+	chunkHeaderSize = 512
+)
+
+// Узлы шаблона
+type (
+	el struct {
+		name     string
+		attrs    []at
+		children []interface{}
+	}
+	at struct {
+		name  string
+		value interface{}
+	}
+	txt string
+	sub struct {
+		index    int
+		typ      byte
+		optional bool
+	}
+)
+
+// val - значение подстановки; frag - вложенный фрагмент BinXML
+type val struct {
+	typ  byte
+	data []byte
+	frag *fragment
+}
+
+type fragment struct {
+	key    string
+	tmpl   *el
+	values []val
+}
+
+type chunkWriter struct {
+	buf       []byte
+	pos       int
+	names     map[string]uint32
+	templates map[string]uint32
+	first     uint64
+	last      uint64
+	lastPos   int
+}
+
+func newChunk() *chunkWriter {
+	return &chunkWriter{
+		buf:       make([]byte, chunkSize),
+		pos:       chunkHeaderSize,
+		names:     make(map[string]uint32),
+		templates: make(map[string]uint32),
+	}
+}
+
+func (w *chunkWriter) u8(v byte) { w.buf[w.pos] = v; w.pos++ }
+func (w *chunkWriter) u16(v uint16) {
+	binary.LittleEndian.PutUint16(w.buf[w.pos:], v)
+	w.pos += 2
+}
+func (w *chunkWriter) u32(v uint32) {
+	binary.LittleEndian.PutUint32(w.buf[w.pos:], v)
+	w.pos += 4
+}
+func (w *chunkWriter) u64(v uint64) {
+	binary.LittleEndian.PutUint64(w.buf[w.pos:], v)
+	w.pos += 8
+}
+func (w *chunkWriter) bytes(b []byte) { w.pos += copy(w.buf[w.pos:], b) }
+
+func (w *chunkWriter) patch32(at int, v uint32) {
+	binary.LittleEndian.PutUint32(w.buf[at:], v)
+}
+
+// nameRef записывает ссылку на имя; при первом использовании имя
+// записывается сразу за ссылкой
+func (w *chunkWriter) nameRef(name string) {
+	if offset, ok := w.names[name]; ok {
+		w.u32(offset)
+		return
+	}
+
+	offset := uint32(w.pos + 4)
+	w.names[name] = offset
+	w.u32(offset)
+
+	units := utf16.Encode([]rune(name))
+	var hash uint32
+	for _, u := range units {
+		hash = hash*65599 + uint32(u)
+	}
+	w.u32(0)
+	w.u16(uint16(hash))
+	w.u16(uint16(len(units)))
+	for _, u := range units {
+		w.u16(u)
+	}
+	w.u16(0)
+}
+
+func (w *chunkWriter) node(n interface{}) {
+	switch n := n.(type) {
+	case *el:
+		w.element(n)
+	case txt:
+		units := utf16.Encode([]rune(string(n)))
+		w.u8(0x05)
+		w.u8(0x01)
+		w.u16(uint16(len(units)))
+		for _, u := range units {
+			w.u16(u)
+		}
+	case sub:
+		if n.optional {
+			w.u8(0x0e)
+		} else {
+			w.u8(0x0d)
+		}
+		w.u16(uint16(n.index))
+		w.u8(n.typ)
+	}
+}
+
+func (w *chunkWriter) element(e *el) {
+	token := byte(0x01)
+	if len(e.attrs) > 0 {
+		token |= 0x40
+	}
+	w.u8(token)
+	w.u16(0xffff)
+	sizeAt := w.pos
+	w.u32(0)
+	w.nameRef(e.name)
+
+	if len(e.attrs) > 0 {
+		listAt := w.pos
+		w.u32(0)
+		for i, a := range e.attrs {
+			token := byte(0x06)
+			if i < len(e.attrs)-1 {
+				token |= 0x40
+			}
+			w.u8(token)
+			w.nameRef(a.name)
+			w.node(a.value)
+		}
+		w.patch32(listAt, uint32(w.pos-listAt-4))
+	}
+
+	if len(e.children) == 0 {
+		w.u8(0x03)
+	} else {
+		w.u8(0x02)
+		for _, c := range e.children {
+			w.node(c)
+		}
+		w.u8(0x04)
+	}
+	w.patch32(sizeAt, uint32(w.pos-sizeAt-4))
+}
+
+// instance записывает экземпляр шаблона; определение шаблона записывается
+// при первом использовании в чанке
+func (w *chunkWriter) instance(f *fragment) {
+	w.u8(0x0c)
+	w.u8(0x01)
+	sum := md5.Sum([]byte(f.key))
+	w.u32(binary.LittleEndian.Uint32(sum[:]))
+
+	if offset, ok := w.templates[f.key]; ok {
+		w.u32(offset)
+	} else {
+		offset := uint32(w.pos + 4)
+		w.templates[f.key] = offset
+		w.u32(offset)
+		w.u32(0)
+		w.bytes(sum[:])
+		sizeAt := w.pos
+		w.u32(0)
+		w.bytes([]byte{0x0f, 0x01, 0x01, 0x00})
+		w.element(f.tmpl)
+		w.u8(0x00)
+		w.patch32(sizeAt, uint32(w.pos-sizeAt-4))
+	}
+
+	w.u32(uint32(len(f.values)))
+	descAt := w.pos
+	for _, v := range f.values {
+		w.u16(uint16(len(v.data)))
+		w.u8(v.typ)
+		w.u8(0)
+	}
+	for i, v := range f.values {
+		start := w.pos
+		if v.frag != nil {
+			w.bytes([]byte{0x0f, 0x01, 0x01, 0x00})
+			w.instance(v.frag)
+			w.u8(0x00)
+		} else {
+			w.bytes(v.data)
+		}
+		binary.LittleEndian.PutUint16(w.buf[descAt+i*4:], uint16(w.pos-start))
+	}
+}
+
+func (w *chunkWriter) record(id uint64, written time.Time, f *fragment) {
+	if w.first == 0 {
+		w.first = id
+	}
+	w.last = id
+	w.lastPos = w.pos
+
+	start := w.pos
+	w.bytes([]byte("**\x00\x00"))
+	w.u32(0)
+	w.u64(id)
+	w.u64(filetime(written))
+	w.bytes([]byte{0x0f, 0x01, 0x01, 0x00})
+	w.instance(f)
+	w.u8(0x00)
+	size := uint32(w.pos - start + 4)
+	w.u32(size)
+	w.patch32(start+4, size)
+}
+
+func (w *chunkWriter) finish() []byte {
+	h := w.buf
+	copy(h, "ElfChnk\x00")
+	binary.LittleEndian.PutUint64(h[8:], w.first)
+	binary.LittleEndian.PutUint64(h[16:], w.last)
+	binary.LittleEndian.PutUint64(h[24:], w.first)
+	binary.LittleEndian.PutUint64(h[32:], w.last)
+	binary.LittleEndian.PutUint32(h[40:], 128)
+	binary.LittleEndian.PutUint32(h[44:], uint32(w.lastPos))
+	binary.LittleEndian.PutUint32(h[48:], uint32(w.pos))
+	binary.LittleEndian.PutUint32(h[52:], crc32.ChecksumIEEE(h[chunkHeaderSize:w.pos]))
+
+	crc := crc32.NewIEEE()
+	crc.Write(h[:120])
+	crc.Write(h[128:chunkHeaderSize])
+	binary.LittleEndian.PutUint32(h[124:], crc.Sum32())
+	return h
+}
+
+// Значения подстановок
+
+func str(s string) val {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return val{typ: 0x01, data: b}
+}
+
+func u8(v byte) val { return val{typ: 0x04, data: []byte{v}} }
+func u16(v uint16) val {
+	return val{typ: 0x06, data: binary.LittleEndian.AppendUint16(nil, v)}
+}
+func u32(v uint32) val {
+	return val{typ: 0x08, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+func u64(v uint64) val {
+	return val{typ: 0x0a, data: binary.LittleEndian.AppendUint64(nil, v)}
+}
+func hex32(v uint32) val {
+	return val{typ: 0x14, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+func hex64(v uint64) val {
+	return val{typ: 0x15, data: binary.LittleEndian.AppendUint64(nil, v)}
+}
+func null() val              { return val{typ: 0x00} }
+func binaryVal(b []byte) val { return val{typ: 0x0e, data: b} }
+func nested(f *fragment) val { return val{typ: 0x21, frag: f} }
+
+func ftime(t time.Time) val {
+	return val{typ: 0x11, data: binary.LittleEndian.AppendUint64(nil, filetime(t))}
+}
+
+func guid(s string) val {
+	s = strings.NewReplacer("{", "", "}", "", "-", "").Replace(s)
+	parse := func(hex string) uint64 {
+		v, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return v
+	}
+	b := binary.LittleEndian.AppendUint32(nil, uint32(parse(s[0:8])))
+	b = binary.LittleEndian.AppendUint16(b, uint16(parse(s[8:12])))
+	b = binary.LittleEndian.AppendUint16(b, uint16(parse(s[12:16])))
+	for i := 16; i < 32; i += 2 {
+		b = append(b, byte(parse(s[i:i+2])))
+	}
+	return val{typ: 0x0f, data: b}
+}
+
+func sid(s string) val {
+	parts := strings.Split(s, "-")[1:]
+	num := func(p string) uint64 {
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return v
+	}
+	authority := num(parts[1])
+	b := []byte{byte(num(parts[0])), byte(len(parts) - 2), 0, 0,
+		byte(authority >> 24), byte(authority >> 16), byte(authority >> 8), byte(authority)}
+	for _, p := range parts[2:] {
+		b = binary.LittleEndian.AppendUint32(b, uint32(num(p)))
+	}
+	return val{typ: 0x13, data: b}
+}
+
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+// Шаблоны
+
+// systemTemplate - Event/System как в журналах Windows; eventData
+// получает подстановки начиная с 17
+func systemTemplate(eventData ...interface{}) *el {
+	s := func(i int, typ byte) sub { return sub{index: i, typ: typ} }
+	opt := func(i int, typ byte) sub { return sub{index: i, typ: typ, optional: true} }
+	leaf := func(name string, v interface{}) *el { return &el{name: name, children: []interface{}{v}} }
+
+	system := &el{name: "System", children: []interface{}{
+		&el{name: "Provider", attrs: []at{{"Name", s(0, 0x01)}, {"Guid", opt(1, 0x0f)}}},
+		leaf("EventID", s(2, 0x06)),
+		leaf("Version", s(3, 0x04)),
+		leaf("Level", s(4, 0x04)),
+		leaf("Task", s(5, 0x06)),
+		leaf("Opcode", s(6, 0x04)),
+		leaf("Keywords", s(7, 0x15)),
+		&el{name: "TimeCreated", attrs: []at{{"SystemTime", s(8, 0x11)}}},
+		leaf("EventRecordID", s(9, 0x0a)),
+		&el{name: "Correlation", attrs: []at{{"ActivityID", opt(10, 0x0f)}, {"RelatedActivityID", opt(11, 0x0f)}}},
+		&el{name: "Execution", attrs: []at{{"ProcessID", s(12, 0x08)}, {"ThreadID", s(13, 0x08)}}},
+		leaf("Channel", s(14, 0x01)),
+		leaf("Computer", s(15, 0x01)),
+		&el{name: "Security", attrs: []at{{"UserID", opt(16, 0x13)}}},
+	}}
+
+	return &el{
+		name:     "Event",
+		attrs:    []at{{"xmlns", txt("http://schemas.microsoft.com/win/2004/08/events/event")}},
+		children: append([]interface{}{system}, eventData...),
+	}
+}
+
+// dataTemplate - EventData с именованными Data и подстановками с index
+type field struct {
+	name string
+	typ  byte
+}
+
+func dataElement(first int, fields []field) *el {
+	data := &el{name: "EventData"}
+	for i, f := range fields {
+		data.children = append(data.children, &el{
+			name:     "Data",
+			attrs:    []at{{"Name", txt(f.name)}},
+			children: []interface{}{sub{index: first + i, typ: f.typ, optional: true}},
+		})
+	}
+	return data
+}
+
+type system struct {
+	provider, guid    string
+	eventID           uint16
+	level, opcode     byte
+	task              uint16
+	keywords          uint64
+	created           time.Time
+	recordID          uint64
+	activity          string
+	pid, tid          uint32
+	channel, computer string
+	userID            string
+}
+
+func (s system) values() []val {
+	optGUID := func(g string) val {
+		if g == "" {
+			return null()
+		}
+		return guid(g)
+	}
+	userID := null()
+	if s.userID != "" {
+		userID = sid(s.userID)
+	}
+	return []val{
+		str(s.provider), optGUID(s.guid), u16(s.eventID), u8(0), u8(s.level), u16(s.task), u8(s.opcode),
+		hex64(s.keywords), ftime(s.created), u64(s.recordID), optGUID(s.activity), null(),
+		u32(s.pid), u32(s.tid), str(s.channel), str(s.computer), userID,
+	}
+}
+
+func main() {
+	securityGUID := "{54849625-5478-4994-A5BA-3E3B0328C30D}"
+	base := time.Date(2025, 10, 11, 22, 14, 15, 123456700, time.UTC)
+
+	logonFields := []field{
+		{"SubjectUserSid", 0x13}, {"SubjectUserName", 0x01}, {"SubjectDomainName", 0x01}, {"SubjectLogonId", 0x15},
+		{"TargetUserSid", 0x13}, {"TargetUserName", 0x01}, {"TargetDomainName", 0x01}, {"TargetLogonId", 0x15},
+		{"LogonType", 0x08}, {"LogonProcessName", 0x01}, {"AuthenticationPackageName", 0x01},
+		{"WorkstationName", 0x01}, {"LogonGuid", 0x0f}, {"IpAddress", 0x01}, {"IpPort", 0x01},
+		{"ProcessId", 0x15}, {"ProcessName", 0x01},
+	}
+	failedFields := []field{
+		{"SubjectUserSid", 0x13}, {"SubjectUserName", 0x01}, {"SubjectDomainName", 0x01}, {"SubjectLogonId", 0x15},
+		{"TargetUserSid", 0x13}, {"TargetUserName", 0x01}, {"TargetDomainName", 0x01},
+		{"Status", 0x14}, {"FailureReason", 0x01}, {"SubStatus", 0x14}, {"LogonType", 0x08},
+		{"WorkstationName", 0x01}, {"IpAddress", 0x01}, {"IpPort", 0x01},
+	}
+	sysmonProcessFields := []field{
+		{"UtcTime", 0x01}, {"ProcessGuid", 0x0f}, {"ProcessId", 0x08}, {"Image", 0x01},
+		{"CommandLine", 0x01}, {"CurrentDirectory", 0x01}, {"User", 0x01}, {"Hashes", 0x01},
+		{"ParentImage", 0x01},
+	}
+	sysmonNetworkFields := []field{
+		{"UtcTime", 0x01}, {"ProcessId", 0x08}, {"Image", 0x01}, {"User", 0x01}, {"Protocol", 0x01},
+		{"SourceIp", 0x01}, {"SourcePort", 0x06}, {"DestinationIp", 0x01}, {"DestinationPort", 0x06},
+	}
+
+	logon := systemTemplate(dataElement(17, logonFields))
+	failed := systemTemplate(dataElement(17, failedFields))
+	classic := systemTemplate(sub{index: 17, typ: 0x21, optional: true})
+	serviceData := &el{name: "EventData", children: []interface{}{
+		&el{name: "Data", attrs: []at{{"Name", txt("param1")}}, children: []interface{}{sub{index: 0, typ: 0x01}}},
+		&el{name: "Data", attrs: []at{{"Name", txt("param2")}}, children: []interface{}{sub{index: 1, typ: 0x01}}},
+		&el{name: "Binary", children: []interface{}{sub{index: 2, typ: 0x0e, optional: true}}},
+	}}
+	sysmonProcess := systemTemplate(dataElement(17, sysmonProcessFields))
+	sysmonNetwork := systemTemplate(dataElement(17, sysmonNetworkFields))
+
+	first := newChunk()
+
+	sys := system{provider: "Microsoft-Windows-Security-Auditing", guid: securityGUID, eventID: 4624, task: 12544,
+		keywords: 0x8020000000000000, created: base, recordID: 1, activity: "{A1B2C3D4-0000-0000-0000-000000000001}",
+		pid: 636, tid: 700, channel: "Security", computer: "dc01.example.com"}
+	first.record(1, base, &fragment{key: "4624", tmpl: logon, values: append(sys.values(),
+		sid("S-1-5-18"), str("DC01$"), str("EXAMPLE"), hex64(0x3e7),
+		sid("S-1-5-21-1004336348-1177238915-682003330-1104"), str("john.doe"), str("EXAMPLE"), hex64(0x1f2a3b),
+		u32(10), str("User32 "), str("Negotiate"), str("WS01"), guid("{00000000-0000-0000-0000-000000000000}"),
+		str("10.0.0.15"), str("51234"), hex64(0x2d4), str(`C:\Windows\System32\svchost.exe`),
+	)})
+
+	sys.eventID, sys.recordID, sys.keywords = 4625, 2, 0x8010000000000000
+	sys.created = base.Add(time.Second)
+	first.record(2, sys.created, &fragment{key: "4625", tmpl: failed, values: append(sys.values(),
+		sid("S-1-0-0"), str("-"), str("-"), hex64(0),
+		sid("S-1-0-0"), str("admin"), str("EXAMPLE"),
+		hex32(0xc000006d), str("%%2313"), hex32(0xc000006a), u32(3),
+		str("ATTACKER"), str("192.0.2.10"), str("0"),
+	)})
+
+	// Повторное использование шаблона из того же чанка
+	sys.eventID, sys.recordID, sys.keywords, sys.activity = 4624, 3, 0x8020000000000000, ""
+	sys.created = base.Add(2 * time.Second)
+	first.record(3, sys.created, &fragment{key: "4624", tmpl: logon, values: append(sys.values(),
+		sid("S-1-5-18"), str("DC01$"), str("EXAMPLE"), hex64(0x3e7),
+		sid("S-1-5-21-1004336348-1177238915-682003330-1105"), str("anna.petrova"), str("EXAMPLE"), hex64(0x1f2a3c),
+		u32(3), str("NtLmSsp "), str("NTLM"), str("WS02"), guid("{00000000-0000-0000-0000-000000000000}"),
+		str("10.0.0.16"), str("51240"), hex64(0), str("-"),
+	)})
+
+	// Классический провайдер: EventData - вложенный BinXML
+	service := system{provider: "Service Control Manager", eventID: 7036, keywords: 0x8080000000000000,
+		created: base.Add(3 * time.Second), recordID: 4, pid: 788, tid: 4120, channel: "System",
+		computer: "srv01.example.com"}
+	first.record(4, service.created, &fragment{key: "7036", tmpl: classic, values: append(service.values(),
+		nested(&fragment{key: "7036-data", tmpl: serviceData, values: []val{
+			str("Windows Update"), str("running"), binaryVal([]byte("wuauserv\x00")),
+		}}),
+	)})
+
+	second := newChunk()
+
+	sysmon := system{provider: "Microsoft-Windows-Sysmon", guid: "{5770385F-C22A-43E0-BF4C-06F5698FFBD9}",
+		eventID: 1, level: 4, task: 1, opcode: 0, keywords: 0x8000000000000000, created: base.Add(4 * time.Second),
+		recordID: 5, pid: 2956, tid: 3412, channel: "Microsoft-Windows-Sysmon/Operational",
+		computer: "ws01.example.com", userID: "S-1-5-18"}
+	second.record(5, sysmon.created, &fragment{key: "sysmon-1", tmpl: sysmonProcess, values: append(sysmon.values(),
+		str("2025-10-11 22:14:19.123"), guid("{6B3F2A10-1C2D-4E5F-8091-A2B3C4D5E6F7}"), u32(4242),
+		str(`C:\Windows\System32\cmd.exe`), str(`cmd.exe /c "whoami & net user" > C:\Temp\out.txt`),
+		str(`C:\Users\alice\`), str(`EXAMPLE\alice`), str("SHA256=0123456789ABCDEF"), str(`C:\Windows\explorer.exe`),
+	)})
+
+	sysmon.eventID, sysmon.task, sysmon.recordID = 3, 3, 6
+	sysmon.created = base.Add(5 * time.Second)
+	second.record(6, sysmon.created, &fragment{key: "sysmon-3", tmpl: sysmonNetwork, values: append(sysmon.values(),
+		str("2025-10-11 22:14:20.456"), u32(4242), str(`C:\Windows\System32\cmd.exe`), str(`EXAMPLE\alice`),
+		str("tcp"), str("10.0.0.21"), u16(49822), str("203.0.113.5"), u16(443),
+	)})
+
+	chunks := [][]byte{first.finish(), second.finish()}
+
+	header := make([]byte, 4096)
+	copy(header, "ElfFile\x00")
+	binary.LittleEndian.PutUint64(header[8:], 0)
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(chunks)-1))
+	binary.LittleEndian.PutUint64(header[24:], 7)
+	binary.LittleEndian.PutUint32(header[32:], 128)
+	binary.LittleEndian.PutUint16(header[36:], 2)
+	binary.LittleEndian.PutUint16(header[38:], 3)
+	binary.LittleEndian.PutUint16(header[40:], 4096)
+	binary.LittleEndian.PutUint16(header[42:], uint16(len(chunks)))
+	binary.LittleEndian.PutUint32(header[124:], crc32.ChecksumIEEE(header[:120]))
+
+	out := header
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	if err := os.WriteFile("security.evtx", out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
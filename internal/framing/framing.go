@@ -0,0 +1,149 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidFrame возвращается при нарушении формата octet-counting кадра
+var ErrInvalidFrame = errors.New("неверный формат кадра octet-counting")
+
+// maxLengthDigits ограничивает длину префикса MSG-LEN
+const maxLengthDigits = 10
+
+// OctetCounting - bufio.SplitFunc для кадров "MSG-LEN SP SYSLOG-MSG"
+// (RFC 5425, RFC 6587 раздел 3.4.1)
+func OctetCounting(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	sp := bytes.IndexByte(data, ' ')
+	if sp < 0 {
+		if len(data) > maxLengthDigits || atEOF {
+			return 0, nil, ErrInvalidFrame
+		}
+		return 0, nil, nil
+	}
+	if sp == 0 || sp > maxLengthDigits {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	length, convErr := strconv.Atoi(string(data[:sp]))
+	if convErr != nil || length <= 0 {
+		return 0, nil, ErrInvalidFrame
+	}
+
+	end := sp + 1 + length
+	if len(data) < end {
+		if atEOF {
+			return 0, nil, ErrInvalidFrame
+		}
+		return 0, nil, nil
+	}
+
+	return end, data[sp+1 : end], nil
+}
+
+// NonTransparent - bufio.SplitFunc для кадров, завершающихся LF или NUL
+// (RFC 6587 раздел 3.4.2). Завершающий CR отбрасывается.
+func NonTransparent(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\n\x00"); i >= 0 {
+		return i + 1, bytes.TrimSuffix(data[:i], []byte("\r")), nil
+	}
+
+	if atEOF {
+		return len(data), bytes.TrimSuffix(data, []byte("\r")), nil
+	}
+	return 0, nil, nil
+}
+
+// Auto определяет способ кадрирования по началу каждого кадра: префикс
+// "MSG-LEN SP <" - octet-counting, иначе - non-transparent (RFC 6587
+// раздел 3.4). Строки, начинающиеся с цифр (IP-адрес, метка времени), не
+// принимаются за префикс длины.
+func Auto(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return autoSplit(data, atEOF, 0)
+}
+
+// AutoLimit - Auto, в котором префикс с длиной больше maxLength также
+// считается началом обычной строки
+func AutoLimit(maxLength int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		return autoSplit(data, atEOF, maxLength)
+	}
+}
+
+// Split возвращает функцию кадрирования по имени: auto, octet-counting,
+// non-transparent. maxLength ограничивает длину кадра для auto (0 - без
+// ограничения).
+func Split(name string, maxLength int) (bufio.SplitFunc, error) {
+	switch name {
+	case "", "auto":
+		return AutoLimit(maxLength), nil
+	case "octet-counting":
+		return OctetCounting, nil
+	case "non-transparent":
+		return NonTransparent, nil
+	}
+	return nil, fmt.Errorf("неизвестное кадрирование: %s", name)
+}
+
+func autoSplit(data []byte, atEOF bool, maxLength int) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	switch octetPrefix(data, atEOF, maxLength) {
+	case prefixValid:
+		return OctetCounting(data, atEOF)
+	case prefixIncomplete:
+		return 0, nil, nil
+	}
+	return NonTransparent(data, atEOF)
+}
+
+// Результаты проверки префикса octet-counting
+const (
+	prefixInvalid = iota
+	prefixValid
+	prefixIncomplete
+)
+
+// octetPrefix проверяет, начинается ли data с "MSG-LEN SP <": длина без
+// ведущих нулей, в пределах maxLength, за ней PRI syslog сообщения
+func octetPrefix(data []byte, atEOF bool, maxLength int) int {
+	if data[0] < '1' || data[0] > '9' {
+		return prefixInvalid
+	}
+
+	sp := 0
+	for sp < len(data) && data[sp] >= '0' && data[sp] <= '9' {
+		sp++
+	}
+	if sp > maxLengthDigits {
+		return prefixInvalid
+	}
+	if sp+1 >= len(data) {
+		if atEOF {
+			return prefixInvalid
+		}
+		return prefixIncomplete
+	}
+	if data[sp] != ' ' || data[sp+1] != '<' {
+		return prefixInvalid
+	}
+
+	length, err := strconv.Atoi(string(data[:sp]))
+	if err != nil || (maxLength > 0 && length > maxLength) {
+		return prefixInvalid
+	}
+	return prefixValid
+}
@@ -0,0 +1,200 @@
+package framing
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func scanAll(t *testing.T, input string, split bufio.SplitFunc) ([]string, error) {
+	t.Helper()
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Split(split)
+
+	var frames []string
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+	return frames, scanner.Err()
+}
+
+func TestOctetCounting(t *testing.T) {
+	input := "11 <13>a\nb c d5 <14>x"
+
+	frames, err := scanAll(t, input, OctetCounting)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(frames) != 2 || frames[0] != "<13>a\nb c d" || frames[1] != "<14>x" {
+		t.Errorf("Unexpected frames: %q", frames)
+	}
+}
+
+func TestOctetCounting_Truncated(t *testing.T) {
+	if _, err := scanAll(t, "20 <13>short", OctetCounting); err != ErrInvalidFrame {
+		t.Errorf("Expected ErrInvalidFrame, got %v", err)
+	}
+}
+
+func TestNonTransparent(t *testing.T) {
+	frames, err := scanAll(t, "<13>first\r\n<14>second\x00<15>last", NonTransparent)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	expected := []string{"<13>first", "<14>second", "<15>last"}
+	if strings.Join(frames, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, frames)
+	}
+}
+
+func TestAuto_MixedFraming(t *testing.T) {
+	frames, err := scanAll(t, "9 <13>a b c<14>plain\n", Auto)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(frames) != 2 || frames[0] != "<13>a b c" || frames[1] != "<14>plain" {
+		t.Errorf("Unexpected frames: %q", frames)
+	}
+}
+
+func TestAuto_DigitLines(t *testing.T) {
+	// Строки с IP-адресом или меткой времени в начале - не префикс длины
+	input := "10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] \"GET / HTTP/1.1\" 200 612\n" +
+		"2025-10-11 22:14:15 INFO started\n" +
+		"2025 <13>a b\n" +
+		"9 <13>a b c"
+
+	frames, err := scanAll(t, input, AutoLimit(100))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	expected := []string{
+		"10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] \"GET / HTTP/1.1\" 200 612",
+		"2025-10-11 22:14:15 INFO started",
+		"2025 <13>a b",
+		"<13>a b c",
+	}
+	if strings.Join(frames, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, frames)
+	}
+
+	if _, err := Split("newline", 0); err == nil {
+		t.Error("Expected error for unknown framing")
+	}
+}
+
+func readAll(t *testing.T, input string, cfg ReaderConfig) []Record {
+	t.Helper()
+	reader, err := NewReader(strings.NewReader(input), cfg)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+
+	var records []Record
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestReader_Newline(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	records := readAll(t, "first\r\n"+long+"\n\nlast", ReaderConfig{MaxSize: 50})
+
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %+v", records)
+	}
+	if records[0].Text != "first" || records[2].Text != "" || records[3].Text != "last" || records[3].Line != 4 {
+		t.Errorf("Unexpected records %+v", records)
+	}
+	// Длинная строка пропускается, чтение продолжается
+	if !errors.Is(records[1].Err, ErrRecordTooLarge) || records[1].Line != 2 || records[1].Text != "" {
+		t.Errorf("Expected ErrRecordTooLarge for line 2, got %+v", records[1])
+	}
+}
+
+func TestReader_XML(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<Events>
+<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <EventID>4624</EventID>
+  </System>
+  <EventData><Data Name="TargetUserName">alice</Data></EventData>
+</Event><Event><System><EventID>4625</EventID></System></Event>
+</Events>`
+
+	records := readAll(t, input, ReaderConfig{Mode: ModeXML})
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %+v", records)
+	}
+	if !strings.HasPrefix(records[0].Text, "<Event xmlns=") || !strings.HasSuffix(records[0].Text, "</EventData>\n</Event>") || records[0].Line != 3 {
+		t.Errorf("Unexpected first record %+v", records[0])
+	}
+	if records[1].Text != "<Event><System><EventID>4625</EventID></System></Event>" || records[1].Line != 8 {
+		t.Errorf("Unexpected second record %+v", records[1])
+	}
+
+	records = readAll(t, "<Event>"+strings.Repeat("x", 100)+"</Event><Event>ok</Event><Event>", ReaderConfig{Mode: ModeXML, MaxSize: 50})
+	if len(records) != 3 || !errors.Is(records[0].Err, ErrRecordTooLarge) || records[1].Text != "<Event>ok</Event>" || records[2].Err == nil {
+		t.Errorf("Unexpected records %+v", records)
+	}
+}
+
+func TestReader_Regex(t *testing.T) {
+	input := "orphan\n" +
+		"2025-10-11 22:14:15 ERROR failed\n" +
+		"java.lang.IllegalStateException: boom\n" +
+		"\tat com.example.App.run(App.java:42)\n" +
+		"2025-10-11 22:14:16 INFO done\n"
+
+	cfg := ReaderConfig{Mode: ModeRegex, Start: regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `)}
+	records := readAll(t, input, cfg)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %+v", records)
+	}
+	if records[0].Text != "orphan" || records[2].Text != "2025-10-11 22:14:16 INFO done" || records[2].Line != 5 {
+		t.Errorf("Unexpected records %+v", records)
+	}
+	if !strings.HasSuffix(records[1].Text, "boom\n\tat com.example.App.run(App.java:42)") || records[1].Line != 2 {
+		t.Errorf("Unexpected stack trace record %q", records[1].Text)
+	}
+
+	cfg.MaxSize = 40
+	records = readAll(t, input, cfg)
+	if len(records) != 3 || !errors.Is(records[1].Err, ErrRecordTooLarge) || records[2].Err != nil {
+		t.Errorf("Unexpected records %+v", records)
+	}
+
+	if _, err := NewReader(strings.NewReader(""), ReaderConfig{Mode: ModeRegex}); err == nil {
+		t.Error("Expected error without start expression")
+	}
+}
+
+func TestReader_Octet(t *testing.T) {
+	records := readAll(t, "11 <13>a\nb c d\n12 <14>too long5 <15>x", ReaderConfig{Mode: ModeOctet, MaxSize: 11})
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %+v", records)
+	}
+	if records[0].Text != "<13>a\nb c d" || !errors.Is(records[1].Err, ErrRecordTooLarge) || records[2].Text != "<15>x" || records[2].Line != 3 {
+		t.Errorf("Unexpected records %+v", records)
+	}
+
+	reader, _ := NewReader(strings.NewReader("x <13>a"), ReaderConfig{Mode: ModeOctet})
+	if _, err := reader.Next(); err != ErrInvalidFrame {
+		t.Errorf("Expected ErrInvalidFrame, got %v", err)
+	}
+}
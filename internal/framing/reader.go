@@ -0,0 +1,323 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// ErrRecordTooLarge - запись длиннее MaxSize; она пропускается целиком,
+// чтение продолжается со следующей записи
+var ErrRecordTooLarge = errors.New("запись превышает максимальный размер")
+
+// DefaultMaxRecordSize - максимальный размер записи по умолчанию
+const DefaultMaxRecordSize = 1 << 20
+
+// DefaultXMLElement - элемент записи ModeXML по умолчанию
+const DefaultXMLElement = "Event"
+
+// Mode - способ выделения записей во входном потоке
+type Mode int
+
+const (
+	// ModeNewline - запись на каждую строку
+	ModeNewline Mode = iota
+	// ModeXML - элемент XML (<Event>...</Event>), занимающий любое число
+	// строк; текст вне элементов пропускается
+	ModeXML
+	// ModeRegex - запись начинается строкой, совпадающей с выражением Start;
+	// остальные строки (например, стек вызовов) присоединяются к ней
+	ModeRegex
+	// ModeOctet - кадры octet-counting "MSG-LEN SP MSG"
+	ModeOctet
+)
+
+// ParseMode разбирает имя способа: newline, xml, regex, octet
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "newline":
+		return ModeNewline, nil
+	case "xml":
+		return ModeXML, nil
+	case "regex":
+		return ModeRegex, nil
+	case "octet":
+		return ModeOctet, nil
+	}
+	return ModeNewline, fmt.Errorf("неизвестный способ кадрирования: %s", name)
+}
+
+// ReaderConfig - параметры Reader
+type ReaderConfig struct {
+	Mode Mode
+	// Element - имя элемента ModeXML (по умолчанию DefaultXMLElement)
+	Element string
+	// Start - выражение начала записи ModeRegex
+	Start *regexp.Regexp
+	// MaxSize - максимальный размер записи в байтах (по умолчанию
+	// DefaultMaxRecordSize)
+	MaxSize int
+}
+
+// Record - запись входного потока
+type Record struct {
+	Text string
+	// Line - номер первой строки записи (для ModeOctet - номер кадра)
+	Line int
+	// Err - ошибка записи (ErrRecordTooLarge); Text при этом пуст
+	Err error
+}
+
+// Reader выделяет записи из потока. Память ограничена MaxSize: у длинных
+// записей сохраняется только начало, и они возвращаются с ErrRecordTooLarge.
+type Reader struct {
+	r   *bufio.Reader
+	cfg ReaderConfig
+
+	line    int
+	pending *recordBuffer // ModeRegex: запись, ожидающая продолжения
+}
+
+func NewReader(r io.Reader, cfg ReaderConfig) (*Reader, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxRecordSize
+	}
+	if cfg.Element == "" {
+		cfg.Element = DefaultXMLElement
+	}
+	if cfg.Mode == ModeRegex && cfg.Start == nil {
+		return nil, fmt.Errorf("не задано выражение начала записи")
+	}
+	return &Reader{r: bufio.NewReader(r), cfg: cfg}, nil
+}
+
+// Next возвращает следующую запись или io.EOF. Ошибка записи (Record.Err)
+// не прерывает чтение; возвращаемая ошибка - ошибка чтения или
+// ErrInvalidFrame, после которых продолжать нельзя.
+func (r *Reader) Next() (Record, error) {
+	switch r.cfg.Mode {
+	case ModeXML:
+		return r.nextXML()
+	case ModeRegex:
+		return r.nextRegex()
+	case ModeOctet:
+		return r.nextOctet()
+	}
+
+	buf := r.newBuffer()
+	if err := r.readLine(buf); err != nil {
+		return Record{}, err
+	}
+	return buf.record(), nil
+}
+
+func (r *Reader) nextRegex() (Record, error) {
+	for {
+		buf := r.newBuffer()
+		err := r.readLine(buf)
+		if err == io.EOF && r.pending != nil {
+			record := r.pending.record()
+			r.pending = nil
+			return record, nil
+		}
+		if err != nil {
+			return Record{}, err
+		}
+
+		if r.pending == nil {
+			r.pending = buf
+			continue
+		}
+		if r.cfg.Start.Match(buf.data) {
+			record := r.pending.record()
+			r.pending = buf
+			return record, nil
+		}
+		r.pending.append(buf)
+	}
+}
+
+func (r *Reader) nextXML() (Record, error) {
+	open := []byte("<" + r.cfg.Element)
+	end := []byte("</" + r.cfg.Element + ">")
+
+	// Поиск открывающего тега: имя элемента и пробел или '>'
+	var tail []byte
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			return Record{}, err
+		}
+		if c == '\n' {
+			r.line++
+		}
+		tail = appendTail(tail, c, len(open)+1)
+		if isXMLNameEnd(c) && bytes.HasPrefix(tail, open) && len(tail) == len(open)+1 {
+			break
+		}
+	}
+
+	buf := r.newBuffer()
+	if tail[len(tail)-1] == '\n' {
+		buf.line--
+	}
+	buf.write(tail)
+
+	depth := 1
+	for {
+		c, err := r.r.ReadByte()
+		if err == io.EOF {
+			return Record{Line: buf.line, Err: fmt.Errorf("незавершенный элемент <%s>", r.cfg.Element)}, nil
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		if c == '\n' {
+			r.line++
+		}
+		buf.writeByte(c)
+
+		tail = appendTail(tail, c, len(end))
+		switch {
+		case c == '>' && bytes.Equal(tail, end):
+			depth--
+			if depth == 0 {
+				return buf.record(), nil
+			}
+		case isXMLNameEnd(c) && bytes.HasPrefix(tail[1:], open) && len(tail) == len(open)+2:
+			depth++
+		}
+	}
+}
+
+func (r *Reader) nextOctet() (Record, error) {
+	var digits []byte
+	for {
+		c, err := r.r.ReadByte()
+		if err == io.EOF && len(digits) == 0 {
+			return Record{}, io.EOF
+		}
+		if err == io.EOF {
+			return Record{}, ErrInvalidFrame
+		}
+		if err != nil {
+			return Record{}, err
+		}
+
+		if c == ' ' {
+			break
+		}
+		// Переводы строк между кадрами допускаются
+		if (c == '\n' || c == '\r') && len(digits) == 0 {
+			continue
+		}
+		if c < '0' || c > '9' || len(digits) == maxLengthDigits {
+			return Record{}, ErrInvalidFrame
+		}
+		digits = append(digits, c)
+	}
+
+	length, err := strconv.Atoi(string(digits))
+	if err != nil || length <= 0 {
+		return Record{}, ErrInvalidFrame
+	}
+	r.line++
+
+	if length > r.cfg.MaxSize {
+		if _, err := r.r.Discard(length); err != nil {
+			return Record{}, ErrInvalidFrame
+		}
+		return Record{Line: r.line, Err: tooLarge(length, r.cfg.MaxSize)}, nil
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Record{}, ErrInvalidFrame
+	}
+	return Record{Text: string(data), Line: r.line}, nil
+}
+
+// readLine читает строку без завершающих CR LF; io.EOF - строк больше нет
+func (r *Reader) readLine(buf *recordBuffer) error {
+	read := 0
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		read += len(chunk)
+		if err == bufio.ErrBufferFull {
+			buf.write(chunk)
+			continue
+		}
+		if err != nil && (err != io.EOF || read == 0) {
+			return err
+		}
+
+		chunk = bytes.TrimSuffix(chunk, []byte("\n"))
+		buf.write(bytes.TrimSuffix(chunk, []byte("\r")))
+		r.line++
+		return nil
+	}
+}
+
+func (r *Reader) newBuffer() *recordBuffer {
+	return &recordBuffer{max: r.cfg.MaxSize, line: r.line + 1}
+}
+
+// recordBuffer накапливает запись, сохраняя не более max байт
+type recordBuffer struct {
+	data []byte
+	size int
+	max  int
+	line int
+}
+
+func (b *recordBuffer) write(p []byte) {
+	b.size += len(p)
+	if room := b.max - len(b.data); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		b.data = append(b.data, p...)
+	}
+}
+
+func (b *recordBuffer) writeByte(c byte) {
+	b.size++
+	if len(b.data) < b.max {
+		b.data = append(b.data, c)
+	}
+}
+
+// append присоединяет строку продолжения
+func (b *recordBuffer) append(line *recordBuffer) {
+	b.writeByte('\n')
+	b.write(line.data)
+	b.size += line.size - len(line.data)
+}
+
+func (b *recordBuffer) record() Record {
+	if b.size > b.max {
+		return Record{Line: b.line, Err: tooLarge(b.size, b.max)}
+	}
+	return Record{Text: string(b.data), Line: b.line}
+}
+
+func tooLarge(size, max int) error {
+	return fmt.Errorf("%w: %d байт (максимум %d)", ErrRecordTooLarge, size, max)
+}
+
+// appendTail добавляет байт к окну последних n байт
+func appendTail(tail []byte, c byte, n int) []byte {
+	if len(tail) == n {
+		copy(tail, tail[1:])
+		tail = tail[:n-1]
+	}
+	return append(tail, c)
+}
+
+func isXMLNameEnd(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '>'
+}
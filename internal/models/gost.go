@@ -7,6 +7,7 @@ type GOSTEvent struct {
 	// Основные поля согласно ГОСТ Р 59710-2021
 	EventID          string    `json:"event_id"`           // Идентификатор события
 	Timestamp        time.Time `json:"timestamp"`          // Время события
+	TimestampSynthesized bool `json:"timestamp_synthesized,omitempty"` // Время события неизвестно, подставлено время обработки
 	Source           Source    `json:"source"`             // Источник события
 	Category         string    `json:"category"`           // Категория события
 	Severity         string    `json:"severity"`           // Критичность события
@@ -16,6 +17,29 @@ type GOSTEvent struct {
 	ObjectAccount    *Account  `json:"object_account,omitempty"`    // Объект
 	Result           string    `json:"result"`             // Результат события (успех/неуспех)
 	Action           string    `json:"action"`             // Действие
+	Origin           *Origin   `json:"origin,omitempty"`   // Исходная запись и сведения о приеме
+}
+
+// Origin содержит сведения об исходной записи для проверки события
+type Origin struct {
+	Raw           string    `json:"raw,omitempty"`            // Исходная строка лога
+	Format        string    `json:"format"`                   // Тип лога (имя парсера: syslog, cef, ...)
+	IngestTime    time.Time `json:"ingest_time"`              // Время приема
+	Input         string    `json:"input,omitempty"`          // Вход: файл, слушатель и адрес отправителя
+	ParserVersion string    `json:"parser_version,omitempty"` // Парсер и его версия
+}
+
+// WithoutRaw возвращает копию события без исходной строки; событие без
+// Origin.Raw возвращается как есть
+func (e *GOSTEvent) WithoutRaw() *GOSTEvent {
+	if e.Origin == nil || e.Origin.Raw == "" {
+		return e
+	}
+	copied := *e
+	origin := *e.Origin
+	origin.Raw = ""
+	copied.Origin = &origin
+	return &copied
 }
 
 // Source содержит информацию об источнике события
@@ -0,0 +1,722 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
+)
+
+// Параметры сборки событий из записей: событие ядра завершается записью
+// EOE; если она потеряна, событие выдается после auditGroupTimeout по
+// времени аудита или при превышении auditMaxPending незавершенных событий
+const (
+	auditGroupTimeout = 2 * time.Second
+	auditMaxPending   = 64
+)
+
+// auditUnsetID - значение auid до входа пользователя (-1)
+const auditUnsetID = "4294967295"
+
+// ErrInvalidAuditRecord возвращается для строки, не являющейся записью auditd
+var ErrInvalidAuditRecord = errors.New("неверная запись auditd")
+
+// AuditdParser парсит журнал аудита Linux (audit.log). Записи одного
+// события (SYSCALL, EXECVE, PATH, CWD, PROCTITLE, ...) с общим серийным
+// номером объединяются в один GOSTEvent.
+type AuditdParser struct {
+	rules *rules.Engine
+}
+
+func NewAuditdParser() *AuditdParser {
+	return &AuditdParser{rules: rules.Default()}
+}
+
+// SetRules задает правила классификации событий
+func (p *AuditdParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, является ли строка записью auditd
+// ("type=SYSCALL msg=audit(...)", возможно с префиксом node=)
+func (p *AuditdParser) Detect(logLine string) bool {
+	if strings.HasPrefix(logLine, "node=") {
+		if i := strings.IndexByte(logLine, ' '); i > 0 {
+			logLine = logLine[i+1:]
+		}
+	}
+	return strings.HasPrefix(logLine, "type=") && strings.Contains(logLine, " msg=audit(")
+}
+
+// Parse парсит запись auditd. Если строка содержит несколько записей
+// (через перевод строки), возвращается первое собранное событие.
+func (p *AuditdParser) Parse(logLine string) (*models.GOSTEvent, error) {
+	var first *models.GOSTEvent
+
+	err := p.ParseReader(strings.NewReader(logLine), func(event *models.GOSTEvent) error {
+		if first == nil {
+			first = event
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, fmt.Errorf("%w: нет данных события", ErrInvalidAuditRecord)
+	}
+
+	return first, nil
+}
+
+// ParseAll парсит записи, разделенные переводом строки, и возвращает
+// собранные из них события
+func (p *AuditdParser) ParseAll(logLine string) ([]*models.GOSTEvent, error) {
+	var events []*models.GOSTEvent
+
+	err := p.ParseReader(strings.NewReader(logLine), func(event *models.GOSTEvent) error {
+		events = append(events, event)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: нет данных события", ErrInvalidAuditRecord)
+	}
+
+	return events, nil
+}
+
+// ParseReader читает audit.log построчно и вызывает handle для каждого
+// собранного события. Неверные строки передаются в skip и пропускаются;
+// если skip равен nil, разбор прерывается на первой неверной строке.
+func (p *AuditdParser) ParseReader(r io.Reader, handle func(*models.GOSTEvent) error, skip func(line int, err error)) error {
+	var skipRaw func(line int, raw string, err error)
+	if skip != nil {
+		skipRaw = func(line int, raw string, err error) { skip(line, err) }
+	}
+	return p.ParseRecords(r, func(event *models.GOSTEvent, raw string, line int) error {
+		return handle(event)
+	}, skipRaw)
+}
+
+// ParseRecords - ParseReader, передающий вместе с событием исходные записи
+// (строки, из которых оно собрано, через перевод строки) и номер строки
+// первой из них, а вместе с ошибкой - неверную строку
+func (p *AuditdParser) ParseRecords(r io.Reader, handle func(event *models.GOSTEvent, raw string, line int) error, skip func(line int, raw string, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	assembler := newAuditAssembler()
+	emit := func(groups [][]*auditRecord) error {
+		for _, group := range groups {
+			lines := make([]string, len(group))
+			first := group[0].line
+			for i, record := range group {
+				lines[i] = record.raw
+				if record.line < first {
+					first = record.line
+				}
+			}
+			if err := handle(p.convert(group), strings.Join(lines, "\n"), first); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		record, err := parseAuditRecord(line)
+		if err != nil {
+			if skip == nil {
+				return fmt.Errorf("строка %d: %w", lineNum, err)
+			}
+			skip(lineNum, line, err)
+			continue
+		}
+		record.line = lineNum
+
+		if err := emit(assembler.add(record)); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения журнала аудита: %w", err)
+	}
+
+	return emit(assembler.flush())
+}
+
+// auditRecord - одна запись журнала аудита
+type auditRecord struct {
+	raw    string
+	line   int // номер строки во входном потоке (0 - запись не из потока)
+	kind   string
+	node   string
+	id     string // "1697040000.123:4567"
+	time   time.Time
+	serial string
+	body   string
+	fields map[string]string
+	// interpreted - поля обогащенного формата (AUID="alice", SYSCALL=execve)
+	// с ключами в нижнем регистре
+	interpreted map[string]string
+}
+
+// parseAuditRecord разбирает строку вида
+// "node=host type=SYSCALL msg=audit(1697040000.123:4567): key=value ..."
+func parseAuditRecord(line string) (*auditRecord, error) {
+	record := &auditRecord{raw: line, fields: make(map[string]string), interpreted: make(map[string]string)}
+
+	if strings.HasPrefix(line, "node=") {
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			return nil, ErrInvalidAuditRecord
+		}
+		record.node = line[len("node="):end]
+		line = line[end+1:]
+	}
+
+	if !strings.HasPrefix(line, "type=") {
+		return nil, fmt.Errorf("%w: нет поля type", ErrInvalidAuditRecord)
+	}
+	end := strings.IndexByte(line, ' ')
+	if end < 0 {
+		return nil, fmt.Errorf("%w: нет поля msg", ErrInvalidAuditRecord)
+	}
+	record.kind = line[len("type="):end]
+	line = strings.TrimLeft(line[end:], " ")
+
+	if !strings.HasPrefix(line, "msg=audit(") {
+		return nil, fmt.Errorf("%w: нет поля msg", ErrInvalidAuditRecord)
+	}
+	line = line[len("msg=audit("):]
+	end = strings.Index(line, "):")
+	if end < 0 {
+		return nil, fmt.Errorf("%w: неверный идентификатор события", ErrInvalidAuditRecord)
+	}
+	record.id = line[:end]
+	record.body = strings.TrimSpace(line[end+2:])
+
+	stamp, serial, ok := strings.Cut(record.id, ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: неверный идентификатор события %s", ErrInvalidAuditRecord, record.id)
+	}
+	t, err := auditTime(stamp)
+	if err != nil {
+		return nil, err
+	}
+	record.time = t
+	record.serial = serial
+
+	// Обогащенный формат отделяет интерпретированные поля символом 0x1d
+	body, enriched, _ := strings.Cut(record.body, "\x1d")
+	record.body = strings.TrimSpace(body)
+	parseAuditFields(record.body, record.fields, record.kind)
+	if enriched != "" {
+		interpreted := make(map[string]string)
+		parseAuditFields(enriched, interpreted, record.kind)
+		for key, value := range interpreted {
+			record.interpreted[strings.ToLower(key)] = value
+		}
+	}
+
+	return record, nil
+}
+
+// auditTime разбирает метку "секунды.миллисекунды"
+func auditTime(stamp string) (time.Time, error) {
+	secText, msText, _ := strings.Cut(stamp, ".")
+	sec, err := strconv.ParseInt(secText, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: неверное время %s", ErrInvalidAuditRecord, stamp)
+	}
+	ms, _ := strconv.Atoi(msText)
+	return time.Unix(sec, int64(ms)*int64(time.Millisecond)).UTC(), nil
+}
+
+// parseAuditFields разбирает пары key=value. Значения в кавычках
+// сохраняются как есть, в одинарных кавычках (msg='...' записей
+// пространства пользователя) разбираются как вложенные поля, остальные
+// значения известных полей декодируются из шестнадцатеричного вида.
+func parseAuditFields(text string, fields map[string]string, kind string) {
+	var words []string
+
+	for i := 0; i < len(text); {
+		if text[i] == ' ' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(text) && text[i] != '=' && text[i] != ' ' {
+			i++
+		}
+		if i >= len(text) || text[i] == ' ' {
+			words = append(words, text[start:i])
+			continue
+		}
+		key := text[start:i]
+		i++
+
+		var value string
+		quoted := false
+		if i < len(text) && (text[i] == '"' || text[i] == '\'') {
+			quote := text[i]
+			end := strings.IndexByte(text[i+1:], quote)
+			if end < 0 {
+				end = len(text) - i - 1
+			}
+			value = text[i+1 : i+1+end]
+			i += end + 2
+			quoted = true
+
+			if quote == '\'' {
+				parseAuditFields(value, fields, kind)
+				continue
+			}
+		} else {
+			start := i
+			for i < len(text) && text[i] != ' ' {
+				i++
+			}
+			value = text[start:i]
+		}
+
+		if !quoted && (auditEncodedFields[key] || kind == "EXECVE" && auditArgument(key)) {
+			value = decodeAuditHex(key, value)
+		}
+		fields[key] = value
+	}
+
+	// "avc:  denied  { read } for ..." - результат и права проверки SELinux
+	if len(words) > 0 && (kind == "AVC" || kind == "USER_AVC") {
+		for j, word := range words {
+			switch word {
+			case "denied", "granted":
+				fields["seresult"] = word
+			case "{":
+				var perms []string
+				for _, perm := range words[j+1:] {
+					if perm == "}" {
+						break
+					}
+					perms = append(perms, perm)
+				}
+				fields["seperms"] = strings.Join(perms, " ")
+			}
+		}
+	}
+}
+
+// auditArgument сообщает, является ли ключ аргументом EXECVE (a0, a1[0])
+func auditArgument(key string) bool {
+	if len(key) < 2 || key[0] != 'a' {
+		return false
+	}
+	rest := strings.TrimSuffix(key[1:], "]")
+	if i := strings.IndexByte(rest, '['); i >= 0 {
+		rest = rest[:i]
+	}
+	_, err := strconv.Atoi(rest)
+	return err == nil
+}
+
+// decodeAuditHex декодирует значение, записанное в шестнадцатеричном виде
+func decodeAuditHex(key, value string) string {
+	if len(value) == 0 || len(value)%2 != 0 {
+		return value
+	}
+	for _, c := range value {
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'F') {
+			return value
+		}
+	}
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	if key == "proctitle" {
+		// Аргументы командной строки разделены нулевыми байтами
+		return strings.TrimRight(strings.ReplaceAll(string(decoded), "\x00", " "), " ")
+	}
+	return string(decoded)
+}
+
+// auditAssembler объединяет записи одного события по идентификатору
+type auditAssembler struct {
+	pending map[string][]*auditRecord
+	order   []string
+	latest  time.Time
+}
+
+func newAuditAssembler() *auditAssembler {
+	return &auditAssembler{pending: make(map[string][]*auditRecord)}
+}
+
+// add добавляет запись и возвращает завершенные события
+func (a *auditAssembler) add(record *auditRecord) [][]*auditRecord {
+	key := record.node + " " + record.id
+	if record.time.After(a.latest) {
+		a.latest = record.time
+	}
+
+	var done [][]*auditRecord
+	switch {
+	case record.kind == "EOE":
+		if group := a.take(key); group != nil {
+			done = append(done, group)
+		}
+	case a.pending[key] == nil && auditSingleRecord(record.kind):
+		done = append(done, []*auditRecord{record})
+	default:
+		if a.pending[key] == nil {
+			a.order = append(a.order, key)
+		}
+		a.pending[key] = append(a.pending[key], record)
+	}
+
+	// События, для которых не пришла запись EOE
+	for len(a.order) > 0 {
+		oldest := a.pending[a.order[0]]
+		if len(a.order) <= auditMaxPending && a.latest.Sub(oldest[0].time) <= auditGroupTimeout {
+			break
+		}
+		done = append(done, a.take(a.order[0]))
+	}
+
+	return done
+}
+
+// flush возвращает все незавершенные события
+func (a *auditAssembler) flush() [][]*auditRecord {
+	var done [][]*auditRecord
+	for len(a.order) > 0 {
+		done = append(done, a.take(a.order[0]))
+	}
+	return done
+}
+
+func (a *auditAssembler) take(key string) []*auditRecord {
+	group, ok := a.pending[key]
+	if !ok {
+		return nil
+	}
+	delete(a.pending, key)
+	for i, k := range a.order {
+		if k == key {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+			break
+		}
+	}
+	return group
+}
+
+// convert собирает GOSTEvent из записей одного события
+func (p *AuditdParser) convert(group []*auditRecord) *models.GOSTEvent {
+	primary := group[0]
+	for _, record := range group {
+		if record.kind == "SYSCALL" {
+			primary = record
+			break
+		}
+	}
+
+	event := &models.GOSTEvent{
+		EventID:   uuid.New().String(),
+		Timestamp: primary.time,
+		Source: models.Source{
+			Hostname:    primary.node,
+			Application: "auditd",
+		},
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         models.ResultUnknown,
+		AdditionalData: make(map[string]interface{}),
+	}
+
+	kinds := make([]string, len(group))
+	for i, record := range group {
+		kinds[i] = record.kind
+	}
+	data := event.AdditionalData
+	data["audit_type"] = primary.kind
+	data["audit_serial"] = primary.serial
+	data["audit_records"] = strings.Join(kinds, ",")
+
+	for key, value := range primary.fields {
+		data["audit_"+key] = value
+	}
+	for key, value := range primary.interpreted {
+		data["audit_"+key+"_name"] = value
+	}
+
+	var paths []string
+	var args []string
+	var objectPath, destAddr string
+	parentPath := false
+	for _, record := range group {
+		if record == primary {
+			continue
+		}
+		switch record.kind {
+		case "EXECVE":
+			args = auditExecArgs(record.fields)
+			data["audit_argc"] = record.fields["argc"]
+		case "PROCTITLE":
+			data["audit_proctitle"] = record.fields["proctitle"]
+		case "CWD":
+			data["audit_cwd"] = record.fields["cwd"]
+		case "PATH":
+			// Объект события - первый путь, не являющийся родительским каталогом
+			if name := record.fields["name"]; name != "" && name != "(null)" {
+				paths = append(paths, name)
+				parent := record.fields["nametype"] == "PARENT"
+				if objectPath == "" || parentPath && !parent {
+					objectPath = name
+					parentPath = parent
+				}
+			}
+		case "SOCKADDR":
+			data["audit_saddr"] = record.fields["saddr"]
+			if ip, port, ok := decodeSockaddr(record.fields["saddr"]); ok {
+				data["audit_dest_ip"] = ip
+				data["audit_dest_port"] = port
+				destAddr = net.JoinHostPort(ip, strconv.Itoa(port))
+			}
+		default:
+			prefix := "audit_" + strings.ToLower(record.kind) + "_"
+			for key, value := range record.fields {
+				data[prefix+key] = value
+			}
+		}
+	}
+	if objectPath != "" {
+		data["audit_path"] = objectPath
+	}
+	if len(paths) > 0 {
+		data["audit_paths"] = paths
+	}
+	if len(args) > 0 {
+		data["audit_execve"] = strings.Join(args, " ")
+	}
+
+	syscall := auditSyscallName(primary)
+	if syscall != "" {
+		data["audit_syscall_name"] = syscall
+		if arg, ok := auditOpenFlagsArg[syscall]; ok {
+			if flags, err := strconv.ParseUint(primary.fields[arg], 16, 64); err == nil {
+				access := "read"
+				if flags&auditOpenWriteFlags != 0 {
+					access = "write"
+				}
+				data["audit_access"] = access
+			}
+		}
+	}
+
+	p.fillSource(event, primary)
+	p.fillAccounts(event, primary)
+
+	if result, ok := auditdResult(primary.fields["success"]); ok {
+		event.Result = result
+	} else if result, ok := auditdResult(primary.fields["res"]); ok {
+		event.Result = result
+	} else if data["audit_avc_seresult"] == "denied" || primary.fields["seresult"] == "denied" {
+		event.Result = models.ResultFailure
+	}
+
+	event.Description = auditDescription(primary, syscall, args, objectPath, destAddr)
+
+	p.rules.Apply("auditd", event)
+
+	return event
+}
+
+// fillSource заполняет процесс и адрес источника
+func (p *AuditdParser) fillSource(event *models.GOSTEvent, primary *auditRecord) {
+	fields := primary.fields
+	if exe := fields["exe"]; exe != "" && exe != "?" {
+		event.Source.Process = exe
+	} else if comm := fields["comm"]; comm != "" {
+		event.Source.Process = comm
+	}
+	if pid, err := strconv.Atoi(fields["pid"]); err == nil {
+		event.Source.ProcessID = pid
+	}
+
+	for _, key := range []string{"addr", "hostname"} {
+		if ip := net.ParseIP(fields[key]); ip != nil {
+			event.Source.IPAddress = ip.String()
+			break
+		}
+	}
+	if event.Source.Hostname == "" {
+		if host := fields["hostname"]; host != "" && host != "?" && net.ParseIP(host) == nil {
+			event.AdditionalData["audit_remote_hostname"] = host
+		}
+	}
+}
+
+// fillAccounts заполняет субъект и объект: для записей входа субъект -
+// входящая учетная запись acct, для управления учетными записями acct -
+// объект, а субъект - пользователь auid (или uid до входа в систему)
+func (p *AuditdParser) fillAccounts(event *models.GOSTEvent, primary *auditRecord) {
+	fields := primary.fields
+	acct := fields["acct"]
+	if acct == "?" || acct == "(unknown)" {
+		acct = ""
+	}
+
+	if auditAuthTypes[primary.kind] && acct != "" {
+		event.SubjectAccount = &models.Account{Username: acct, UserID: fields["id"]}
+		return
+	}
+
+	var subject models.Account
+	if auid := fields["auid"]; auid != "" && auid != auditUnsetID && auid != "-1" {
+		subject = models.Account{Username: primary.interpreted["auid"], UserID: auid}
+	} else if uid := fields["uid"]; uid != "" {
+		subject = models.Account{Username: primary.interpreted["uid"], UserID: uid}
+	}
+	if subject != (models.Account{}) {
+		event.SubjectAccount = &subject
+	}
+
+	if auditAccountTypes[primary.kind] {
+		object := models.Account{Username: acct, UserID: fields["id"]}
+		if object.Username == "" {
+			object.Username = fields["grp"]
+		}
+		if object != (models.Account{}) {
+			event.ObjectAccount = &object
+		}
+	}
+}
+
+// auditSyscallName возвращает имя системного вызова записи SYSCALL
+func auditSyscallName(record *auditRecord) string {
+	if record.kind != "SYSCALL" {
+		return ""
+	}
+	if name := record.interpreted["syscall"]; name != "" {
+		return name
+	}
+	return auditSyscalls[record.fields["arch"]][record.fields["syscall"]]
+}
+
+// auditExecArgs собирает аргументы EXECVE, в том числе разбитые на части
+// (a1_len=..., a1[0]=..., a1[1]=...)
+func auditExecArgs(fields map[string]string) []string {
+	argc, err := strconv.Atoi(fields["argc"])
+	if err != nil || argc <= 0 {
+		return nil
+	}
+	if argc > 4096 {
+		argc = 4096
+	}
+
+	args := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		key := "a" + strconv.Itoa(i)
+		if value, ok := fields[key]; ok {
+			args = append(args, value)
+			continue
+		}
+		var parts []string
+		for j := 0; ; j++ {
+			part, ok := fields[key+"["+strconv.Itoa(j)+"]"]
+			if !ok {
+				break
+			}
+			parts = append(parts, part)
+		}
+		args = append(args, strings.Join(parts, ""))
+	}
+	return args
+}
+
+// decodeSockaddr возвращает адрес и порт из структуры sockaddr (saddr)
+func decodeSockaddr(saddr string) (string, int, bool) {
+	data, err := hex.DecodeString(saddr)
+	if err != nil || len(data) < 8 {
+		return "", 0, false
+	}
+
+	family := int(data[0]) | int(data[1])<<8
+	port := int(data[2])<<8 | int(data[3])
+	switch family {
+	case 2: // AF_INET
+		return net.IP(data[4:8]).String(), port, true
+	case 10: // AF_INET6
+		if len(data) < 24 {
+			return "", 0, false
+		}
+		return net.IP(data[8:24]).String(), port, true
+	}
+	return "", 0, false
+}
+
+// auditDescription формирует описание: для системных вызовов - имя вызова
+// и его объект (команда, файл или адрес), для остальных - текст записи.
+// Объект берется из разобранных записей, а не из AdditionalData, куда
+// попадают произвольные поля исходной строки
+func auditDescription(primary *auditRecord, syscall string, args []string, objectPath, destAddr string) string {
+	if syscall == "" {
+		if msg, ok := auditUserMessage(primary.body); ok {
+			return msg
+		}
+		return primary.body
+	}
+
+	var target string
+	switch {
+	case len(args) > 0:
+		target = strings.Join(args, " ")
+	case objectPath != "":
+		target = objectPath
+	case destAddr != "":
+		target = destAddr
+	default:
+		if exe := primary.fields["exe"]; exe != "" {
+			target = path.Base(exe)
+		}
+	}
+
+	if target == "" {
+		return syscall
+	}
+	return syscall + ": " + target
+}
+
+// auditUserMessage возвращает содержимое msg='...' записи пространства
+// пользователя
+func auditUserMessage(body string) (string, bool) {
+	start := strings.Index(body, "msg='")
+	if start < 0 {
+		return "", false
+	}
+	msg := body[start+len("msg='"):]
+	if end := strings.LastIndexByte(msg, '\''); end >= 0 {
+		msg = msg[:end]
+	}
+	return msg, true
+}
@@ -0,0 +1,248 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+const auditExecEvent = `type=SYSCALL msg=audit(1697040000.123:4567): arch=c000003e syscall=59 success=yes exit=0 a0=55d1c2a0 a1=55d1c2b0 a2=0 a3=0 items=2 ppid=1200 pid=1234 auid=1000 uid=0 gid=0 euid=0 tty=pts0 ses=3 comm="cat" exe="/usr/bin/cat" key="exec"
+type=EXECVE msg=audit(1697040000.123:4567): argc=3 a0="cat" a1_len=10 a1[0]="/etc/" a1[1]="shadow" a2=2D6E
+type=CWD msg=audit(1697040000.123:4567): cwd="/root"
+type=PATH msg=audit(1697040000.123:4567): item=0 name="/usr/bin/cat" inode=1234 nametype=NORMAL
+type=PROCTITLE msg=audit(1697040000.123:4567): proctitle=636174002F6574632F736861646F77002D6E
+type=EOE msg=audit(1697040000.123:4567):`
+
+func TestAuditdParser_ExecEvent(t *testing.T) {
+	parser := NewAuditdParser()
+
+	events, err := parser.ParseAll(auditExecEvent)
+	if err != nil {
+		t.Fatalf("ParseAll failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected records to be grouped into 1 event, got %d", len(events))
+	}
+	event := events[0]
+
+	if !event.Timestamp.Equal(time.Unix(1697040000, 123000000)) {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.Description != "execve: cat /etc/shadow -n" {
+		t.Errorf("Unexpected description %q", event.Description)
+	}
+	if event.Action != "process_created" || event.Result != models.ResultSuccess {
+		t.Errorf("Unexpected action/result %s/%s", event.Action, event.Result)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.UserID != "1000" {
+		t.Errorf("Expected auid as subject, got %+v", event.SubjectAccount)
+	}
+	if event.Source.Process != "/usr/bin/cat" || event.Source.ProcessID != 1234 {
+		t.Errorf("Unexpected source %+v", event.Source)
+	}
+	if event.AdditionalData["audit_proctitle"] != "cat /etc/shadow -n" || event.AdditionalData["audit_cwd"] != "/root" {
+		t.Errorf("Unexpected decoded fields %v", event.AdditionalData)
+	}
+	if event.AdditionalData["audit_records"] != "SYSCALL,EXECVE,CWD,PATH,PROCTITLE" {
+		t.Errorf("Unexpected records %v", event.AdditionalData["audit_records"])
+	}
+}
+
+func TestAuditdParser_EnrichedFileAccess(t *testing.T) {
+	parser := NewAuditdParser()
+
+	// Обогащенный формат: интерпретированные поля после символа 0x1d
+	log := "node=srv01 type=SYSCALL msg=audit(1697040005.456:4570): arch=c000003e syscall=257 success=no exit=-13 a0=ffffff9c a1=7ffd3c a2=241 a3=1b6 items=1 ppid=900 pid=1301 auid=1001 uid=1001 comm=\"vi\" exe=\"/usr/bin/vim.basic\" key=\"identity\"\x1dARCH=x86_64 SYSCALL=openat AUID=\"bob\" UID=\"bob\"\n" +
+		"node=srv01 type=PATH msg=audit(1697040005.456:4570): item=0 name=\"/etc/shadow\" nametype=NORMAL\n" +
+		"node=srv01 type=EOE msg=audit(1697040005.456:4570):"
+
+	event, err := parser.Parse(log)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.Source.Hostname != "srv01" {
+		t.Errorf("Expected node as hostname, got %q", event.Source.Hostname)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "bob" || event.SubjectAccount.UserID != "1001" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+	if event.AdditionalData["audit_access"] != "write" || event.AdditionalData["audit_path"] != "/etc/shadow" {
+		t.Errorf("Unexpected file access %v", event.AdditionalData)
+	}
+	if event.Result != models.ResultFailure {
+		t.Errorf("Expected НЕУСПЕХ, got %s", event.Result)
+	}
+	if event.Category != models.CategoryDataModification || event.Action != "config_changed" {
+		t.Errorf("Unexpected classification %s/%s", event.Category, event.Action)
+	}
+}
+
+func TestAuditdParser_UserRecords(t *testing.T) {
+	parser := NewAuditdParser()
+
+	tests := []struct {
+		name     string
+		log      string
+		action   string
+		category string
+		result   string
+		subject  string
+		object   string
+		ip       string
+	}{
+		{
+			name:     "failed ssh login",
+			log:      `type=USER_LOGIN msg=audit(1697040010.789:4580): pid=2201 uid=0 auid=4294967295 ses=4294967295 msg='op=login acct="root" exe="/usr/sbin/sshd" hostname=? addr=10.0.0.5 terminal=sshd res=failed'`,
+			action:   "logon_failed",
+			category: models.CategoryAuthentication,
+			result:   models.ResultFailure,
+			subject:  "root",
+			ip:       "10.0.0.5",
+		},
+		{
+			name:     "hex encoded account",
+			log:      `type=USER_AUTH msg=audit(1697040011.000:4581): pid=2202 uid=0 auid=4294967295 ses=4294967295 msg='op=PAM:authentication grantors=pam_unix acct=6A20646F65 exe="/usr/sbin/sshd" hostname=::ffff:10.0.0.6 addr=::ffff:10.0.0.6 terminal=ssh res=success'`,
+			action:   "credential_validation",
+			category: models.CategoryAuthentication,
+			result:   models.ResultSuccess,
+			subject:  "j doe",
+			ip:       "10.0.0.6",
+		},
+		{
+			name:     "user added",
+			log:      `type=ADD_USER msg=audit(1697040020.000:4590): pid=3000 uid=0 auid=1000 ses=3 msg='op=adding user acct="svc_backup" id=1002 exe="/usr/sbin/useradd" hostname=srv01 addr=? terminal=pts/0 res=success'`,
+			action:   "user_created",
+			category: models.CategoryDataModification,
+			result:   models.ResultSuccess,
+			object:   "svc_backup",
+		},
+		{
+			name:     "audit rule added",
+			log:      `type=CONFIG_CHANGE msg=audit(1697040050.000:4620): auid=1000 ses=3 op=add_rule key="identity" list=4 res=1`,
+			action:   "audit_policy_changed",
+			category: models.CategoryDataModification,
+			result:   models.ResultSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := parser.Parse(tt.log)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if event.Action != tt.action || event.Category != tt.category || event.Result != tt.result {
+				t.Errorf("Expected %s/%s/%s, got %s/%s/%s", tt.action, tt.category, tt.result, event.Action, event.Category, event.Result)
+			}
+			if tt.subject != "" && (event.SubjectAccount == nil || event.SubjectAccount.Username != tt.subject) {
+				t.Errorf("Expected subject %s, got %+v", tt.subject, event.SubjectAccount)
+			}
+			if tt.object != "" && (event.ObjectAccount == nil || event.ObjectAccount.Username != tt.object) {
+				t.Errorf("Expected object %s, got %+v", tt.object, event.ObjectAccount)
+			}
+			if event.Source.IPAddress != tt.ip {
+				t.Errorf("Expected IP %q, got %q", tt.ip, event.Source.IPAddress)
+			}
+		})
+	}
+}
+
+func TestAuditdParser_Assembly(t *testing.T) {
+	parser := NewAuditdParser()
+
+	// Записи двух событий чередуются, у второго нет записи EOE, между
+	// ними - запись пространства пользователя и неверная строка
+	log := `type=SYSCALL msg=audit(1697040040.000:10): arch=c000003e syscall=42 success=yes exit=0 items=0 pid=4000 auid=1000 uid=1000 comm="curl" exe="/usr/bin/curl"
+type=SYSCALL msg=audit(1697040040.001:11): arch=c000003e syscall=87 success=yes exit=0 items=2 pid=4001 auid=1000 uid=1000 comm="rm" exe="/usr/bin/rm"
+type=USER_CMD msg=audit(1697040040.002:12): pid=4002 uid=1000 auid=1000 ses=3 msg='cwd="/home/alice" cmd=73797374656D63746C2072657374617274 exe="/usr/bin/sudo" terminal=pts/0 res=success'
+garbage line
+type=SOCKADDR msg=audit(1697040040.000:10): saddr=020001BBC00002010000000000000000
+type=EOE msg=audit(1697040040.000:10):
+type=PATH msg=audit(1697040040.001:11): item=0 name="/tmp/" nametype=PARENT
+type=PATH msg=audit(1697040040.001:11): item=1 name="/tmp/x" nametype=DELETE`
+
+	var events []*models.GOSTEvent
+	var skipped []int
+	err := parser.ParseReader(strings.NewReader(log), func(event *models.GOSTEvent) error {
+		events = append(events, event)
+		return nil
+	}, func(line int, err error) {
+		if !errors.Is(err, ErrInvalidAuditRecord) {
+			t.Errorf("Expected ErrInvalidAuditRecord, got %v", err)
+		}
+		skipped = append(skipped, line)
+	})
+	if err != nil {
+		t.Fatalf("ParseReader failed: %v", err)
+	}
+
+	if len(skipped) != 1 || skipped[0] != 4 {
+		t.Errorf("Expected line 4 to be skipped, got %v", skipped)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if events[0].Action != "command_executed" || events[0].AdditionalData["audit_cmd"] != "systemctl restart" {
+		t.Errorf("Unexpected sudo event %s %v", events[0].Action, events[0].AdditionalData["audit_cmd"])
+	}
+	if events[1].Description != "connect: 192.0.2.1:443" || events[1].Action != "network_connection" {
+		t.Errorf("Unexpected connect event %q %s", events[1].Description, events[1].Action)
+	}
+	if events[2].Description != "unlink: /tmp/x" || events[2].Action != "file_deleted" {
+		t.Errorf("Unexpected unlink event %q %s", events[2].Description, events[2].Action)
+	}
+
+	// Событие относится к строке своей первой записи
+	var lines []int
+	err = parser.ParseRecords(strings.NewReader(log), func(event *models.GOSTEvent, raw string, line int) error {
+		lines = append(lines, line)
+		return nil
+	}, func(int, string, error) {})
+	if err != nil {
+		t.Fatalf("ParseRecords failed: %v", err)
+	}
+	if len(lines) != 3 || lines[0] != 3 || lines[1] != 1 || lines[2] != 2 {
+		t.Errorf("Expected event lines [3 1 2], got %v", lines)
+	}
+
+	if _, err := parser.Parse("type=EOE msg=audit(1697040040.000:10):"); !errors.Is(err, ErrInvalidAuditRecord) {
+		t.Errorf("Expected error for lone EOE, got %v", err)
+	}
+}
+
+func TestAuditdParser_RawFieldsDoNotOverrideObject(t *testing.T) {
+	parser := NewAuditdParser()
+
+	// Поля dest_ip/dest_port/path самой записи SYSCALL попадают в
+	// AdditionalData строками и не должны приниматься за разобранный объект
+	log := `type=SYSCALL msg=audit(1697040000.123:4567): arch=c000003e syscall=42 success=yes dest_ip=1.2.3.4 dest_port=80 path=/tmp/x`
+
+	event, err := parser.Parse(log)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Description != "connect" {
+		t.Errorf("Unexpected description %q", event.Description)
+	}
+	if event.AdditionalData["audit_dest_port"] != "80" || event.AdditionalData["audit_path"] != "/tmp/x" {
+		t.Errorf("Expected raw fields to be kept, got %v", event.AdditionalData)
+	}
+}
+
+func TestAuditdParser_Detect(t *testing.T) {
+	parser := NewAuditdParser()
+
+	if !parser.Detect(`type=SYSCALL msg=audit(1697040000.123:4567): arch=c000003e`) {
+		t.Error("Expected record to be detected")
+	}
+	if !parser.Detect(`node=srv01 type=EOE msg=audit(1697040000.123:4567):`) {
+		t.Error("Expected record with node to be detected")
+	}
+	if parser.Detect(`type=value other=1`) {
+		t.Error("Expected plain key=value line not to be detected")
+	}
+}
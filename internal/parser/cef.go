@@ -8,60 +8,82 @@ import (
 	"time"
 
 	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
 	"github.com/google/uuid"
 )
 
 // CEFParser парсит Common Event Format (CEF) логи
-type CEFParser struct{}
+type CEFParser struct {
+	rules *rules.Engine
+}
 
 // CEF Format: CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
-var cefPattern = regexp.MustCompile(`^CEF:(\d+)\|([^|]*)\|([^|]*)\|([^|]*)\|([^|]*)\|([^|]*)\|([^|]*)\|(.*)$`)
+var cefVersionPattern = regexp.MustCompile(`^CEF:(\d+)$`)
+
+// cefHeaderFields - количество полей заголовка CEF (включая "CEF:Version")
+const cefHeaderFields = 7
 
 func NewCEFParser() *CEFParser {
-	return &CEFParser{}
+	return &CEFParser{rules: rules.Default()}
+}
+
+// SetRules задает правила классификации событий
+func (p *CEFParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, является ли строка CEF сообщением
+func (p *CEFParser) Detect(logLine string) bool {
+	return strings.HasPrefix(logLine, "CEF:")
 }
 
 // Parse парсит CEF сообщение и возвращает GOSTEvent
 func (p *CEFParser) Parse(logLine string) (*models.GOSTEvent, error) {
-	match := cefPattern.FindStringSubmatch(logLine)
-	if match == nil {
+	header, extension, ok := splitCEFHeader(logLine)
+	if !ok {
+		return nil, fmt.Errorf("неверный формат CEF")
+	}
+
+	versionMatch := cefVersionPattern.FindStringSubmatch(header[0])
+	if versionMatch == nil {
 		return nil, fmt.Errorf("неверный формат CEF")
 	}
 
-	version := match[1]
-	deviceVendor := match[2]
-	deviceProduct := match[3]
-	deviceVersion := match[4]
-	signatureID := match[5]
-	name := match[6]
-	severity := match[7]
-	extension := match[8]
+	version := versionMatch[1]
+	deviceVendor := header[1]
+	deviceProduct := header[2]
+	deviceVersion := header[3]
+	signatureID := header[4]
+	name := header[5]
+	severity := header[6]
 
 	extensions := p.parseExtensions(extension)
 
 	timestamp := time.Now()
+	synthesized := true
 	if rt, ok := extensions["rt"]; ok {
 		if t, err := p.parseTimestamp(rt); err == nil {
-			timestamp = t
+			timestamp, synthesized = t, false
 		}
 	} else if end, ok := extensions["end"]; ok {
 		if t, err := p.parseTimestamp(end); err == nil {
-			timestamp = t
+			timestamp, synthesized = t, false
 		}
 	}
 
 	event := &models.GOSTEvent{
-		EventID:     uuid.New().String(),
-		Timestamp:   timestamp,
-		Description: name,
+		EventID:              uuid.New().String(),
+		Timestamp:            timestamp,
+		TimestampSynthesized: synthesized,
+		Description:          name,
 		Source: models.Source{
 			Hostname:    p.getExtensionValue(extensions, "dvc", "shost", "dvchost"),
 			Application: fmt.Sprintf("%s %s", deviceVendor, deviceProduct),
 			IPAddress:   p.getExtensionValue(extensions, "src", "dst"),
 		},
-		Severity:       p.mapCEFSeverityToGOST(severity),
-		Category:       p.categorizeCEFEvent(signatureID, name, extensions),
-		Result:         p.determineResult(extensions),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         models.ResultUnknown,
 		AdditionalData: make(map[string]interface{}),
 	}
 
@@ -90,28 +112,123 @@ func (p *CEFParser) Parse(logLine string) (*models.GOSTEvent, error) {
 		event.AdditionalData["cef_"+k] = v
 	}
 
-	if act, ok := extensions["act"]; ok {
-		event.Action = act
-	}
+	p.rules.Apply("cef", event)
 
 	return event, nil
 }
 
+// parseExtensions разбирает расширение CEF согласно спецификации ArcSight:
+// значение продолжается до следующего "key=", поэтому может содержать пробелы,
+// а экранированные \=, \\, \n и \r заменяются исходными символами.
 func (p *CEFParser) parseExtensions(extension string) map[string]string {
 	extensions := make(map[string]string)
-	
-	parts := strings.Split(extension, " ")
-	for _, part := range parts {
-		if idx := strings.Index(part, "="); idx != -1 {
-			key := part[:idx]
-			value := part[idx+1:]
-			extensions[key] = value
+
+	i := 0
+	for i < len(extension) {
+		for i < len(extension) && extension[i] == ' ' {
+			i++
+		}
+
+		keyEnd := cefKeyEnd(extension, i)
+		if keyEnd < 0 {
+			// Мусор без "key=" - пропускаем до следующего пробела
+			next := strings.IndexByte(extension[i:], ' ')
+			if next < 0 {
+				break
+			}
+			i += next
+			continue
+		}
+
+		key := extension[i:keyEnd]
+		valueStart := keyEnd + 1
+		valueEnd := len(extension)
+		for j := valueStart; j < len(extension); j++ {
+			if extension[j] == ' ' && cefKeyEnd(extension, j+1) > 0 {
+				valueEnd = j
+				break
+			}
 		}
+
+		extensions[key] = unescapeCEFValue(strings.TrimRight(extension[valueStart:valueEnd], " "))
+		i = valueEnd
 	}
-	
+
 	return extensions
 }
 
+// splitCEFHeader делит строку на 7 полей заголовка и расширение по
+// неэкранированным символам "|", снимая экранирование \| и \\ в заголовке
+func splitCEFHeader(logLine string) ([]string, string, bool) {
+	fields := make([]string, 0, cefHeaderFields)
+	var current strings.Builder
+
+	for i := 0; i < len(logLine); i++ {
+		c := logLine[i]
+		switch {
+		case c == '\\' && i+1 < len(logLine) && (logLine[i+1] == '|' || logLine[i+1] == '\\'):
+			current.WriteByte(logLine[i+1])
+			i++
+		case c == '|':
+			fields = append(fields, current.String())
+			current.Reset()
+			if len(fields) == cefHeaderFields {
+				return fields, logLine[i+1:], true
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	return nil, "", false
+}
+
+// cefKeyEnd возвращает позицию "=" после ключа, начинающегося с start, или -1
+func cefKeyEnd(s string, start int) int {
+	i := start
+	for i < len(s) && isCEFKeyChar(s[i]) {
+		i++
+	}
+	if i == start || i >= len(s) || s[i] != '=' {
+		return -1
+	}
+	return i
+}
+
+func isCEFKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == '[' || c == ']'
+}
+
+// unescapeCEFValue снимает экранирование значения расширения CEF
+func unescapeCEFValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case '=', '\\', '|':
+			b.WriteByte(value[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
 func (p *CEFParser) parseTimestamp(ts string) (time.Time, error) {
 	formats := []string{
 		time.RFC3339,
@@ -133,77 +250,6 @@ func (p *CEFParser) parseTimestamp(ts string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("невозможно распарсить время: %s", ts)
 }
 
-func (p *CEFParser) mapCEFSeverityToGOST(severity string) string {
-	sev, err := strconv.Atoi(severity)
-	if err != nil {
-		return models.SeverityInfo
-	}
-	
-	switch {
-	case sev >= 8:
-		return models.SeverityCritical
-	case sev >= 6:
-		return models.SeverityHigh
-	case sev >= 4:
-		return models.SeverityMedium
-	case sev >= 2:
-		return models.SeverityLow
-	default:
-		return models.SeverityInfo
-	}
-}
-
-func (p *CEFParser) categorizeCEFEvent(signatureID, name string, extensions map[string]string) string {
-	nameLower := strings.ToLower(name)
-	
-	if strings.Contains(nameLower, "login") || strings.Contains(nameLower, "logon") ||
-		strings.Contains(nameLower, "authentication") {
-		return models.CategoryAuthentication
-	}
-	if strings.Contains(nameLower, "access") || strings.Contains(nameLower, "denied") ||
-		strings.Contains(nameLower, "permission") {
-		return models.CategoryAccess
-	}
-	if strings.Contains(nameLower, "modify") || strings.Contains(nameLower, "change") ||
-		strings.Contains(nameLower, "update") || strings.Contains(nameLower, "delete") {
-		return models.CategoryDataModification
-	}
-	if strings.Contains(nameLower, "network") || strings.Contains(nameLower, "connection") ||
-		strings.Contains(nameLower, "firewall") {
-		return models.CategoryNetworkEvent
-	}
-	if strings.Contains(nameLower, "security") || strings.Contains(nameLower, "threat") ||
-		strings.Contains(nameLower, "attack") || strings.Contains(nameLower, "malware") {
-		return models.CategorySecurityEvent
-	}
-	
-	return models.CategorySystemEvent
-}
-
-func (p *CEFParser) determineResult(extensions map[string]string) string {
-	if outcome, ok := extensions["outcome"]; ok {
-		outcomeLower := strings.ToLower(outcome)
-		if strings.Contains(outcomeLower, "success") {
-			return models.ResultSuccess
-		}
-		if strings.Contains(outcomeLower, "fail") || strings.Contains(outcomeLower, "deny") {
-			return models.ResultFailure
-		}
-	}
-	
-	if act, ok := extensions["act"]; ok {
-		actLower := strings.ToLower(act)
-		if strings.Contains(actLower, "allow") || strings.Contains(actLower, "permit") {
-			return models.ResultSuccess
-		}
-		if strings.Contains(actLower, "block") || strings.Contains(actLower, "deny") {
-			return models.ResultFailure
-		}
-	}
-	
-	return models.ResultUnknown
-}
-
 func (p *CEFParser) getExtensionValue(extensions map[string]string, keys ...string) string {
 	for _, key := range keys {
 		if val, ok := extensions[key]; ok && val != "" {
@@ -58,3 +58,53 @@ func TestCEFParser_WithUser(t *testing.T) {
 		t.Errorf("Expected result УСПЕХ, got %s", event.Result)
 	}
 }
+
+func TestCEFParser_ExtensionValuesWithSpaces(t *testing.T) {
+	parser := NewCEFParser()
+
+	logLine := "CEF:0|Vendor|Product|1.0|300|User Login|5|suser=admin msg=User admin logged in from console act=login outcome=success"
+
+	event, err := parser.Parse(logLine)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["cef_msg"] != "User admin logged in from console" {
+		t.Errorf("Unexpected cef_msg: '%v'", event.AdditionalData["cef_msg"])
+	}
+
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "admin" {
+		t.Errorf("Expected SubjectAccount 'admin', got %+v", event.SubjectAccount)
+	}
+
+	if event.Action != "login" {
+		t.Errorf("Expected action 'login', got '%s'", event.Action)
+	}
+}
+
+func TestCEFParser_Escaping(t *testing.T) {
+	parser := NewCEFParser()
+
+	logLine := `CEF:0|Security|threat\|manager|1.0|100|detected a \\ in packet|10|msg=a\=b c\\d\nnext line\| end fname=C:\\Windows\\cmd.exe`
+
+	event, err := parser.Parse(logLine)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["device_product"] != "threat|manager" {
+		t.Errorf("Unexpected device_product: '%v'", event.AdditionalData["device_product"])
+	}
+
+	if event.Description != `detected a \ in packet` {
+		t.Errorf("Unexpected description: %s", event.Description)
+	}
+
+	if event.AdditionalData["cef_msg"] != "a=b c\\d\nnext line| end" {
+		t.Errorf("Unexpected cef_msg: %q", event.AdditionalData["cef_msg"])
+	}
+
+	if event.AdditionalData["cef_fname"] != `C:\Windows\cmd.exe` {
+		t.Errorf("Unexpected cef_fname: %q", event.AdditionalData["cef_fname"])
+	}
+}
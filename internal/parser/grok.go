@@ -0,0 +1,473 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
+)
+
+//go:embed grok_patterns
+var defaultGrokPatternsData []byte
+
+//go:embed grok_profiles.json
+var defaultGrokProfilesData []byte
+
+// Встроенные шаблоны и профили: журналы доступа и ошибок nginx и Apache,
+// PostgreSQL
+var (
+	defaultGrokPatterns map[string]string
+	defaultGrokProfiles []GrokProfile
+)
+
+func init() {
+	patterns, err := LoadGrokPatterns(bytes.NewReader(defaultGrokPatternsData))
+	if err != nil {
+		panic(fmt.Sprintf("встроенные шаблоны grok: %v", err))
+	}
+	defaultGrokPatterns = patterns
+
+	profiles, err := LoadGrokProfiles(bytes.NewReader(defaultGrokProfilesData))
+	if err != nil {
+		panic(fmt.Sprintf("встроенные профили grok: %v", err))
+	}
+	defaultGrokProfiles = profiles
+}
+
+// grokMaxDepth ограничивает вложенность шаблонов (защита от циклов)
+const grokMaxDepth = 32
+
+// grokReference - ссылка на шаблон: %{ИМЯ}, %{ИМЯ:поле} или
+// %{ИМЯ:поле:тип}, где тип - int или float
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]-]+))?(?::(int|float))?\}`)
+
+// grokNamedGroup - именованная группа (?<поле>...) в выражении
+var grokNamedGroup = regexp.MustCompile(`\(\?P?<([A-Za-z_][\w.@\[\]-]*)>`)
+
+// grokPatternName - допустимое имя шаблона
+var grokPatternName = regexp.MustCompile(`^\w+$`)
+
+// GrokProfile - профиль разбора строк выражениями grok. Match - выражения
+// ("%{IPORHOST:clientip} %{WORD:method}"), проверяются по порядку до
+// первого совпадения. Fields сопоставляет захваченные поля с полями ГОСТ
+// так же, как JSONProfile (путь - имя поля).
+type GrokProfile struct {
+	Name   string               `json:"name"`
+	Match  []string             `json:"match"`
+	Fields map[string]JSONField `json:"fields,omitempty"`
+}
+
+// grokProfileFile - структура файла профилей
+type grokProfileFile struct {
+	IncludeDefaults bool          `json:"include_defaults"`
+	Profiles        []GrokProfile `json:"profiles"`
+}
+
+// grokCapture - поле, захватываемое группой выражения
+type grokCapture struct {
+	field string
+	kind  string
+}
+
+// grokExpression - скомпилированное выражение профиля
+type grokExpression struct {
+	re       *regexp.Regexp
+	captures []grokCapture // по номеру группы; пустое поле - группа без имени
+}
+
+// compiledGrokProfile - профиль со скомпилированными выражениями
+type compiledGrokProfile struct {
+	profile     GrokProfile
+	expressions []grokExpression
+}
+
+// DefaultGrokPatterns возвращает копию встроенной библиотеки шаблонов
+func DefaultGrokPatterns() map[string]string {
+	patterns := make(map[string]string, len(defaultGrokPatterns))
+	for name, pattern := range defaultGrokPatterns {
+		patterns[name] = pattern
+	}
+	return patterns
+}
+
+// LoadGrokPatterns читает библиотеку шаблонов: строки "ИМЯ выражение",
+// пустые строки и строки с # пропускаются
+func LoadGrokPatterns(r io.Reader) (map[string]string, error) {
+	patterns := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, pattern, ok := strings.Cut(line, " ")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" || !grokPatternName.MatchString(name) {
+			return nil, fmt.Errorf("строка %d: ожидается \"ИМЯ выражение\"", lineNum)
+		}
+		patterns[name] = pattern
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения шаблонов grok: %w", err)
+	}
+	return patterns, nil
+}
+
+// LoadGrokPatternsFile читает библиотеку шаблонов из файла
+func LoadGrokPatternsFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла шаблонов grok: %w", err)
+	}
+	defer file.Close()
+
+	return LoadGrokPatterns(file)
+}
+
+// DefaultGrokProfiles возвращает копию встроенных профилей
+func DefaultGrokProfiles() []GrokProfile {
+	return append([]GrokProfile(nil), defaultGrokProfiles...)
+}
+
+// LoadGrokProfiles читает профили в формате JSON. При "include_defaults":
+// true встроенные профили добавляются после пользовательских. Выражения
+// проверяются при передаче профилей парсеру, когда известна библиотека
+// шаблонов.
+func LoadGrokProfiles(r io.Reader) ([]GrokProfile, error) {
+	var file grokProfileFile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("ошибка чтения профилей grok: %w", err)
+	}
+
+	profiles := make([]GrokProfile, 0, len(file.Profiles))
+	for i, profile := range file.Profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("профиль %d: не задано имя профиля", i+1)
+		}
+		if len(profile.Match) == 0 {
+			return nil, fmt.Errorf("профиль %d (%s): не задано ни одного выражения", i+1, profile.Name)
+		}
+		if len(profile.Fields) > 0 {
+			fields, err := compileFields(profile.Fields)
+			if err != nil {
+				return nil, fmt.Errorf("профиль %d (%s): %w", i+1, profile.Name, err)
+			}
+			profile.Fields = fields
+		}
+		profiles = append(profiles, profile)
+	}
+	if file.IncludeDefaults {
+		profiles = append(profiles, defaultGrokProfiles...)
+	}
+
+	return profiles, nil
+}
+
+// LoadGrokProfilesFile читает профили из файла
+func LoadGrokProfilesFile(path string) ([]GrokProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла профилей grok: %w", err)
+	}
+	defer file.Close()
+
+	return LoadGrokProfiles(file)
+}
+
+// GrokParser разбирает произвольные текстовые логи выражениями grok.
+// Выражения компилируются один раз при задании шаблонов и профилей.
+type GrokParser struct {
+	mu       sync.RWMutex
+	patterns map[string]string
+	source   []GrokProfile
+	profiles []compiledGrokProfile
+	rules    *rules.Engine
+	time     *timeConfig
+}
+
+func NewGrokParser() *GrokParser {
+	p := &GrokParser{patterns: defaultGrokPatterns, rules: rules.Default(), time: newTimeConfig()}
+	if err := p.SetProfiles(defaultGrokProfiles); err != nil {
+		panic(fmt.Sprintf("встроенные профили grok: %v", err))
+	}
+	return p
+}
+
+// AddPatterns добавляет шаблоны в библиотеку (одноименные заменяются) и
+// перекомпилирует профили
+func (p *GrokParser) AddPatterns(patterns map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	merged := make(map[string]string, len(p.patterns)+len(patterns))
+	for name, pattern := range p.patterns {
+		merged[name] = pattern
+	}
+	for name, pattern := range patterns {
+		merged[name] = pattern
+	}
+
+	compiled, err := compileGrokProfiles(p.source, merged)
+	if err != nil {
+		return err
+	}
+	p.patterns = merged
+	p.profiles = compiled
+	return nil
+}
+
+// SetProfiles задает профили; профили проверяются по порядку, применяется
+// первый, одно из выражений которого совпало со строкой
+func (p *GrokParser) SetProfiles(profiles []GrokProfile) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	compiled, err := compileGrokProfiles(profiles, p.patterns)
+	if err != nil {
+		return err
+	}
+	p.source = append([]GrokProfile(nil), profiles...)
+	p.profiles = compiled
+	return nil
+}
+
+// Profiles возвращает копию текущих профилей
+func (p *GrokParser) Profiles() []GrokProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]GrokProfile(nil), p.source...)
+}
+
+// SetTimezone задает часовой пояс для меток времени без смещения
+func (p *GrokParser) SetTimezone(loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.location = loc
+}
+
+// SetHostTimezone задает часовой пояс отдельного хоста
+func (p *GrokParser) SetHostTimezone(host string, loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.hosts[strings.ToLower(host)] = loc
+}
+
+// SetRules задает правила классификации событий
+func (p *GrokParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, совпадает ли строка с выражением одного из профилей
+func (p *GrokParser) Detect(logLine string) bool {
+	profile, _ := p.match(logLine)
+	return profile != nil
+}
+
+// Parse разбирает строку первым подходящим профилем и возвращает GOSTEvent
+func (p *GrokParser) Parse(logLine string) (*models.GOSTEvent, error) {
+	profile, captures := p.match(logLine)
+	if profile == nil {
+		return nil, fmt.Errorf("строка не совпала ни с одним выражением grok")
+	}
+
+	event := &models.GOSTEvent{
+		EventID:        uuid.New().String(),
+		Description:    logLine,
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         models.ResultUnknown,
+		AdditionalData: make(map[string]interface{}),
+	}
+
+	object := make(map[string]interface{}, len(captures))
+	for field, value := range captures {
+		object[field] = value.raw
+	}
+	descriptionKey := applyFields(event, profile.profile.Fields, object, p.time)
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+		event.TimestampSynthesized = true
+	}
+
+	for field, value := range captures {
+		if field != descriptionKey {
+			event.AdditionalData["grok_"+field] = value.typed
+		}
+	}
+	event.AdditionalData["grok_profile"] = profile.profile.Name
+
+	p.rules.Apply("grok", event)
+
+	return event, nil
+}
+
+// grokValue - захваченное значение: строка и значение с учетом типа поля
+type grokValue struct {
+	raw   string
+	typed interface{}
+}
+
+// match возвращает первый совпавший профиль и непустые захваченные поля
+func (p *GrokParser) match(logLine string) (*compiledGrokProfile, map[string]grokValue) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for i := range p.profiles {
+		profile := &p.profiles[i]
+		for _, expr := range profile.expressions {
+			match := expr.re.FindStringSubmatchIndex(logLine)
+			if match == nil {
+				continue
+			}
+
+			captures := make(map[string]grokValue, len(expr.captures))
+			for group, capture := range expr.captures {
+				if capture.field == "" {
+					continue
+				}
+				start, end := match[2*group], match[2*group+1]
+				if start < 0 || start == end {
+					continue
+				}
+				if _, ok := captures[capture.field]; ok {
+					continue
+				}
+				raw := logLine[start:end]
+				captures[capture.field] = grokValue{raw: raw, typed: grokConvert(raw, capture.kind)}
+			}
+			return profile, captures
+		}
+	}
+	return nil, nil
+}
+
+// grokConvert приводит значение к типу поля (int, float)
+func grokConvert(raw, kind string) interface{} {
+	switch kind {
+	case "int":
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	}
+	return raw
+}
+
+// compileGrokProfiles компилирует выражения профилей по библиотеке шаблонов
+func compileGrokProfiles(profiles []GrokProfile, patterns map[string]string) ([]compiledGrokProfile, error) {
+	compiled := make([]compiledGrokProfile, 0, len(profiles))
+	for i, profile := range profiles {
+		if profile.Name == "" || len(profile.Match) == 0 {
+			return nil, fmt.Errorf("профиль %d: не заданы имя или выражения", i+1)
+		}
+		if len(profile.Fields) > 0 {
+			fields, err := compileFields(profile.Fields)
+			if err != nil {
+				return nil, fmt.Errorf("профиль %d (%s): %w", i+1, profile.Name, err)
+			}
+			profile.Fields = fields
+		}
+
+		cp := compiledGrokProfile{profile: profile}
+		for _, match := range profile.Match {
+			expr, err := compileGrok(match, patterns)
+			if err != nil {
+				return nil, fmt.Errorf("профиль %d (%s): %w", i+1, profile.Name, err)
+			}
+			cp.expressions = append(cp.expressions, expr)
+		}
+		compiled = append(compiled, cp)
+	}
+	return compiled, nil
+}
+
+// compileGrok раскрывает ссылки на шаблоны и компилирует выражение.
+// Группы захвата получают служебные имена g1, g2, ..., так как имена полей
+// ("client.ip") не допускаются в именах групп RE2.
+func compileGrok(expr string, patterns map[string]string) (grokExpression, error) {
+	var captures []grokCapture
+	expanded, err := expandGrok(expr, patterns, &captures, 0)
+	if err != nil {
+		return grokExpression{}, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return grokExpression{}, fmt.Errorf("выражение %q: %w", expr, err)
+	}
+
+	result := grokExpression{re: re, captures: make([]grokCapture, re.NumSubexp()+1)}
+	for group, name := range re.SubexpNames() {
+		if !strings.HasPrefix(name, "g") {
+			continue
+		}
+		n, err := strconv.Atoi(name[1:])
+		if err != nil || n < 1 || n > len(captures) {
+			continue
+		}
+		result.captures[group] = captures[n-1]
+	}
+	return result, nil
+}
+
+// expandGrok рекурсивно подставляет шаблоны в выражение
+func expandGrok(expr string, patterns map[string]string, captures *[]grokCapture, depth int) (string, error) {
+	if depth > grokMaxDepth {
+		return "", fmt.Errorf("слишком глубокая вложенность шаблонов (цикл?)")
+	}
+
+	expr = grokNamedGroup.ReplaceAllStringFunc(expr, func(group string) string {
+		name := grokNamedGroup.FindStringSubmatch(group)[1]
+		*captures = append(*captures, grokCapture{field: name})
+		return fmt.Sprintf("(?P<g%d>", len(*captures))
+	})
+
+	var err error
+	expanded := grokReference.ReplaceAllStringFunc(expr, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		sub := grokReference.FindStringSubmatch(ref)
+		pattern, ok := patterns[sub[1]]
+		if !ok {
+			err = fmt.Errorf("неизвестный шаблон %s", sub[1])
+			return ""
+		}
+
+		inner, innerErr := expandGrok(pattern, patterns, captures, depth+1)
+		if innerErr != nil {
+			err = innerErr
+			return ""
+		}
+		if sub[2] == "" {
+			return "(?:" + inner + ")"
+		}
+		*captures = append(*captures, grokCapture{field: sub[2], kind: sub[3]})
+		return fmt.Sprintf("(?P<g%d>%s)", len(*captures), inner)
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
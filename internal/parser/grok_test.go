@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+func TestGrokParser_AccessLog(t *testing.T) {
+	parser := NewGrokParser()
+
+	line := `203.0.113.9 - alice [11/Oct/2025:22:14:15 +0300] "GET /admin HTTP/1.1" 403 153 "-" "curl/8.0"`
+	if !parser.Detect(line) {
+		t.Fatal("Expected access log line to be detected")
+	}
+
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["grok_profile"] != "http-access" {
+		t.Fatalf("Expected http-access profile, got %v", event.AdditionalData["grok_profile"])
+	}
+	if event.Timestamp.UTC() != time.Date(2025, 10, 11, 19, 14, 15, 0, time.UTC) {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.Source.IPAddress != "203.0.113.9" || event.SubjectAccount == nil || event.SubjectAccount.Username != "alice" {
+		t.Errorf("Unexpected source %+v subject %+v", event.Source, event.SubjectAccount)
+	}
+	if event.Category != models.CategoryAccess || event.Result != models.ResultFailure || event.Action != "access_denied" {
+		t.Errorf("Unexpected classification %s/%s/%s", event.Category, event.Result, event.Action)
+	}
+	if event.AdditionalData["grok_response"] != int64(403) || event.AdditionalData["grok_request"] != "/admin" {
+		t.Errorf("Unexpected captures %v", event.AdditionalData)
+	}
+	if event.Description != line {
+		t.Errorf("Expected line as description, got %q", event.Description)
+	}
+
+	// Журнал без referrer и agent, анонимный пользователь
+	event, err = parser.Parse(`10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] "GET / HTTP/1.1" 200 -`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.SubjectAccount != nil || event.Result != models.ResultSuccess {
+		t.Errorf("Unexpected event %s %+v", event.Result, event.SubjectAccount)
+	}
+	if _, ok := event.AdditionalData["grok_bytes"]; ok {
+		t.Error("Expected empty bytes to be omitted")
+	}
+}
+
+func TestGrokParser_ErrorLogs(t *testing.T) {
+	parser := NewGrokParser()
+
+	event, err := parser.Parse(`2025/10/11 22:14:15 [error] 1234#0: *5 open() "/srv/www/x" failed (2: No such file or directory), client: 10.0.0.1`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.AdditionalData["grok_profile"] != "nginx-error" || event.Severity != models.SeverityHigh {
+		t.Errorf("Unexpected nginx event %v %s", event.AdditionalData["grok_profile"], event.Severity)
+	}
+	if event.Source.Application != "nginx" || event.Source.ProcessID != 1234 || !strings.HasPrefix(event.Description, "open()") {
+		t.Errorf("Unexpected nginx event %+v %q", event.Source, event.Description)
+	}
+
+	event, err = parser.Parse(`2025-10-11 22:14:15.123 MSK [2211] app@billing FATAL:  password authentication failed for user "app"`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.AdditionalData["grok_profile"] != "postgresql" || event.Severity != models.SeverityCritical {
+		t.Errorf("Unexpected postgres event %v %s", event.AdditionalData["grok_profile"], event.Severity)
+	}
+	if event.Action != "logon_failed" || event.Category != models.CategoryAuthentication {
+		t.Errorf("Unexpected classification %s/%s", event.Category, event.Action)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "app" || event.AdditionalData["grok_database"] != "billing" {
+		t.Errorf("Unexpected subject %+v %v", event.SubjectAccount, event.AdditionalData)
+	}
+}
+
+func TestGrokParser_CustomPatterns(t *testing.T) {
+	patterns, err := LoadGrokPatterns(strings.NewReader("# шаблоны приложения\nTICKET [A-Z]+-\\d+\nACTOR %{USERNAME:user.name}\n"))
+	if err != nil {
+		t.Fatalf("LoadGrokPatterns failed: %v", err)
+	}
+	profiles, err := LoadGrokProfiles(strings.NewReader(`{
+		"include_defaults": true,
+		"profiles": [{
+			"name": "tracker",
+			"match": ["^%{TIMESTAMP_ISO8601:ts} %{ACTOR} (?<verb>closed|opened) %{TICKET:ticket} in %{NUMBER:took:float}s$"],
+			"fields": {
+				"timestamp": {"path": "ts"},
+				"action": {"path": "verb"},
+				"subject.username": {"path": "user.name"}
+			}
+		}]
+	}`))
+	if err != nil {
+		t.Fatalf("LoadGrokProfiles failed: %v", err)
+	}
+
+	parser := NewGrokParser()
+	if err := parser.SetProfiles(profiles); err == nil {
+		t.Fatal("Expected error for unknown pattern TICKET")
+	}
+	if err := parser.AddPatterns(patterns); err != nil {
+		t.Fatalf("AddPatterns failed: %v", err)
+	}
+	if err := parser.SetProfiles(profiles); err != nil {
+		t.Fatalf("SetProfiles failed: %v", err)
+	}
+	if len(parser.Profiles()) != len(DefaultGrokProfiles())+1 {
+		t.Errorf("Expected defaults to be included, got %d profiles", len(parser.Profiles()))
+	}
+
+	event, err := parser.Parse(`2025-10-11T22:14:15Z j.doe closed OPS-42 in 1.5s`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Action != "closed" || event.SubjectAccount == nil || event.SubjectAccount.Username != "j.doe" {
+		t.Errorf("Unexpected event %s %+v", event.Action, event.SubjectAccount)
+	}
+	if !event.Timestamp.Equal(time.Date(2025, 10, 11, 22, 14, 15, 0, time.UTC)) || event.TimestampSynthesized {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.AdditionalData["grok_took"] != 1.5 || event.AdditionalData["grok_ticket"] != "OPS-42" {
+		t.Errorf("Unexpected captures %v", event.AdditionalData)
+	}
+
+	// Встроенные профили остаются после пользовательских
+	if !parser.Detect(`10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] "GET / HTTP/1.1" 200 612`) {
+		t.Error("Expected default profile to remain")
+	}
+}
+
+func TestGrokParser_Errors(t *testing.T) {
+	parser := NewGrokParser()
+
+	if parser.Detect("free text line") {
+		t.Error("Expected free text not to be detected")
+	}
+	if _, err := parser.Parse("free text line"); err == nil {
+		t.Error("Expected error for unmatched line")
+	}
+
+	if err := parser.AddPatterns(map[string]string{"A": "%{B}", "B": "%{A}"}); err != nil {
+		t.Fatalf("AddPatterns failed: %v", err)
+	}
+	invalid := []GrokProfile{
+		{Name: "cycle", Match: []string{"%{A}"}},
+		{Name: "regexp", Match: []string{"%{WORD:w} ("}},
+		{Name: "empty"},
+	}
+	for _, profile := range invalid {
+		if err := parser.SetProfiles([]GrokProfile{profile}); err == nil {
+			t.Errorf("Expected error for profile %s", profile.Name)
+		}
+	}
+	// Неудачная замена сохраняет прежние профили
+	if len(parser.Profiles()) != len(DefaultGrokProfiles()) {
+		t.Errorf("Expected previous profiles to remain, got %d", len(parser.Profiles()))
+	}
+
+	for _, data := range []string{"NOPATTERN\n", "bad-name x\n"} {
+		if _, err := LoadGrokPatterns(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected error for patterns %q", data)
+		}
+	}
+	if _, err := LoadGrokProfiles(strings.NewReader(`{"profiles": [{"name": "x"}]}`)); err == nil {
+		t.Error("Expected error for profile without expressions")
+	}
+}
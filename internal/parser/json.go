@@ -0,0 +1,665 @@
+package parser
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
+)
+
+//go:embed json_profiles.json
+var defaultJSONProfilesData []byte
+
+// defaultJSONProfiles - встроенные профили: ECS, journald, Docker json-file
+// и общий профиль для остальных JSON логов
+var defaultJSONProfiles []JSONProfile
+
+func init() {
+	defaultJSONProfiles = mustLoadJSONProfiles(defaultJSONProfilesData)
+}
+
+// JSONField описывает, откуда берется значение поля ГОСТ.
+//
+// Path - путь к значению через точку ("user.target.name"); альтернативы
+// перечисляются через "|" и проверяются по порядку. Ключ, содержащий точку
+// ("log.level"), находится так же, как вложенный объект. Из массива
+// берется первый элемент. Альтернатива "date+time" склеивает значения
+// нескольких путей через пробел и применяется, если найдены все они.
+//
+// Format задает разбор значения: для timestamp - unix, unix_ms, unix_us,
+// unix_ns или раскладка Go (по умолчанию RFC 3339 и числа Unix с
+// определением единиц по величине); для строк "bytes" - массив байтов
+// (так journald выводит сообщения не в UTF-8).
+//
+// Map заменяет значения (без учета регистра). Для severity, category и
+// result значение без соответствия в Map отбрасывается. Value задает
+// постоянное значение вместо Path.
+type JSONField struct {
+	Path   string            `json:"path,omitempty"`
+	Format string            `json:"format,omitempty"`
+	Map    map[string]string `json:"map,omitempty"`
+	Value  string            `json:"value,omitempty"`
+}
+
+// JSONProfile - профиль сопоставления полей JSON с полями ГОСТ. Профиль
+// применяется, если в событии есть все пути When (альтернативы через "|").
+// Ключи Fields - поля ГОСТ: timestamp, description, severity, category,
+// result, action, source.hostname, source.ip_address, source.application,
+// source.process, source.process_id, subject.username, subject.domain,
+// subject.user_id, object.username, object.domain, object.user_id.
+type JSONProfile struct {
+	Name   string               `json:"name"`
+	When   []string             `json:"when,omitempty"`
+	Fields map[string]JSONField `json:"fields"`
+}
+
+// jsonProfileFile - структура файла профилей
+type jsonProfileFile struct {
+	IncludeDefaults bool          `json:"include_defaults"`
+	Profiles        []JSONProfile `json:"profiles"`
+}
+
+// jsonTargets - поля ГОСТ, доступные профилям
+var jsonTargets = map[string]bool{
+	"timestamp": true, "description": true, "severity": true, "category": true,
+	"result": true, "action": true,
+	"source.hostname": true, "source.ip_address": true, "source.application": true,
+	"source.process": true, "source.process_id": true,
+	"subject.username": true, "subject.domain": true, "subject.user_id": true,
+	"object.username": true, "object.domain": true, "object.user_id": true,
+}
+
+// jsonEnums - допустимые значения полей-перечислений ГОСТ
+var jsonEnums = map[string][]string{
+	"severity": {
+		models.SeverityCritical, models.SeverityHigh, models.SeverityMedium,
+		models.SeverityLow, models.SeverityInfo,
+	},
+	"category": {
+		models.CategoryAuthentication, models.CategoryAuthorization, models.CategoryAccess,
+		models.CategoryDataModification, models.CategorySystemEvent, models.CategorySecurityEvent,
+		models.CategoryNetworkEvent,
+	},
+	"result": {models.ResultSuccess, models.ResultFailure, models.ResultUnknown},
+}
+
+// DefaultJSONProfiles возвращает копию встроенных профилей
+func DefaultJSONProfiles() []JSONProfile {
+	return append([]JSONProfile(nil), defaultJSONProfiles...)
+}
+
+// LoadJSONProfiles читает профили в формате JSON. При "include_defaults":
+// true встроенные профили добавляются после пользовательских.
+func LoadJSONProfiles(r io.Reader) ([]JSONProfile, error) {
+	profiles, err := decodeProfiles(r, defaultJSONProfiles)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения профилей JSON: %w", err)
+	}
+	return profiles, nil
+}
+
+// decodeProfiles читает и проверяет файл профилей; defaults добавляются
+// при "include_defaults": true
+func decodeProfiles(r io.Reader, defaults []JSONProfile) ([]JSONProfile, error) {
+	var file jsonProfileFile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]JSONProfile, 0, len(file.Profiles))
+	for i, profile := range file.Profiles {
+		if err := compileJSONProfile(&profile); err != nil {
+			return nil, fmt.Errorf("профиль %d (%s): %w", i+1, profile.Name, err)
+		}
+		profiles = append(profiles, profile)
+	}
+	if file.IncludeDefaults {
+		profiles = append(profiles, defaults...)
+	}
+
+	return profiles, nil
+}
+
+// LoadJSONProfilesFile читает профили из файла
+func LoadJSONProfilesFile(path string) ([]JSONProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла профилей JSON: %w", err)
+	}
+	defer file.Close()
+
+	return LoadJSONProfiles(file)
+}
+
+// compileJSONProfile проверяет профиль и приводит ключи Map к нижнему
+// регистру
+func compileJSONProfile(profile *JSONProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("не задано имя профиля")
+	}
+	fields, err := compileFields(profile.Fields)
+	if err != nil {
+		return err
+	}
+	profile.Fields = fields
+
+	return nil
+}
+
+// compileFields проверяет сопоставление полей ГОСТ и приводит ключи Map к
+// нижнему регистру
+func compileFields(profileFields map[string]JSONField) (map[string]JSONField, error) {
+	if len(profileFields) == 0 {
+		return nil, fmt.Errorf("профиль не задает ни одного поля")
+	}
+
+	fields := make(map[string]JSONField, len(profileFields))
+	for target, field := range profileFields {
+		if !jsonTargets[target] {
+			return nil, fmt.Errorf("неизвестное поле ГОСТ: %s", target)
+		}
+		if field.Path == "" && field.Value == "" {
+			return nil, fmt.Errorf("поле %s: не задан путь или значение", target)
+		}
+		if err := validateJSONFormat(target, field.Format); err != nil {
+			return nil, fmt.Errorf("поле %s: %w", target, err)
+		}
+
+		if field.Map != nil {
+			mapped := make(map[string]string, len(field.Map))
+			for from, to := range field.Map {
+				mapped[strings.ToLower(from)] = to
+			}
+			field.Map = mapped
+		}
+
+		if allowed, ok := jsonEnums[target]; ok {
+			values := []string{field.Value}
+			for _, to := range field.Map {
+				values = append(values, to)
+			}
+			for _, value := range values {
+				if value != "" && !containsString(allowed, value) {
+					return nil, fmt.Errorf("поле %s: недопустимое значение %s", target, value)
+				}
+			}
+		}
+
+		fields[target] = field
+	}
+
+	return fields, nil
+}
+
+// validateJSONFormat проверяет, что формат применим к полю
+func validateJSONFormat(target, format string) error {
+	switch {
+	case format == "":
+		return nil
+	case target == "timestamp":
+		return nil
+	case format == "bytes" && target != "source.process_id":
+		return nil
+	}
+	return fmt.Errorf("формат %q не применим", format)
+}
+
+func mustLoadJSONProfiles(data []byte) []JSONProfile {
+	profiles, err := LoadJSONProfiles(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("встроенные профили JSON: %v", err))
+	}
+	return profiles
+}
+
+// JSONParser разбирает JSON логи (по одному объекту в строке) по профилям
+// сопоставления полей
+type JSONParser struct {
+	mu       sync.RWMutex
+	profiles []JSONProfile
+	rules    *rules.Engine
+	time     *timeConfig
+}
+
+func NewJSONParser() *JSONParser {
+	return &JSONParser{profiles: defaultJSONProfiles, rules: rules.Default(), time: newTimeConfig()}
+}
+
+// SetProfiles задает профили сопоставления; профили проверяются по
+// порядку, применяется первый подходящий
+func (p *JSONParser) SetProfiles(profiles []JSONProfile) error {
+	compiled := make([]JSONProfile, len(profiles))
+	for i, profile := range profiles {
+		if err := compileJSONProfile(&profile); err != nil {
+			return fmt.Errorf("профиль %d (%s): %w", i+1, profile.Name, err)
+		}
+		compiled[i] = profile
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profiles = compiled
+	return nil
+}
+
+// Profiles возвращает копию текущих профилей
+func (p *JSONParser) Profiles() []JSONProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]JSONProfile(nil), p.profiles...)
+}
+
+// SetTimezone задает часовой пояс для меток времени без смещения
+func (p *JSONParser) SetTimezone(loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.location = loc
+}
+
+// SetHostTimezone задает часовой пояс отдельного хоста
+func (p *JSONParser) SetHostTimezone(host string, loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.hosts[strings.ToLower(host)] = loc
+}
+
+// SetRules задает правила классификации событий
+func (p *JSONParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, является ли строка JSON объектом
+func (p *JSONParser) Detect(logLine string) bool {
+	return strings.HasPrefix(logLine, "{") && strings.HasSuffix(logLine, "}")
+}
+
+// Parse парсит JSON объект и возвращает GOSTEvent
+func (p *JSONParser) Parse(logLine string) (*models.GOSTEvent, error) {
+	decoder := json.NewDecoder(strings.NewReader(logLine))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("ошибка парсинга JSON: лишние данные после объекта")
+	}
+
+	p.mu.RLock()
+	profile := selectJSONProfile(p.profiles, object)
+	p.mu.RUnlock()
+	if profile == nil {
+		return nil, fmt.Errorf("нет подходящего профиля JSON")
+	}
+
+	event := &models.GOSTEvent{
+		EventID:        uuid.New().String(),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         models.ResultUnknown,
+		AdditionalData: make(map[string]interface{}),
+	}
+	descriptionPath := applyFields(event, profile.Fields, object, p.time)
+	if event.Description == "" {
+		event.Description = logLine
+	}
+
+	flattenJSON("", object, event.AdditionalData, descriptionPath)
+	event.AdditionalData["json_profile"] = profile.Name
+
+	p.rules.Apply("json", event)
+
+	return event, nil
+}
+
+// selectJSONProfile возвращает первый профиль, условия которого выполнены
+func selectJSONProfile(profiles []JSONProfile, object map[string]interface{}) *JSONProfile {
+	for i := range profiles {
+		matched := true
+		for _, path := range profiles[i].When {
+			if _, ok := lookupJSON(object, path); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &profiles[i]
+		}
+	}
+	return nil
+}
+
+// applyFields заполняет поля события по сопоставлению fields и возвращает
+// путь, из которого взято описание
+func applyFields(event *models.GOSTEvent, fields map[string]JSONField, object map[string]interface{}, tc *timeConfig) string {
+	var subject, target models.Account
+	var descriptionPath string
+
+	// Хост нужен раньше метки времени для выбора часового пояса
+	targets := make([]string, 0, len(fields))
+	for name := range fields {
+		targets = append(targets, name)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i] != "timestamp" && (targets[j] == "timestamp" || targets[i] < targets[j])
+	})
+
+	for _, name := range targets {
+		field := fields[name]
+
+		raw, path, ok := resolveJSONField(object, field)
+		if !ok {
+			continue
+		}
+
+		if name == "timestamp" {
+			if t, err := fieldTime(tc, raw, field.Format, event.Source.Hostname); err == nil {
+				event.Timestamp = t
+			}
+			continue
+		}
+
+		value, ok := jsonString(raw, field.Format)
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if field.Map != nil {
+			if mapped, ok := field.Map[strings.ToLower(value)]; ok {
+				value = mapped
+			} else if _, enum := jsonEnums[name]; enum {
+				continue
+			}
+		}
+		if value == "" {
+			continue
+		}
+		if allowed, enum := jsonEnums[name]; enum && !containsString(allowed, value) {
+			continue
+		}
+
+		switch name {
+		case "description":
+			event.Description = value
+			descriptionPath = path
+		case "severity":
+			event.Severity = value
+		case "category":
+			event.Category = value
+		case "result":
+			event.Result = value
+		case "action":
+			event.Action = value
+		case "source.hostname":
+			event.Source.Hostname = value
+		case "source.ip_address":
+			event.Source.IPAddress = value
+		case "source.application":
+			event.Source.Application = value
+		case "source.process":
+			event.Source.Process = value
+		case "source.process_id":
+			if pid, err := strconv.ParseFloat(value, 64); err == nil && pid > 0 && pid <= math.MaxInt32 {
+				event.Source.ProcessID = int(pid)
+			}
+		case "subject.username":
+			subject.Username = value
+		case "subject.domain":
+			subject.Domain = value
+		case "subject.user_id":
+			subject.UserID = value
+		case "object.username":
+			target.Username = value
+		case "object.domain":
+			target.Domain = value
+		case "object.user_id":
+			target.UserID = value
+		}
+	}
+
+	if subject != (models.Account{}) {
+		event.SubjectAccount = &subject
+	}
+	if target != (models.Account{}) {
+		event.ObjectAccount = &target
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+		event.TimestampSynthesized = true
+	}
+
+	return descriptionPath
+}
+
+// resolveJSONField возвращает значение поля профиля и путь, по которому
+// оно найдено
+func resolveJSONField(object map[string]interface{}, field JSONField) (interface{}, string, bool) {
+	if field.Path == "" {
+		return field.Value, "", true
+	}
+	for _, path := range strings.Split(field.Path, "|") {
+		value, ok := lookupJSONJoined(object, path)
+		if !ok {
+			continue
+		}
+		if _, isObject := value.(map[string]interface{}); isObject {
+			continue
+		}
+		return value, path, true
+	}
+	if field.Value != "" {
+		return field.Value, "", true
+	}
+	return nil, "", false
+}
+
+// lookupJSONJoined ищет значение по пути; значения путей, перечисленных
+// через "+", склеиваются через пробел
+func lookupJSONJoined(object map[string]interface{}, path string) (interface{}, bool) {
+	if !strings.Contains(path, "+") {
+		return lookupJSONPath(object, path)
+	}
+
+	parts := strings.Split(path, "+")
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		value, ok := lookupJSONPath(object, part)
+		if !ok {
+			return nil, false
+		}
+		s, ok := jsonString(value, "")
+		if !ok {
+			return nil, false
+		}
+		values = append(values, s)
+	}
+	return strings.Join(values, " "), true
+}
+
+// lookupJSON ищет значение по пути с альтернативами через "|"
+func lookupJSON(object map[string]interface{}, path string) (interface{}, bool) {
+	for _, alt := range strings.Split(path, "|") {
+		if value, ok := lookupJSONJoined(object, alt); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// lookupJSONPath ищет значение по пути через точку. Сначала проверяется ключ
+// целиком, затем вложенные объекты по каждой точке, поэтому "log.level"
+// находит и {"log.level": ...}, и {"log": {"level": ...}}.
+func lookupJSONPath(object map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := object[path]; ok && value != nil {
+		return value, true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		child, ok := object[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := lookupJSONPath(child, path[i+1:]); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// jsonString приводит значение к строке; из массива берется первый
+// скалярный элемент, формат "bytes" собирает строку из массива байтов
+func jsonString(value interface{}, format string) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		if format == "bytes" {
+			if s, ok := jsonBytes(v); ok {
+				return s, true
+			}
+		}
+		for _, item := range v {
+			if s, ok := jsonString(item, ""); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// jsonBytes собирает строку из массива чисел 0-255
+func jsonBytes(items []interface{}) (string, bool) {
+	data := make([]byte, 0, len(items))
+	for _, item := range items {
+		n, ok := item.(json.Number)
+		if !ok {
+			return "", false
+		}
+		b, err := strconv.ParseUint(n.String(), 10, 8)
+		if err != nil {
+			return "", false
+		}
+		data = append(data, byte(b))
+	}
+	return strings.ToValidUTF8(string(data), string(utf8.RuneError)), true
+}
+
+// fieldTime разбирает метку времени: строку в формате RFC 3339 или
+// раскладке format либо число секунд (миллисекунд, ...) Unix
+func fieldTime(tc *timeConfig, value interface{}, format, host string) (time.Time, error) {
+	s, ok := jsonString(value, "")
+	if !ok || s == "" {
+		return time.Time{}, fmt.Errorf("пустая метка времени")
+	}
+
+	switch format {
+	case "unix", "unix_ms", "unix_us", "unix_ns":
+		return unixTime(s, format)
+	case "":
+	default:
+		return time.ParseInLocation(format, s, tc.locationFor(host))
+	}
+
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return unixTime(s, "")
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	loc := tc.locationFor(host)
+	for _, layout := range []string{isoLocalLayout, isoLocalSepLayout, isoLocalSepLayout + ".999999999"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("невозможно распарсить время: %s", s)
+}
+
+// unixTime переводит число Unix в единицах format во время; без формата
+// единицы определяются по величине числа
+func unixTime(s, format string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, fmt.Errorf("неверная метка времени Unix: %s", s)
+	}
+
+	if format == "" {
+		switch {
+		case seconds < 1e11:
+			format = "unix"
+		case seconds < 1e14:
+			format = "unix_ms"
+		case seconds < 1e17:
+			format = "unix_us"
+		default:
+			format = "unix_ns"
+		}
+	}
+
+	// Целые значения переводятся без потери точности float64
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch format {
+		case "unix":
+			return time.Unix(n, 0).UTC(), nil
+		case "unix_ms":
+			return time.UnixMilli(n).UTC(), nil
+		case "unix_us":
+			return time.UnixMicro(n).UTC(), nil
+		default:
+			return time.Unix(0, n).UTC(), nil
+		}
+	}
+
+	scale := map[string]float64{"unix": 1e9, "unix_ms": 1e6, "unix_us": 1e3, "unix_ns": 1}[format]
+	return time.Unix(0, int64(seconds*scale)).UTC(), nil
+}
+
+// flattenJSON записывает значения объекта в AdditionalData с ключами
+// json_путь.через.точку; значение по пути skip пропускается
+func flattenJSON(prefix string, object map[string]interface{}, data map[string]interface{}, skip string) {
+	for key, value := range object {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if path == skip {
+			continue
+		}
+		if child, ok := value.(map[string]interface{}); ok {
+			flattenJSON(path, child, data, skip)
+			continue
+		}
+		data["json_"+path] = value
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+func TestJSONParser_Docker(t *testing.T) {
+	parser := NewJSONParser()
+
+	event, err := parser.Parse(`{"log":"GET /health 200\n","stream":"stdout","time":"2025-10-11T22:14:15.123456789Z","attrs":{"tag":"web"}}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["json_profile"] != "docker" {
+		t.Errorf("Expected docker profile, got %v", event.AdditionalData["json_profile"])
+	}
+	if event.Description != "GET /health 200" {
+		t.Errorf("Unexpected description %q", event.Description)
+	}
+	want := time.Date(2025, 10, 11, 22, 14, 15, 123456789, time.UTC)
+	if !event.Timestamp.Equal(want) || event.TimestampSynthesized {
+		t.Errorf("Expected %v, got %v", want, event.Timestamp)
+	}
+	if event.Source.Application != "web" || event.AdditionalData["json_stream"] != "stdout" {
+		t.Errorf("Unexpected source %+v, data %v", event.Source, event.AdditionalData)
+	}
+	// Текст сообщения не дублируется в AdditionalData
+	if _, ok := event.AdditionalData["json_log"]; ok {
+		t.Error("Expected json_log to be omitted")
+	}
+}
+
+func TestJSONParser_Journald(t *testing.T) {
+	parser := NewJSONParser()
+
+	line := `{"__REALTIME_TIMESTAMP":"1760220855123456","_HOSTNAME":"srv01","SYSLOG_IDENTIFIER":"sshd","_PID":"4242","_UID":"0","PRIORITY":"3","MESSAGE":[102,97,105,108,101,100,32,255]}`
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["json_profile"] != "journald" {
+		t.Errorf("Expected journald profile, got %v", event.AdditionalData["json_profile"])
+	}
+	if !event.Timestamp.Equal(time.UnixMicro(1760220855123456)) {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.Source.Hostname != "srv01" || event.Source.Application != "sshd" || event.Source.ProcessID != 4242 {
+		t.Errorf("Unexpected source %+v", event.Source)
+	}
+	if event.Severity != models.SeverityHigh {
+		t.Errorf("Expected ВЫСОКИЙ, got %s", event.Severity)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.UserID != "0" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+	if !strings.HasPrefix(event.Description, "failed ") {
+		t.Errorf("Expected decoded byte message, got %q", event.Description)
+	}
+}
+
+func TestJSONParser_ECS(t *testing.T) {
+	parser := NewJSONParser()
+
+	line := `{"@timestamp":"2025-10-11T22:14:15.003+03:00","ecs":{"version":"8.11.0"},"message":"User added to group",` +
+		`"log":{"level":"warning"},"event":{"category":["iam"],"action":"added-user-to-group","outcome":"success"},` +
+		`"host":{"name":"dc01"},"source":{"ip":"192.0.2.10"},"user":{"name":"admin","domain":"EXAMPLE","target":{"name":"john"}}}`
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["json_profile"] != "ecs" {
+		t.Errorf("Expected ecs profile, got %v", event.AdditionalData["json_profile"])
+	}
+	if event.Timestamp.UTC() != time.Date(2025, 10, 11, 19, 14, 15, 3000000, time.UTC) {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.Category != models.CategoryAuthorization || event.Severity != models.SeverityMedium || event.Result != models.ResultSuccess {
+		t.Errorf("Unexpected classification %s/%s/%s", event.Category, event.Severity, event.Result)
+	}
+	if event.Action != "added-user-to-group" || event.Source.Hostname != "dc01" || event.Source.IPAddress != "192.0.2.10" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "admin" || event.SubjectAccount.Domain != "EXAMPLE" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+	if event.ObjectAccount == nil || event.ObjectAccount.Username != "john" {
+		t.Errorf("Unexpected object %+v", event.ObjectAccount)
+	}
+	if event.AdditionalData["json_ecs.version"] != "8.11.0" {
+		t.Errorf("Expected flattened json_ecs.version, got %v", event.AdditionalData)
+	}
+}
+
+func TestJSONParser_Generic(t *testing.T) {
+	parser := NewJSONParser()
+
+	// Плоский ключ с точкой и метка времени Unix в миллисекундах
+	event, err := parser.Parse(`{"ts":1760220855123,"log.level":"ERROR","msg":"db timeout","service":"billing","pid":77}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.AdditionalData["json_profile"] != "generic" {
+		t.Errorf("Expected generic profile, got %v", event.AdditionalData["json_profile"])
+	}
+	if !event.Timestamp.Equal(time.UnixMilli(1760220855123)) {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.Severity != models.SeverityHigh || event.Description != "db timeout" {
+		t.Errorf("Unexpected event %s %q", event.Severity, event.Description)
+	}
+	if event.Source.Application != "billing" || event.Source.ProcessID != 77 {
+		t.Errorf("Unexpected source %+v", event.Source)
+	}
+
+	// Без метки времени и сообщения
+	event, err = parser.Parse(`{"foo":"bar"}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !event.TimestampSynthesized || event.Description != `{"foo":"bar"}` {
+		t.Errorf("Unexpected fallback event %+v", event)
+	}
+
+	if _, err := parser.Parse(`{"foo":`); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+func TestJSONParser_CustomProfiles(t *testing.T) {
+	profiles, err := LoadJSONProfiles(strings.NewReader(`{"include_defaults": true, "profiles": [
+		{"name": "auth-app", "when": ["app_id"], "fields": {
+			"timestamp": {"path": "when", "format": "2006-01-02 15:04:05"},
+			"description": {"path": "text"},
+			"category": {"value": "АУТЕНТИФИКАЦИЯ"},
+			"result": {"path": "ok", "map": {"true": "УСПЕХ", "false": "НЕУСПЕХ"}},
+			"source.hostname": {"path": "node"},
+			"subject.username": {"path": "who"}
+		}}
+	]}`))
+	if err != nil {
+		t.Fatalf("LoadJSONProfiles failed: %v", err)
+	}
+	if len(profiles) != len(DefaultJSONProfiles())+1 {
+		t.Errorf("Expected defaults to be included, got %d profiles", len(profiles))
+	}
+
+	parser := NewJSONParser()
+	if err := parser.SetProfiles(profiles); err != nil {
+		t.Fatalf("SetProfiles failed: %v", err)
+	}
+	parser.SetHostTimezone("auth01", time.FixedZone("MSK", 3*3600))
+
+	event, err := parser.Parse(`{"app_id":1,"when":"2025-10-11 22:14:15","text":"login","ok":false,"node":"auth01","who":"bob"}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Category != models.CategoryAuthentication || event.Result != models.ResultFailure {
+		t.Errorf("Unexpected classification %s/%s", event.Category, event.Result)
+	}
+	if event.Timestamp.UTC() != time.Date(2025, 10, 11, 19, 14, 15, 0, time.UTC) {
+		t.Errorf("Expected host timezone to apply, got %v", event.Timestamp)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "bob" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+
+	// Остальные строки по-прежнему разбираются встроенными профилями
+	event, _ = parser.Parse(`{"log":"x","stream":"stderr","time":"2025-10-11T22:14:15Z"}`)
+	if event.AdditionalData["json_profile"] != "docker" {
+		t.Errorf("Expected docker profile, got %v", event.AdditionalData["json_profile"])
+	}
+}
+
+func TestLoadJSONProfiles_Invalid(t *testing.T) {
+	tests := []string{
+		`{"profiles": [{"name": "x", "fields": {"severity": {"path": "lvl", "map": {"e": "ОШИБКА"}}}}]}`,
+		`{"profiles": [{"name": "x", "fields": {"source.port": {"path": "port"}}}]}`,
+		`{"profiles": [{"name": "x", "fields": {"description": {}}}]}`,
+		`{"profiles": [{"fields": {"description": {"path": "msg"}}}]}`,
+		`{"profiles": [{"name": "x", "fields": {"description": {"path": "msg"}}, "unknown": 1}]}`,
+	}
+	for _, data := range tests {
+		if _, err := LoadJSONProfiles(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+}
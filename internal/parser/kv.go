@@ -0,0 +1,399 @@
+package parser
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
+)
+
+//go:embed kv_profiles.json
+var defaultKVProfilesData []byte
+
+// defaultKVProfiles - встроенные профили: FortiGate и общий профиль logfmt
+var defaultKVProfiles []KVProfile
+
+func init() {
+	defaultKVProfiles = mustLoadKVProfiles(defaultKVProfilesData)
+}
+
+// KVProfile - профиль сопоставления пар ключ=значение с полями ГОСТ. Профиль
+// устроен так же, как JSONProfile; путь - имя ключа, "date+time" склеивает
+// значения нескольких ключей.
+type KVProfile = JSONProfile
+
+// kvKeyPattern - допустимый ключ при автоопределении формата
+var kvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// kvSyslogSeverities - критичность по уровню syslog из PRI
+var kvSyslogSeverities = [8]string{
+	models.SeverityCritical, models.SeverityCritical, models.SeverityCritical,
+	models.SeverityHigh, models.SeverityMedium, models.SeverityLow,
+	models.SeverityLow, models.SeverityInfo,
+}
+
+// Способ, которым пары обернуты в syslog
+const (
+	kvPlain = iota
+	kvSyslog
+	kvSyslogShort
+)
+
+// DefaultKVProfiles возвращает копию встроенных профилей
+func DefaultKVProfiles() []KVProfile {
+	return append([]KVProfile(nil), defaultKVProfiles...)
+}
+
+// LoadKVProfiles читает профили в формате JSON (как LoadJSONProfiles). При
+// "include_defaults": true встроенные профили добавляются после
+// пользовательских.
+func LoadKVProfiles(r io.Reader) ([]KVProfile, error) {
+	profiles, err := decodeProfiles(r, defaultKVProfiles)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения профилей KV: %w", err)
+	}
+	return profiles, nil
+}
+
+// LoadKVProfilesFile читает профили из файла
+func LoadKVProfilesFile(path string) ([]KVProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла профилей KV: %w", err)
+	}
+	defer file.Close()
+
+	return LoadKVProfiles(file)
+}
+
+func mustLoadKVProfiles(data []byte) []KVProfile {
+	profiles, err := LoadKVProfiles(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("встроенные профили KV: %v", err))
+	}
+	return profiles
+}
+
+// KVParser разбирает строки из пар ключ=значение (logfmt, FortiGate и
+// т.п.), в том числе обернутые в syslog
+type KVParser struct {
+	mu             sync.RWMutex
+	profiles       []KVProfile
+	pairSeparator  string
+	valueSeparator string
+	rules          *rules.Engine
+	time           *timeConfig
+	syslog         *SyslogParser
+}
+
+func NewKVParser() *KVParser {
+	tc := newTimeConfig()
+	return &KVParser{
+		profiles:       defaultKVProfiles,
+		valueSeparator: "=",
+		rules:          rules.Default(),
+		time:           tc,
+		syslog:         &SyslogParser{rules: rules.Default(), time: tc},
+	}
+}
+
+// SetProfiles задает профили сопоставления; профили проверяются по
+// порядку, применяется первый подходящий
+func (p *KVParser) SetProfiles(profiles []KVProfile) error {
+	compiled := make([]KVProfile, len(profiles))
+	for i, profile := range profiles {
+		if err := compileJSONProfile(&profile); err != nil {
+			return fmt.Errorf("профиль %d (%s): %w", i+1, profile.Name, err)
+		}
+		compiled[i] = profile
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profiles = compiled
+	return nil
+}
+
+// Profiles возвращает копию текущих профилей
+func (p *KVParser) Profiles() []KVProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]KVProfile(nil), p.profiles...)
+}
+
+// SetSeparators задает разделитель пар (пустая строка - пробелы и
+// табуляции) и разделитель ключа и значения (по умолчанию "=")
+func (p *KVParser) SetSeparators(pair, value string) error {
+	if value == "" {
+		return fmt.Errorf("не задан разделитель ключа и значения")
+	}
+	if pair == value {
+		return fmt.Errorf("разделители пар и значений совпадают: %q", pair)
+	}
+	if strings.ContainsAny(pair+value, `"'`) {
+		return fmt.Errorf("разделитель не может содержать кавычки")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pairSeparator = pair
+	p.valueSeparator = value
+	return nil
+}
+
+// SetTimezone задает часовой пояс для меток времени без смещения
+func (p *KVParser) SetTimezone(loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.location = loc
+}
+
+// SetHostTimezone задает часовой пояс отдельного хоста
+func (p *KVParser) SetHostTimezone(host string, loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.hosts[strings.ToLower(host)] = loc
+}
+
+// SetRules задает правила классификации событий
+func (p *KVParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, состоит ли строка (или MSG syslog) только из пар
+// ключ=значение; пар должно быть не меньше двух
+func (p *KVParser) Detect(logLine string) bool {
+	pairSep, valueSep := p.separators()
+	_, _, ok := kvPayload(logLine, func(s string) bool {
+		pairs := splitKV(s, pairSep, valueSep)
+		if len(pairs) < 2 {
+			return false
+		}
+		for _, pair := range pairs {
+			if pair.bare || !kvKeyPattern.MatchString(pair.key) {
+				return false
+			}
+		}
+		return true
+	})
+	return ok
+}
+
+// Parse парсит строку из пар ключ=значение и возвращает GOSTEvent
+func (p *KVParser) Parse(logLine string) (*models.GOSTEvent, error) {
+	pairSep, valueSep := p.separators()
+
+	var object map[string]interface{}
+	wrap, payload, ok := kvPayload(logLine, func(s string) bool {
+		object = kvObject(splitKV(s, pairSep, valueSep))
+		return len(object) > 0
+	})
+	if !ok {
+		return nil, fmt.Errorf("строка не содержит пар ключ%sзначение", valueSep)
+	}
+
+	event, err := p.newEvent(logLine, wrap)
+	if err != nil {
+		return nil, err
+	}
+	event.Description = payload
+	// Метка времени из пар точнее подставленной при разборе заголовка
+	if event.TimestampSynthesized {
+		event.Timestamp = time.Time{}
+		event.TimestampSynthesized = false
+	}
+
+	p.mu.RLock()
+	profile := selectJSONProfile(p.profiles, object)
+	p.mu.RUnlock()
+
+	descriptionKey := ""
+	if profile != nil {
+		descriptionKey = applyFields(event, profile.Fields, object, p.time)
+		event.AdditionalData["kv_profile"] = profile.Name
+	} else if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+		event.TimestampSynthesized = true
+	}
+
+	for key, value := range object {
+		if key != descriptionKey {
+			event.AdditionalData["kv_"+key] = value
+		}
+	}
+
+	p.rules.Apply("kv", event)
+
+	return event, nil
+}
+
+func (p *KVParser) separators() (string, string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pairSeparator, p.valueSeparator
+}
+
+// newEvent создает событие; для строки в syslog поля заголовка переносятся
+// в событие
+func (p *KVParser) newEvent(logLine string, wrap int) (*models.GOSTEvent, error) {
+	switch wrap {
+	case kvSyslog:
+		event, err := p.syslog.parseMessage(logLine)
+		if err != nil {
+			return nil, err
+		}
+		event.Severity = kvSyslogSeverities[event.AdditionalData["syslog_severity"].(int)]
+		return event, nil
+	case kvSyslogShort:
+		event, ok := p.syslog.parseShort(logLine)
+		if !ok {
+			return nil, fmt.Errorf("неподдерживаемый формат syslog")
+		}
+		event.Severity = kvSyslogSeverities[event.AdditionalData["syslog_severity"].(int)]
+		return event, nil
+	}
+
+	return &models.GOSTEvent{
+		EventID:        uuid.New().String(),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         models.ResultUnknown,
+		AdditionalData: make(map[string]interface{}),
+	}, nil
+}
+
+// kvPayload возвращает часть строки с парами и способ, которым она обернута
+// в syslog. accept проверяет, что кандидат состоит из пар.
+func kvPayload(logLine string, accept func(string) bool) (int, string, bool) {
+	if !strings.HasPrefix(logLine, "<") {
+		return kvPlain, logLine, accept(logLine)
+	}
+
+	if match := RFC5424Pattern.FindStringSubmatch(logLine); match != nil {
+		if _, msg, err := parseStructuredData(match[8]); err == nil && accept(msg) {
+			return kvSyslog, msg, true
+		}
+	} else if match := RFC3164Pattern.FindStringSubmatch(logLine); match != nil && accept(match[7]) {
+		return kvSyslog, match[7], true
+	}
+	if match := syslogShortPattern.FindStringSubmatch(logLine); match != nil && accept(match[4]) {
+		return kvSyslogShort, match[4], true
+	}
+	return kvPlain, "", false
+}
+
+// kvPair - пара ключ=значение; bare - слово без разделителя значения
+type kvPair struct {
+	key   string
+	value string
+	bare  bool
+}
+
+// splitKV разбирает строку на пары. Значения в двойных или одинарных
+// кавычках могут содержать разделители, \" и \\ внутри кавычек
+// экранируются.
+func splitKV(s, pairSep, valueSep string) []kvPair {
+	var pairs []kvPair
+	i := 0
+	for i < len(s) {
+		if n := kvSeparatorLen(s[i:], pairSep); n > 0 {
+			i += n
+			continue
+		}
+
+		start := i
+		for i < len(s) && !strings.HasPrefix(s[i:], valueSep) && kvSeparatorLen(s[i:], pairSep) == 0 {
+			i++
+		}
+		key := strings.TrimSpace(s[start:i])
+		if !strings.HasPrefix(s[i:], valueSep) {
+			pairs = append(pairs, kvPair{key: key, bare: true})
+			continue
+		}
+		i += len(valueSep)
+
+		if pairSep != "" {
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+				i++
+			}
+		}
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			if value, n, ok := unquoteKV(s[i:]); ok {
+				pairs = append(pairs, kvPair{key: key, value: value})
+				i += n
+				continue
+			}
+		}
+
+		start = i
+		for i < len(s) && kvSeparatorLen(s[i:], pairSep) == 0 {
+			i++
+		}
+		value := s[start:i]
+		if pairSep != "" {
+			value = strings.TrimSpace(value)
+		}
+		pairs = append(pairs, kvPair{key: key, value: value})
+	}
+	return pairs
+}
+
+// kvSeparatorLen возвращает длину разделителя пар в начале s
+func kvSeparatorLen(s, pairSep string) int {
+	if pairSep == "" {
+		if s[0] == ' ' || s[0] == '\t' {
+			return 1
+		}
+		return 0
+	}
+	if strings.HasPrefix(s, pairSep) {
+		return len(pairSep)
+	}
+	return 0
+}
+
+// unquoteKV читает значение в кавычках и возвращает его и длину вместе с
+// кавычками
+func unquoteKV(s string) (string, int, bool) {
+	quote := s[0]
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\') {
+			value.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		if c == quote {
+			return value.String(), i + 1, true
+		}
+		value.WriteByte(c)
+	}
+	return "", 0, false
+}
+
+// kvObject собирает пары в объект для профилей; значения повторяющихся
+// ключей объединяются через запятую
+func kvObject(pairs []kvPair) map[string]interface{} {
+	object := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		if pair.bare || pair.key == "" {
+			continue
+		}
+		if prev, ok := object[pair.key]; ok {
+			object[pair.key] = prev.(string) + "," + pair.value
+			continue
+		}
+		object[pair.key] = pair.value
+	}
+	return object
+}
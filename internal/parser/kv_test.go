@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+func TestKVParser_Logfmt(t *testing.T) {
+	parser := NewKVParser()
+
+	line := `ts=2025-10-11T22:14:15.003Z level=warn msg="disk \"data\" almost full" service=storage pid=812 user=backup path=/srv/data path=/srv/logs`
+	if !parser.Detect(line) {
+		t.Fatal("Expected logfmt line to be detected")
+	}
+
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["kv_profile"] != "generic" {
+		t.Errorf("Expected generic profile, got %v", event.AdditionalData["kv_profile"])
+	}
+	if !event.Timestamp.Equal(time.Date(2025, 10, 11, 22, 14, 15, 3000000, time.UTC)) {
+		t.Errorf("Unexpected timestamp %v", event.Timestamp)
+	}
+	if event.Description != `disk "data" almost full` || event.Severity != models.SeverityMedium {
+		t.Errorf("Unexpected event %q %s", event.Description, event.Severity)
+	}
+	if event.Source.Application != "storage" || event.Source.ProcessID != 812 {
+		t.Errorf("Unexpected source %+v", event.Source)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "backup" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+	if event.AdditionalData["kv_path"] != "/srv/data,/srv/logs" {
+		t.Errorf("Expected repeated keys to be joined, got %v", event.AdditionalData["kv_path"])
+	}
+	if _, ok := event.AdditionalData["kv_msg"]; ok {
+		t.Error("Expected kv_msg to be omitted")
+	}
+}
+
+func TestKVParser_FortiGate(t *testing.T) {
+	parser := NewKVParser()
+	parser.SetHostTimezone("FGT60E", time.FixedZone("MSK", 3*3600))
+
+	// FortiGate отправляет пары сразу после PRI, без заголовка syslog
+	line := `<189>date=2025-10-11 time=22:14:15 devname="FGT60E" devid="FGT60E4Q16000000" logid="0000000013" type="traffic" subtype="forward" level="notice" srcip=10.1.1.5 srcport=51234 dstip=203.0.113.7 dstport=443 action="deny" user="jdoe" group="VPN Users" policyid=12`
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.AdditionalData["kv_profile"] != "fortigate" {
+		t.Fatalf("Expected fortigate profile, got %v", event.AdditionalData["kv_profile"])
+	}
+	if event.Timestamp.UTC() != time.Date(2025, 10, 11, 19, 14, 15, 0, time.UTC) {
+		t.Errorf("Expected date+time in host timezone, got %v", event.Timestamp)
+	}
+	if event.Source.Hostname != "FGT60E" || event.Source.IPAddress != "10.1.1.5" {
+		t.Errorf("Unexpected source %+v", event.Source)
+	}
+	if event.Category != models.CategoryNetworkEvent || event.Result != models.ResultFailure || event.Action != "deny" {
+		t.Errorf("Unexpected classification %s/%s/%s", event.Category, event.Result, event.Action)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "jdoe" || event.SubjectAccount.Domain != "VPN Users" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+	if event.AdditionalData["kv_dstip"] != "203.0.113.7" || event.AdditionalData["syslog_facility"] != 23 {
+		t.Errorf("Unexpected additional data %v", event.AdditionalData)
+	}
+
+	// Вход администратора: категорию и действие задают правила
+	event, err = parser.Parse(`date=2025-10-11 time=22:15:00 devname="FGT60E" devid="FGT60E4Q16000000" logid="0100032002" type="event" subtype="system" level="alert" user="admin" ui="https(198.51.100.9)" action="login" status="failed" reason="passwd_invalid" msg="Administrator admin login failed from https(198.51.100.9) because of invalid password"`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Category != models.CategoryAuthentication || event.Action != "logon_failed" || event.Result != models.ResultFailure {
+		t.Errorf("Unexpected classification %s/%s/%s", event.Category, event.Action, event.Result)
+	}
+	if event.Severity != models.SeverityCritical || !strings.HasPrefix(event.Description, "Administrator admin login failed") {
+		t.Errorf("Unexpected event %s %q", event.Severity, event.Description)
+	}
+}
+
+func TestKVParser_SyslogWrapped(t *testing.T) {
+	parser := NewKVParser()
+
+	line := `<34>Oct 11 22:14:15 app01 billing[77]: level=error msg="payment failed" user=alice`
+	if !parser.Detect(line) {
+		t.Fatal("Expected syslog-wrapped kv to be detected")
+	}
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Source.Hostname != "app01" || event.Source.Application != "billing" || event.Source.ProcessID != 77 {
+		t.Errorf("Expected syslog header in source, got %+v", event.Source)
+	}
+	if event.TimestampSynthesized || event.Timestamp.Month() != time.October {
+		t.Errorf("Expected header timestamp, got %v", event.Timestamp)
+	}
+	if event.Severity != models.SeverityHigh || event.Description != "payment failed" {
+		t.Errorf("Unexpected event %s %q", event.Severity, event.Description)
+	}
+
+	// Обычные сообщения syslog с отдельными парами не относятся к KV
+	if parser.Detect(`<38>Oct 11 22:14:15 srv01 sshd[2201]: pam_unix(sshd:auth): authentication failure; logname= uid=0 rhost=10.0.0.5 user=root`) {
+		t.Error("Expected free-text syslog message not to be detected")
+	}
+}
+
+func TestKVParser_Separators(t *testing.T) {
+	parser := NewKVParser()
+	if err := parser.SetSeparators(";", ":"); err != nil {
+		t.Fatalf("SetSeparators failed: %v", err)
+	}
+
+	line := `host: gw01; user: 'j doe'; action: vpn-login; result: success`
+	if !parser.Detect(line) {
+		t.Fatal("Expected line to be detected with custom separators")
+	}
+	event, err := parser.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.Source.Hostname != "gw01" || event.Action != "vpn-login" || event.Result != models.ResultSuccess {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if event.SubjectAccount == nil || event.SubjectAccount.Username != "j doe" {
+		t.Errorf("Unexpected subject %+v", event.SubjectAccount)
+	}
+
+	for _, seps := range [][2]string{{";", ""}, {"=", "="}, {",", `"`}} {
+		if err := parser.SetSeparators(seps[0], seps[1]); err == nil {
+			t.Errorf("Expected error for separators %q", seps)
+		}
+	}
+}
+
+func TestKVParser_Detect(t *testing.T) {
+	parser := NewKVParser()
+
+	tests := []struct {
+		line     string
+		expected bool
+	}{
+		{`a=1 b=2`, true},
+		{`a=1`, false},
+		{`User login successful user=root`, false},
+		{`GET /index.php?a=1&b=2 HTTP/1.1`, false},
+		{`{"a":"b=c d=e"}`, false},
+		{`<189>devname="FGT" logid="1"`, true},
+		{`<134>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`, false},
+	}
+	for _, tt := range tests {
+		if got := parser.Detect(tt.line); got != tt.expected {
+			t.Errorf("Detect(%q) = %v, want %v", tt.line, got, tt.expected)
+		}
+	}
+
+	if _, err := parser.Parse(`no pairs here`); err == nil {
+		t.Error("Expected error for line without pairs")
+	}
+}
@@ -7,17 +7,30 @@ import (
 	"time"
 
 	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
 	"github.com/google/uuid"
 )
 
 // LEEFParser парсит Log Event Extended Format (LEEF) логи
-type LEEFParser struct{}
+type LEEFParser struct {
+	rules *rules.Engine
+}
 
 // LEEF Format: LEEF:Version|Vendor|Product|Version|EventID|Attributes
 var leefPattern = regexp.MustCompile(`^LEEF:([\d.]+)\|([^|]*)\|([^|]*)\|([^|]*)\|([^|]*)\|(.*)$`)
 
 func NewLEEFParser() *LEEFParser {
-	return &LEEFParser{}
+	return &LEEFParser{rules: rules.Default()}
+}
+
+// SetRules задает правила классификации событий
+func (p *LEEFParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, является ли строка LEEF сообщением
+func (p *LEEFParser) Detect(logLine string) bool {
+	return strings.HasPrefix(logLine, "LEEF:")
 }
 
 // Parse парсит LEEF сообщение и возвращает GOSTEvent
@@ -37,24 +50,26 @@ func (p *LEEFParser) Parse(logLine string) (*models.GOSTEvent, error) {
 	attrs := p.parseAttributes(attributes, version)
 
 	timestamp := time.Now()
+	synthesized := true
 	if devTime, ok := attrs["devTime"]; ok {
 		if t, err := p.parseTimestamp(devTime); err == nil {
-			timestamp = t
+			timestamp, synthesized = t, false
 		}
 	}
 
 	event := &models.GOSTEvent{
-		EventID:     uuid.New().String(),
-		Timestamp:   timestamp,
-		Description: p.getAttributeValue(attrs, "usrName", "msg", "eventId"),
+		EventID:              uuid.New().String(),
+		Timestamp:            timestamp,
+		TimestampSynthesized: synthesized,
+		Description:          p.getAttributeValue(attrs, "usrName", "msg", "eventId"),
 		Source: models.Source{
 			Hostname:    p.getAttributeValue(attrs, "devName", "srcHostName", "dstHostName"),
 			Application: fmt.Sprintf("%s %s", vendor, product),
 			IPAddress:   p.getAttributeValue(attrs, "src", "dst"),
 		},
-		Severity:       p.mapLEEFSeverityToGOST(attrs),
-		Category:       p.categorizeLEEFEvent(eventID, attrs),
-		Result:         p.determineResult(attrs),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         models.ResultUnknown,
 		AdditionalData: make(map[string]interface{}),
 	}
 
@@ -86,11 +101,7 @@ func (p *LEEFParser) Parse(logLine string) (*models.GOSTEvent, error) {
 		event.AdditionalData["leef_"+k] = v
 	}
 
-	if action, ok := attrs["action"]; ok {
-		event.Action = action
-	} else if cat, ok := attrs["cat"]; ok {
-		event.Action = cat
-	}
+	p.rules.Apply("leef", event)
 
 	return event, nil
 }
@@ -144,85 +155,6 @@ func (p *LEEFParser) parseTimestamp(ts string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("невозможно распарсить время: %s", ts)
 }
 
-func (p *LEEFParser) mapLEEFSeverityToGOST(attrs map[string]string) string {
-	if sev, ok := attrs["sev"]; ok {
-		sevLower := strings.ToLower(sev)
-		switch {
-		case strings.Contains(sevLower, "critical") || strings.Contains(sevLower, "fatal") || sev == "10":
-			return models.SeverityCritical
-		case strings.Contains(sevLower, "high") || strings.Contains(sevLower, "error") || sev == "8" || sev == "7":
-			return models.SeverityHigh
-		case strings.Contains(sevLower, "medium") || strings.Contains(sevLower, "warn") || sev == "5" || sev == "6":
-			return models.SeverityMedium
-		case strings.Contains(sevLower, "low") || sev == "3" || sev == "4":
-			return models.SeverityLow
-		case strings.Contains(sevLower, "info") || sev == "1" || sev == "2":
-			return models.SeverityInfo
-		}
-	}
-	
-	return models.SeverityInfo
-}
-
-func (p *LEEFParser) categorizeLEEFEvent(eventID string, attrs map[string]string) string {
-	eventIDLower := strings.ToLower(eventID)
-	
-	if cat, ok := attrs["cat"]; ok {
-		catLower := strings.ToLower(cat)
-		if strings.Contains(catLower, "auth") {
-			return models.CategoryAuthentication
-		}
-		if strings.Contains(catLower, "access") {
-			return models.CategoryAccess
-		}
-		if strings.Contains(catLower, "network") {
-			return models.CategoryNetworkEvent
-		}
-	}
-	
-	if strings.Contains(eventIDLower, "login") || strings.Contains(eventIDLower, "auth") {
-		return models.CategoryAuthentication
-	}
-	if strings.Contains(eventIDLower, "access") || strings.Contains(eventIDLower, "permission") {
-		return models.CategoryAccess
-	}
-	if strings.Contains(eventIDLower, "modify") || strings.Contains(eventIDLower, "change") {
-		return models.CategoryDataModification
-	}
-	if strings.Contains(eventIDLower, "network") || strings.Contains(eventIDLower, "connection") {
-		return models.CategoryNetworkEvent
-	}
-	if strings.Contains(eventIDLower, "security") || strings.Contains(eventIDLower, "threat") {
-		return models.CategorySecurityEvent
-	}
-	
-	return models.CategorySystemEvent
-}
-
-func (p *LEEFParser) determineResult(attrs map[string]string) string {
-	if result, ok := attrs["result"]; ok {
-		resultLower := strings.ToLower(result)
-		if strings.Contains(resultLower, "success") || strings.Contains(resultLower, "allow") {
-			return models.ResultSuccess
-		}
-		if strings.Contains(resultLower, "fail") || strings.Contains(resultLower, "deny") {
-			return models.ResultFailure
-		}
-	}
-	
-	if action, ok := attrs["action"]; ok {
-		actionLower := strings.ToLower(action)
-		if strings.Contains(actionLower, "allow") || strings.Contains(actionLower, "permit") {
-			return models.ResultSuccess
-		}
-		if strings.Contains(actionLower, "block") || strings.Contains(actionLower, "deny") {
-			return models.ResultFailure
-		}
-	}
-	
-	return models.ResultUnknown
-}
-
 func (p *LEEFParser) getAttributeValue(attrs map[string]string, keys ...string) string {
 	for _, key := range keys {
 		if val, ok := attrs[key]; ok && val != "" {
@@ -8,33 +8,180 @@ import (
 	"time"
 
 	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
 	"github.com/google/uuid"
 )
 
 // SyslogParser парсит RFC 3164 и RFC 5424 syslog сообщения
-type SyslogParser struct{}
+type SyslogParser struct {
+	rules *rules.Engine
+	time  *timeConfig
+}
+
+// RFC3164Pattern - паттерн для RFC 3164 формата. Кроме "Mmm dd HH:MM:SS"
+// принимаются метки с годом ("Mmm dd yyyy HH:MM:SS") и ISO 8601.
+var RFC3164Pattern = regexp.MustCompile(`(?s)^<(\d+)>([A-Za-z]{3}\s+\d{1,2}(?:\s+\d{4})?\s+\d{1,2}:\d{2}:\d{2}(?:\.\d+)?|\d{4}-\d{2}-\d{2}T\S+)\s+(\S+)\s+(\S+?)(\[(\d+)\])?:\s+(.*)$`)
+
+// RFC5424Pattern - паттерн заголовка RFC 5424 формата; последняя группа
+// содержит STRUCTURED-DATA и MSG, которые разбираются parseStructuredData
+var RFC5424Pattern = regexp.MustCompile(`(?s)^<(\d+)>(\d+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(.*)$`)
 
-// RFC3164Pattern - паттерн для RFC 3164 формата
-var RFC3164Pattern = regexp.MustCompile(`^<(\d+)>(\w+\s+\d+\s+\d+:\d+:\d+)\s+(\S+)\s+(\S+?)(\[(\d+)\])?:\s+(.*)$`)
+// syslogShortPattern - заголовок без тега приложения: PRI, необязательные
+// метка времени и хост, затем MSG (так отправляют логи FortiGate и многие
+// устройства с CEF и LEEF)
+var syslogShortPattern = regexp.MustCompile(`(?s)^<(\d{1,3})>(?:([A-Za-z]{3}\s+\d{1,2}(?:\s+\d{4})?\s+\d{1,2}:\d{2}:\d{2}(?:\.\d+)?|\d{4}-\d{2}-\d{2}T\S+)\s+([^\s=]+)\s+)?(.*)$`)
 
-// RFC5424Pattern - паттерн для RFC 5424 формата
-var RFC5424Pattern = regexp.MustCompile(`^<(\d+)>(\d+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(.*)$`)
+// syslogTagPattern - допустимый тег приложения RFC 3164
+var syslogTagPattern = regexp.MustCompile(`^[\w\-./]+$`)
 
 func NewSyslogParser() *SyslogParser {
-	return &SyslogParser{}
+	return &SyslogParser{rules: rules.Default(), time: newTimeConfig()}
+}
+
+// SetTimezone задает часовой пояс источников, чьи метки времени не содержат
+// смещения (по умолчанию UTC)
+func (p *SyslogParser) SetTimezone(loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.location = loc
+}
+
+// SetHostTimezone задает часовой пояс отдельного хоста
+func (p *SyslogParser) SetHostTimezone(host string, loc *time.Location) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.hosts[strings.ToLower(host)] = loc
+}
+
+// SetClock задает источник времени приема, относительно которого
+// определяется год RFC 3164 меток (по умолчанию time.Now)
+func (p *SyslogParser) SetClock(now func() time.Time) {
+	p.time.mu.Lock()
+	defer p.time.mu.Unlock()
+	p.time.now = now
+}
+
+// SetRules задает правила классификации событий
+func (p *SyslogParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, начинается ли строка с syslog приоритета <PRI>
+func (p *SyslogParser) Detect(logLine string) bool {
+	if !strings.HasPrefix(logLine, "<") {
+		return false
+	}
+	priorityEnd := strings.Index(logLine, ">")
+	if priorityEnd <= 0 || priorityEnd >= 10 {
+		return false
+	}
+	return isNumeric(logLine[1:priorityEnd])
 }
 
 // Parse парсит syslog сообщение и возвращает GOSTEvent
 func (p *SyslogParser) Parse(logLine string) (*models.GOSTEvent, error) {
+	event, err := p.parseMessage(logLine)
+	if err != nil {
+		return nil, err
+	}
+
+	extractSyslogMessage(event)
+	p.rules.Apply("syslog", event)
+
+	return event, nil
+}
+
+// parseMessage разбирает заголовок syslog без применения правил; MSG
+// остается в Description
+func (p *SyslogParser) parseMessage(logLine string) (*models.GOSTEvent, error) {
+	var event *models.GOSTEvent
+	var err error
+
 	if match := RFC5424Pattern.FindStringSubmatch(logLine); match != nil {
-		return p.parseRFC5424(match)
+		event, err = p.parseRFC5424(match)
+	} else if match := RFC3164Pattern.FindStringSubmatch(logLine); match != nil {
+		event, err = p.parseRFC3164(match)
+	} else {
+		return nil, fmt.Errorf("неподдерживаемый формат syslog")
 	}
-	
-	if match := RFC3164Pattern.FindStringSubmatch(logLine); match != nil {
-		return p.parseRFC3164(match)
+	if err != nil {
+		return nil, err
 	}
-	
-	return nil, fmt.Errorf("неподдерживаемый формат syslog")
+
+	return event, nil
+}
+
+// Unwrap отделяет заголовок syslog от MSG для разбора вложенного формата
+// (CEF, LEEF, JSON). Возвращает событие с полями заголовка, в том числе
+// syslog_hostname, syslog_app_name и syslog_timestamp в AdditionalData, и
+// MSG. Кроме RFC 3164 и RFC 5424 принимается заголовок без тега
+// приложения и MSG сразу после PRI.
+func (p *SyslogParser) Unwrap(logLine string) (*models.GOSTEvent, string, bool) {
+	event, err := p.parseMessage(logLine)
+	if err == nil && event.AdditionalData["syslog_version"] == nil && !syslogTagPattern.MatchString(event.Source.Application) {
+		// "fw01 CEF:0|...|name: ..." - тег найден внутри MSG
+		err = fmt.Errorf("неверный тег приложения")
+	}
+	if err != nil {
+		var ok bool
+		if event, ok = p.parseShort(logLine); !ok {
+			return nil, "", false
+		}
+	}
+
+	message := event.Description
+	event.Description = ""
+	if event.Source.Hostname == "-" {
+		event.Source.Hostname = ""
+	}
+	if event.Source.Application == "-" {
+		event.Source.Application = ""
+	}
+
+	if event.Source.Hostname != "" {
+		event.AdditionalData["syslog_hostname"] = event.Source.Hostname
+	}
+	if event.Source.Application != "" {
+		event.AdditionalData["syslog_app_name"] = event.Source.Application
+	}
+	if !event.TimestampSynthesized {
+		event.AdditionalData["syslog_timestamp"] = event.Timestamp.Format(time.RFC3339Nano)
+	}
+
+	return event, message, true
+}
+
+// parseShort разбирает заголовок без тега приложения (syslogShortPattern)
+func (p *SyslogParser) parseShort(logLine string) (*models.GOSTEvent, bool) {
+	match := syslogShortPattern.FindStringSubmatch(logLine)
+	if match == nil {
+		return nil, false
+	}
+	priority, _ := strconv.Atoi(match[1])
+
+	event := &models.GOSTEvent{
+		EventID:              uuid.New().String(),
+		TimestampSynthesized: true,
+		Description:          match[4],
+		Source:               models.Source{Hostname: match[3]},
+		Severity:             models.SeverityInfo,
+		Category:             models.CategorySystemEvent,
+		Result:               models.ResultUnknown,
+		AdditionalData:       make(map[string]interface{}),
+	}
+	event.Timestamp = time.Now()
+	if match[2] != "" {
+		if t, err := p.time.parseBSDTimestamp(match[2], match[3]); err == nil {
+			event.Timestamp = t
+			event.TimestampSynthesized = false
+		}
+	}
+
+	event.AdditionalData["syslog_priority"] = priority
+	event.AdditionalData["syslog_facility"] = priority / 8
+	event.AdditionalData["syslog_severity"] = priority % 8
+
+	return event, true
 }
 
 func (p *SyslogParser) parseRFC3164(match []string) (*models.GOSTEvent, error) {
@@ -48,24 +195,25 @@ func (p *SyslogParser) parseRFC3164(match []string) (*models.GOSTEvent, error) {
 	}
 	message := match[7]
 
-	parsedTime, err := time.Parse("Jan 2 15:04:05", timestamp)
+	synthesized := false
+	parsedTime, err := p.time.parseBSDTimestamp(timestamp, hostname)
 	if err != nil {
 		parsedTime = time.Now()
-	} else {
-		parsedTime = parsedTime.AddDate(time.Now().Year(), 0, 0)
+		synthesized = true
 	}
 
 	event := &models.GOSTEvent{
-		EventID:     uuid.New().String(),
-		Timestamp:   parsedTime,
-		Description: message,
+		EventID:              uuid.New().String(),
+		Timestamp:            parsedTime,
+		TimestampSynthesized: synthesized,
+		Description:          message,
 		Source: models.Source{
 			Hostname:    hostname,
 			Application: appName,
 			ProcessID:   processID,
 		},
-		Severity:       p.mapSyslogSeverityToGOST(priority),
-		Category:       p.categorizeSyslogMessage(message),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
 		Result:         models.ResultUnknown,
 		AdditionalData: make(map[string]interface{}),
 	}
@@ -85,11 +233,17 @@ func (p *SyslogParser) parseRFC5424(match []string) (*models.GOSTEvent, error) {
 	appName := match[5]
 	procID := match[6]
 	msgID := match[7]
-	message := match[9]
 
+	structuredData, message, err := parseStructuredData(match[8])
+	if err != nil {
+		return nil, err
+	}
+
+	synthesized := false
 	parsedTime, err := time.Parse(time.RFC3339, timestamp)
 	if err != nil {
 		parsedTime = time.Now()
+		synthesized = true
 	}
 
 	processID := 0
@@ -98,16 +252,17 @@ func (p *SyslogParser) parseRFC5424(match []string) (*models.GOSTEvent, error) {
 	}
 
 	event := &models.GOSTEvent{
-		EventID:     uuid.New().String(),
-		Timestamp:   parsedTime,
-		Description: message,
+		EventID:              uuid.New().String(),
+		Timestamp:            parsedTime,
+		TimestampSynthesized: synthesized,
+		Description:          message,
 		Source: models.Source{
 			Hostname:    hostname,
 			Application: appName,
 			ProcessID:   processID,
 		},
-		Severity:       p.mapSyslogSeverityToGOST(priority),
-		Category:       p.categorizeSyslogMessage(message),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
 		Result:         models.ResultUnknown,
 		AdditionalData: make(map[string]interface{}),
 	}
@@ -118,43 +273,138 @@ func (p *SyslogParser) parseRFC5424(match []string) (*models.GOSTEvent, error) {
 	event.AdditionalData["syslog_version"] = version
 	event.AdditionalData["syslog_msgid"] = msgID
 
+	if len(structuredData) > 0 {
+		p.applyStructuredData(event, structuredData)
+	}
+
 	return event, nil
 }
 
-func (p *SyslogParser) mapSyslogSeverityToGOST(priority int) string {
-	severity := priority % 8
-	
-	switch severity {
-	case 0, 1, 2:
-		return models.SeverityCritical
-	case 3:
-		return models.SeverityHigh
-	case 4:
-		return models.SeverityMedium
-	case 5, 6:
-		return models.SeverityLow
-	case 7:
-		return models.SeverityInfo
-	default:
-		return models.SeverityInfo
+// applyStructuredData сохраняет SD-ELEMENT в AdditionalData["syslog_sd"]
+// и переносит известные параметры (origin, meta) в поля события
+func (p *SyslogParser) applyStructuredData(event *models.GOSTEvent, sd map[string]map[string]string) {
+	nested := make(map[string]interface{}, len(sd))
+	for id, params := range sd {
+		nested[id] = params
+	}
+	event.AdditionalData["syslog_sd"] = nested
+
+	if origin, ok := sd["origin"]; ok {
+		if ip := origin["ip"]; ip != "" {
+			// Параметр ip может повторяться - берем первый адрес
+			event.Source.IPAddress = strings.SplitN(ip, ",", 2)[0]
+		}
+		if software := origin["software"]; software != "" && event.Source.Application == "-" {
+			event.Source.Application = software
+		}
+		if swVersion := origin["swVersion"]; swVersion != "" {
+			event.AdditionalData["syslog_origin_sw_version"] = swVersion
+		}
+	}
+
+	if meta, ok := sd["meta"]; ok {
+		if seq := meta["sequenceId"]; seq != "" {
+			event.AdditionalData["syslog_sequence_id"] = seq
+		}
+		if upTime := meta["sysUpTime"]; upTime != "" {
+			event.AdditionalData["syslog_sys_up_time"] = upTime
+		}
+		if language := meta["language"]; language != "" {
+			event.AdditionalData["syslog_language"] = language
+		}
 	}
 }
 
-func (p *SyslogParser) categorizeSyslogMessage(message string) string {
-	messageLower := strings.ToLower(message)
-	
-	if strings.Contains(messageLower, "login") || strings.Contains(messageLower, "auth") {
-		return models.CategoryAuthentication
+// parseStructuredData разбирает STRUCTURED-DATA по RFC 5424 (раздел 6.3)
+// и возвращает параметры, сгруппированные по SD-ID, и оставшееся сообщение.
+// Повторяющиеся параметры одного элемента объединяются через запятую.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if s == "-" || strings.HasPrefix(s, "- ") {
+		return nil, trimMessage(strings.TrimPrefix(s, "-")), nil
+	}
+	if !strings.HasPrefix(s, "[") {
+		return nil, "", fmt.Errorf("неверный формат STRUCTURED-DATA")
 	}
-	if strings.Contains(messageLower, "access") || strings.Contains(messageLower, "denied") {
-		return models.CategoryAccess
+
+	sd := make(map[string]map[string]string)
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		i++
+		idEnd := i
+		for idEnd < len(s) && s[idEnd] != ' ' && s[idEnd] != ']' {
+			idEnd++
+		}
+		if idEnd == i || idEnd >= len(s) {
+			return nil, "", fmt.Errorf("неверный SD-ID в STRUCTURED-DATA")
+		}
+		id := s[i:idEnd]
+		params, ok := sd[id]
+		if !ok {
+			params = make(map[string]string)
+			sd[id] = params
+		}
+		i = idEnd
+
+		for i < len(s) && s[i] == ' ' {
+			i++
+			nameEnd := strings.IndexByte(s[i:], '=')
+			if nameEnd <= 0 || i+nameEnd+1 >= len(s) || s[i+nameEnd+1] != '"' {
+				return nil, "", fmt.Errorf("неверный SD-PARAM в элементе %s", id)
+			}
+			name := s[i : i+nameEnd]
+			i += nameEnd + 2
+
+			var value strings.Builder
+			closed := false
+			for i < len(s) {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					value.WriteByte(s[i+1])
+					i += 2
+					continue
+				}
+				i++
+				if c == '"' {
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("незакрытое значение параметра %s в элементе %s", name, id)
+			}
+
+			if prev, ok := params[name]; ok {
+				params[name] = prev + "," + value.String()
+			} else {
+				params[name] = value.String()
+			}
+		}
+
+		if i >= len(s) || s[i] != ']' {
+			return nil, "", fmt.Errorf("незакрытый элемент %s в STRUCTURED-DATA", id)
+		}
+		i++
 	}
-	if strings.Contains(messageLower, "network") || strings.Contains(messageLower, "connection") {
-		return models.CategoryNetworkEvent
+
+	if i < len(s) && s[i] != ' ' {
+		return nil, "", fmt.Errorf("неверный формат STRUCTURED-DATA")
 	}
-	if strings.Contains(messageLower, "security") || strings.Contains(messageLower, "breach") {
-		return models.CategorySecurityEvent
+
+	return sd, trimMessage(s[i:]), nil
+}
+
+// trimMessage убирает разделитель перед MSG и UTF-8 BOM
+func trimMessage(msg string) string {
+	msg = strings.TrimPrefix(msg, " ")
+	return strings.TrimPrefix(msg, "\ufeff")
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
 	}
-	
-	return models.CategorySystemEvent
+	return len(s) > 0
 }
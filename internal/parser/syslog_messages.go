@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// syslogExtractor разбирает сообщение одного вида. Именованные группы
+// выражения заполняют событие:
+//
+//	user, uid               - субъект (SubjectAccount)
+//	target, target_uid      - объект (ObjectAccount)
+//	ip                      - адрес источника (не IP - syslog_rhost)
+//	pairs                   - пары ключ=значение PAM (user, rhost, tty, ...)
+//	остальные               - AdditionalData с префиксом syslog_
+//
+// event - вид события (syslog_event), по которому правила назначают
+// категорию, результат и действие.
+type syslogExtractor struct {
+	event   string
+	pattern *regexp.Regexp
+	// user - субъект, если он не захватывается выражением
+	user string
+	// targetIsSubject - без явного субъекта им считается объект (сессия
+	// PAM открывается для самого пользователя)
+	targetIsSubject bool
+}
+
+func newSyslogExtractor(event, pattern string) syslogExtractor {
+	return syslogExtractor{event: event, pattern: regexp.MustCompile(pattern)}
+}
+
+// syslogPAMPrefix - сообщение модуля PAM: pam_unix(sshd:auth): ...
+var syslogPAMPrefix = regexp.MustCompile(`^pam_\w+\((?P<service>[^:)]+):(?P<pam_type>\w+)\): `)
+
+// syslogPAMExtractors разбирают сообщения PAM любого приложения (sshd,
+// sudo, su, login, cron)
+var syslogPAMExtractors = []syslogExtractor{
+	newSyslogExtractor("credential_validation_failed", `^authentication failure; (?P<pairs>.*)$`),
+	{
+		event:           "session_opened",
+		pattern:         regexp.MustCompile(`^session opened for user (?P<target>[^\s(]+)(?:\(uid=(?P<target_uid>\d+)\))?(?: by (?P<user>[^\s(]*)(?:\(uid=(?P<uid>\d+)\))?)?`),
+		targetIsSubject: true,
+	},
+	{
+		event:           "session_closed",
+		pattern:         regexp.MustCompile(`^session closed for user (?P<target>\S+)`),
+		targetIsSubject: true,
+	},
+	newSyslogExtractor("password_change", `^password changed for (?P<target>\S+)`),
+}
+
+// syslogAccountExtractors - сообщения shadow-utils об учетных записях
+var syslogAccountExtractors = []syslogExtractor{
+	newSyslogExtractor("user_created", `^new user: name=(?P<target>[^,]+), UID=(?P<target_uid>\d+), GID=(?P<gid>\d+), home=(?P<home>[^,]+), shell=(?P<shell>[^,\s]+)`),
+	newSyslogExtractor("group_created", `^(?:new group|group added to /etc/group): name=(?P<group>[^,]+), GID=(?P<gid>\d+)`),
+	newSyslogExtractor("group_member_added", `^add '(?P<target>[^']+)' to (?:shadow )?group '(?P<group>[^']+)'`),
+	newSyslogExtractor("password_change", `^change user '(?P<target>[^']+)' password`),
+	newSyslogExtractor("password_change", `^password for '(?P<target>[^']+)' changed by '(?P<user>[^']+)'`),
+	newSyslogExtractor("user_changed", `^(?:change|lock|unlock) user '(?P<target>[^']+)'`),
+	newSyslogExtractor("user_deleted", `^delete user '(?P<target>[^']+)'`),
+	newSyslogExtractor("group_deleted", `^removed group '(?P<group>[^']+)'`),
+	newSyslogExtractor("group_deleted", `^group '(?P<group>[^']+)' removed`),
+}
+
+// syslogCronExtractors - задания cron
+var syslogCronExtractors = []syslogExtractor{
+	newSyslogExtractor("scheduled_task_executed", `^\((?P<user>[^)]+)\) CMD \((?P<command>.*)\)$`),
+	newSyslogExtractor("scheduled_task_updated", `^\((?P<user>[^)]+)\) (?:REPLACE|DELETE) \((?P<target>[^)]+)\)`),
+}
+
+// syslogExtractors - разборщики сообщений по имени приложения (тегу syslog)
+var syslogExtractors = map[string][]syslogExtractor{
+	"sshd": {
+		newSyslogExtractor("logon", `^Accepted (?P<method>\S+) for (?P<user>\S+) from (?P<ip>\S+) port (?P<port>\d+)`),
+		newSyslogExtractor("logon_failed", `^Failed (?P<method>\S+) for (?:invalid user )?(?P<user>\S*) from (?P<ip>\S+) port (?P<port>\d+)`),
+		newSyslogExtractor("logon_failed", `^Invalid user (?P<user>\S*) from (?P<ip>\S+)(?: port (?P<port>\d+))?`),
+		newSyslogExtractor("logon_failed", `^(?:error: )?maximum authentication attempts exceeded for (?:invalid user )?(?P<user>\S+) from (?P<ip>\S+) port (?P<port>\d+)`),
+		newSyslogExtractor("logon_failed", `^User (?P<user>\S+) from (?P<ip>\S+) not allowed because (?P<reason>.+)$`),
+		newSyslogExtractor("logon_failed", `^(?:error: )?PAM: Authentication failure for (?:illegal user )?(?P<user>\S+) from (?P<ip>\S+)`),
+		newSyslogExtractor("logoff", `^Disconnected from user (?P<user>\S+) (?P<ip>\S+) port (?P<port>\d+)`),
+	},
+	"sudo": {
+		newSyslogExtractor("command_denied", `^\s*(?P<user>\S+) : (?P<reason>[^;]+?) ; TTY=(?P<tty>\S+) ; PWD=(?P<pwd>.*?) ; USER=(?P<target>\S+) ; (?:.*? ; )?COMMAND=(?P<command>.*)$`),
+		newSyslogExtractor("command_executed", `^\s*(?P<user>\S+) : TTY=(?P<tty>\S+) ; PWD=(?P<pwd>.*?) ; USER=(?P<target>\S+) ; (?:.*? ; )?COMMAND=(?P<command>.*)$`),
+	},
+	"su": {
+		newSyslogExtractor("user_switch_failed", `^FAILED SU \(to (?P<target>\S+)\) (?P<user>\S+) on (?P<tty>\S+)`),
+		newSyslogExtractor("user_switched", `^(?:\+ \S+ )?\(to (?P<target>\S+)\) (?P<user>\S+) on (?P<tty>\S+)`),
+		newSyslogExtractor("user_switch_failed", `^FAILED su for (?P<target>\S+) by (?P<user>\S+)`),
+		newSyslogExtractor("user_switched", `^Successful su for (?P<target>\S+) by (?P<user>\S+)`),
+		newSyslogExtractor("user_switch_failed", `^'su (?P<target>\S+)' failed for (?P<user>\S+) on (?P<tty>\S+)`),
+	},
+	"login": {
+		newSyslogExtractor("logon_failed", `^FAILED LOGIN \(?(?P<attempts>\d+)\)? (?:(?:on|ON) '?(?P<tty>[^\s']+)'? )?(?:FROM '?(?P<ip>[^\s']+)'? )?FOR '?(?P<user>[^\s,']+)'?, (?P<reason>.+)$`),
+		{event: "logon", pattern: regexp.MustCompile(`^ROOT LOGIN +(?:(?:on|ON) '?(?P<tty>[^\s']+)'?)?(?: FROM '?(?P<ip>[^\s']+)'?)?`), user: "root"},
+		newSyslogExtractor("logon", `^LOGIN (?:on|ON) '?(?P<tty>[^\s']+)'? BY '?(?P<user>[^\s']+)'?(?: FROM '?(?P<ip>[^\s']+)'?)?`),
+	},
+	"useradd":  syslogAccountExtractors,
+	"usermod":  syslogAccountExtractors,
+	"userdel":  syslogAccountExtractors,
+	"groupadd": syslogAccountExtractors,
+	"groupdel": syslogAccountExtractors,
+	"passwd":   syslogAccountExtractors,
+	"cron":     syslogCronExtractors,
+	"crond":    syslogCronExtractors,
+	"crontab":  syslogCronExtractors,
+}
+
+// syslogApplicationAliases - другие имена приложений с теми же сообщениями
+var syslogApplicationAliases = map[string]string{
+	"sshd-session": "sshd",
+	"sshd-auth":    "sshd",
+}
+
+// extractSyslogMessage разбирает MSG известных приложений: учетные записи,
+// адрес источника и вид события (syslog_event)
+func extractSyslogMessage(event *models.GOSTEvent) {
+	message := event.Description
+
+	extractors := syslogPAMExtractors
+	if match := syslogPAMPrefix.FindStringSubmatch(message); match != nil {
+		event.AdditionalData["syslog_pam_service"] = match[1]
+		event.AdditionalData["syslog_pam_type"] = match[2]
+		message = message[len(match[0]):]
+	} else {
+		app := strings.ToLower(path.Base(event.Source.Application))
+		if alias, ok := syslogApplicationAliases[app]; ok {
+			app = alias
+		}
+		extractors = syslogExtractors[app]
+	}
+
+	for _, ex := range extractors {
+		match := ex.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		ex.apply(event, match)
+		return
+	}
+}
+
+// apply переносит захваченные значения в событие
+func (ex syslogExtractor) apply(event *models.GOSTEvent, match []string) {
+	var subject, object models.Account
+	subject.Username = ex.user
+
+	for i, name := range ex.pattern.SubexpNames() {
+		value := match[i]
+		if name == "" || value == "" {
+			continue
+		}
+
+		switch name {
+		case "user":
+			subject.Username = value
+		case "uid":
+			subject.UserID = value
+		case "target":
+			object.Username = value
+		case "target_uid":
+			object.UserID = value
+		case "ip":
+			setSyslogRemoteHost(event, value)
+		case "pairs":
+			applyPAMPairs(event, &subject, value)
+		default:
+			event.AdditionalData["syslog_"+name] = value
+		}
+	}
+
+	if subject.Username == "" && ex.targetIsSubject {
+		subject = object
+		object = models.Account{}
+	}
+	if subject.Username != "" || subject.UserID != "" {
+		event.SubjectAccount = &subject
+	}
+	if object.Username != "" || object.UserID != "" {
+		event.ObjectAccount = &object
+	}
+	event.AdditionalData["syslog_event"] = ex.event
+}
+
+// applyPAMPairs разбирает пары сообщения "authentication failure; ..."
+func applyPAMPairs(event *models.GOSTEvent, subject *models.Account, pairs string) {
+	for _, pair := range splitKV(pairs, "", "=") {
+		if pair.bare || pair.value == "" {
+			continue
+		}
+		switch pair.key {
+		case "user":
+			subject.Username = pair.value
+		case "rhost":
+			setSyslogRemoteHost(event, pair.value)
+		case "tty", "ruser":
+			event.AdditionalData["syslog_"+pair.key] = pair.value
+		default:
+			event.AdditionalData["syslog_pam_"+pair.key] = pair.value
+		}
+	}
+}
+
+// setSyslogRemoteHost задает адрес источника; имя хоста сохраняется в
+// syslog_rhost
+func setSyslogRemoteHost(event *models.GOSTEvent, host string) {
+	if net.ParseIP(host) == nil {
+		event.AdditionalData["syslog_rhost"] = host
+		return
+	}
+	if event.Source.IPAddress == "" {
+		event.Source.IPAddress = host
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"testing"
+	"time"
 	"github.com/kxrty/loggerv2/internal/models"
 )
 
@@ -50,3 +51,265 @@ func TestSyslogParser_RFC5424(t *testing.T) {
 		t.Errorf("Expected application 'evntslog', got '%s'", event.Source.Application)
 	}
 }
+
+func TestSyslogParser_RFC5424StructuredData(t *testing.T) {
+	parser := NewSyslogParser()
+
+	logLine := `<165>1 2023-10-11T22:14:15.003Z relay01 rsyslogd 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application Server" note="a \"quoted\" \] \\ value"][origin ip="10.0.0.5" software="rsyslogd"][meta sequenceId="17"] Connection accepted from peer`
+
+	event, err := parser.Parse(logLine)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if event.Description != "Connection accepted from peer" {
+		t.Errorf("Unexpected description: %s", event.Description)
+	}
+
+	if event.Source.IPAddress != "10.0.0.5" {
+		t.Errorf("Expected IP '10.0.0.5', got '%s'", event.Source.IPAddress)
+	}
+
+	sd, ok := event.AdditionalData["syslog_sd"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected syslog_sd map, got %T", event.AdditionalData["syslog_sd"])
+	}
+
+	example, ok := sd["exampleSDID@32473"].(map[string]string)
+	if !ok {
+		t.Fatalf("Expected exampleSDID@32473 element, got %v", sd)
+	}
+
+	if example["eventSource"] != "Application Server" {
+		t.Errorf("Unexpected eventSource: '%s'", example["eventSource"])
+	}
+
+	if example["note"] != `a "quoted" ] \ value` {
+		t.Errorf("Unexpected note: %q", example["note"])
+	}
+
+	if event.AdditionalData["syslog_sequence_id"] != "17" {
+		t.Errorf("Expected sequence id '17', got '%v'", event.AdditionalData["syslog_sequence_id"])
+	}
+}
+
+func TestSyslogParser_RFC5424InvalidStructuredData(t *testing.T) {
+	parser := NewSyslogParser()
+
+	logLine := `<165>1 2023-10-11T22:14:15.003Z host app - - [origin ip="10.0.0.5" message`
+
+	if _, err := parser.Parse(logLine); err == nil {
+		t.Error("Expected error for unterminated STRUCTURED-DATA")
+	}
+}
+
+func TestSyslogParser_RFC3164Timestamps(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*3600)
+	received := time.Date(2026, time.January, 2, 10, 0, 0, 0, time.UTC)
+
+	parser := NewSyslogParser()
+	parser.SetClock(func() time.Time { return received })
+	parser.SetHostTimezone("msk-host", moscow)
+
+	tests := []struct {
+		name        string
+		line        string
+		want        time.Time
+		synthesized bool
+	}{
+		{
+			name: "декабрьский лог, обработанный в январе",
+			line: "<134>Dec 31 23:59:58 host app: message",
+			want: time.Date(2025, time.December, 31, 23, 59, 58, 0, time.UTC),
+		},
+		{
+			name: "день с дополнительным пробелом",
+			line: "<134>Jan  1 08:00:00 host app: message",
+			want: time.Date(2026, time.January, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "часовой пояс хоста",
+			line: "<134>Jan  2 12:00:00 msk-host app: message",
+			want: time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "метка с годом",
+			line: "<134>Oct 11 2024 22:14:15 host app: message",
+			want: time.Date(2024, time.October, 11, 22, 14, 15, 0, time.UTC),
+		},
+		{
+			name: "метка ISO 8601",
+			line: "<134>2025-10-11T22:14:15.5+03:00 host app[42]: message",
+			want: time.Date(2025, time.October, 11, 19, 14, 15, 500000000, time.UTC),
+		},
+		{
+			name: "метка ISO 8601 без смещения",
+			line: "<134>2025-10-11T22:14:15 msk-host app: message",
+			want: time.Date(2025, time.October, 11, 19, 14, 15, 0, time.UTC),
+		},
+		{
+			name:        "некорректная дата",
+			line:        "<134>Foo 45 22:14:15 host app: message",
+			synthesized: true,
+		},
+	}
+
+	for _, tt := range tests {
+		event, err := parser.Parse(tt.line)
+		if err != nil {
+			t.Errorf("%s: Parse failed: %v", tt.name, err)
+			continue
+		}
+		if event.TimestampSynthesized != tt.synthesized {
+			t.Errorf("%s: expected synthesized=%v", tt.name, tt.synthesized)
+		}
+		if !tt.synthesized && !event.Timestamp.Equal(tt.want) {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, event.Timestamp.UTC())
+		}
+		if event.Source.Hostname == "" || event.Description != "message" {
+			t.Errorf("%s: unexpected header parsing: %+v", tt.name, event.Source)
+		}
+	}
+}
+
+func TestSyslogParser_Unwrap(t *testing.T) {
+	parser := NewSyslogParser()
+	parser.SetClock(func() time.Time { return time.Date(2025, time.October, 12, 0, 0, 0, 0, time.UTC) })
+
+	tests := []struct {
+		name    string
+		line    string
+		host    string
+		app     string
+		message string
+	}{
+		{
+			name:    "RFC 3164 с тегом",
+			line:    `<134>Oct 11 22:14:15 app01 billing[77]: {"msg":"ok"}`,
+			host:    "app01",
+			app:     "billing",
+			message: `{"msg":"ok"}`,
+		},
+		{
+			name:    "RFC 3164 без тега",
+			line:    "<134>Oct 11 22:14:15 fw01 CEF:0|Vendor|Product|1.0|100|Rule: blocked|5|src=10.0.0.1",
+			host:    "fw01",
+			message: "CEF:0|Vendor|Product|1.0|100|Rule: blocked|5|src=10.0.0.1",
+		},
+		{
+			name:    "RFC 5424",
+			line:    "<134>1 2025-10-11T22:14:15Z relay - - - - LEEF:1.0|Microsoft|MSExchange|4.0|15345|src=10.0.0.1",
+			host:    "relay",
+			message: "LEEF:1.0|Microsoft|MSExchange|4.0|15345|src=10.0.0.1",
+		},
+		{
+			name:    "только PRI",
+			line:    "<134>CEF:0|Vendor|Product|1.0|100|Blocked|5|src=10.0.0.1",
+			message: "CEF:0|Vendor|Product|1.0|100|Blocked|5|src=10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		header, message, ok := parser.Unwrap(tt.line)
+		if !ok {
+			t.Errorf("%s: Unwrap failed", tt.name)
+			continue
+		}
+		if message != tt.message {
+			t.Errorf("%s: unexpected message %q", tt.name, message)
+		}
+		if header.Source.Hostname != tt.host || header.Source.Application != tt.app {
+			t.Errorf("%s: unexpected source %+v", tt.name, header.Source)
+		}
+		if header.AdditionalData["syslog_facility"] != 16 {
+			t.Errorf("%s: expected facility 16, got %v", tt.name, header.AdditionalData["syslog_facility"])
+		}
+		if tt.host != "" && header.AdditionalData["syslog_timestamp"] == nil {
+			t.Errorf("%s: expected syslog_timestamp", tt.name)
+		}
+	}
+
+	if _, _, ok := parser.Unwrap("CEF:0|Vendor|Product|1.0|100|Blocked|5|"); ok {
+		t.Error("Expected line without PRI not to be unwrapped")
+	}
+}
+
+func TestSyslogParser_MessageExtractors(t *testing.T) {
+	parser := NewSyslogParser()
+
+	tests := []struct {
+		line     string
+		action   string
+		category string
+		result   string
+		subject  string
+		object   string
+		ip       string
+	}{
+		{"<38>Oct 11 22:14:15 srv01 sshd[2201]: Failed password for root from 10.0.0.5 port 22 ssh2",
+			"logon_failed", models.CategoryAuthentication, models.ResultFailure, "root", "", "10.0.0.5"},
+		{"<38>Oct 11 22:14:15 srv01 sshd[2201]: Failed password for invalid user admin from 2001:db8::7 port 52211 ssh2",
+			"logon_failed", models.CategoryAuthentication, models.ResultFailure, "admin", "", "2001:db8::7"},
+		{"<38>Oct 11 22:14:15 srv01 sshd[2201]: Accepted publickey for alice from 10.0.0.6 port 50022 ssh2: ED25519 SHA256:abc",
+			"logon", models.CategoryAuthentication, models.ResultSuccess, "alice", "", "10.0.0.6"},
+		{"<38>Oct 11 22:14:15 srv01 sshd-session[2201]: Disconnected from user alice 10.0.0.6 port 50022",
+			"logoff", models.CategoryAuthentication, models.ResultSuccess, "alice", "", "10.0.0.6"},
+		{"<38>Oct 11 22:14:15 srv01 sshd[2201]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=10.0.0.5  user=root",
+			"credential_validation_failed", models.CategoryAuthentication, models.ResultFailure, "root", "", "10.0.0.5"},
+		{"<86>Oct 11 22:14:15 srv01 sudo: alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/bin/bash",
+			"command_executed", models.CategoryAuthorization, models.ResultSuccess, "alice", "root", ""},
+		{"<86>Oct 11 22:14:15 srv01 sudo: bob : user NOT in sudoers ; TTY=pts/1 ; PWD=/tmp ; USER=root ; COMMAND=/usr/bin/id",
+			"command_denied", models.CategoryAuthorization, models.ResultFailure, "bob", "root", ""},
+		{"<86>Oct 11 22:14:15 srv01 sudo: pam_unix(sudo:session): session opened for user root(uid=0) by alice(uid=1000)",
+			"session_opened", models.CategoryAuthentication, models.ResultSuccess, "alice", "root", ""},
+		{"<86>Oct 11 22:14:15 srv01 CRON[912]: pam_unix(cron:session): session closed for user backup",
+			"session_closed", models.CategoryAuthentication, models.ResultSuccess, "backup", "", ""},
+		{"<134>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			"user_switch_failed", models.CategoryAuthorization, models.ResultFailure, "lonvick", "root", ""},
+		{"<86>Oct 11 22:14:15 srv01 su[3001]: (to postgres) alice on pts/2",
+			"user_switched", models.CategoryAuthorization, models.ResultSuccess, "alice", "postgres", ""},
+		{"<38>Oct 11 22:14:15 srv01 login[611]: FAILED LOGIN (1) on '/dev/tty1' FOR 'bob', Authentication failure",
+			"logon_failed", models.CategoryAuthentication, models.ResultFailure, "bob", "", ""},
+		{"<38>Oct 11 22:14:15 srv01 login[611]: ROOT LOGIN  on '/dev/tty1'",
+			"logon", models.CategoryAuthentication, models.ResultSuccess, "root", "", ""},
+		{"<38>Oct 11 22:14:15 srv01 login[611]: LOGIN ON pts/3 BY carol FROM 192.0.2.10",
+			"logon", models.CategoryAuthentication, models.ResultSuccess, "carol", "", "192.0.2.10"},
+		{"<86>Oct 11 22:14:15 srv01 useradd[4410]: new user: name=deploy, UID=1001, GID=1001, home=/home/deploy, shell=/bin/bash, from=/dev/pts/0",
+			"user_created", models.CategoryDataModification, models.ResultSuccess, "", "deploy", ""},
+		{"<86>Oct 11 22:14:15 srv01 usermod[4420]: add 'deploy' to group 'wheel'",
+			"group_member_added", models.CategoryDataModification, models.ResultSuccess, "", "deploy", ""},
+		{"<78>Oct 11 22:15:01 srv01 CRON[5120]: (root) CMD (/usr/local/bin/backup.sh --full)",
+			"scheduled_task_executed", models.CategorySystemEvent, models.ResultSuccess, "root", "", ""},
+		{"<38>Oct 11 22:14:15 srv01 sshd[2201]: Server listening on 0.0.0.0 port 22.",
+			"", models.CategorySystemEvent, models.ResultUnknown, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		event, err := parser.Parse(tt.line)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.line, err)
+		}
+
+		if event.Action != tt.action || event.Category != tt.category || event.Result != tt.result {
+			t.Errorf("%q: got %s/%s/%s, want %s/%s/%s", tt.line, event.Action, event.Category, event.Result, tt.action, tt.category, tt.result)
+		}
+		subject, object := "", ""
+		if event.SubjectAccount != nil {
+			subject = event.SubjectAccount.Username
+		}
+		if event.ObjectAccount != nil {
+			object = event.ObjectAccount.Username
+		}
+		if subject != tt.subject || object != tt.object || event.Source.IPAddress != tt.ip {
+			t.Errorf("%q: got subject %q object %q ip %q", tt.line, subject, object, event.Source.IPAddress)
+		}
+	}
+
+	event, err := parser.Parse("<86>Oct 11 22:14:15 srv01 sudo: alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; ENV=A=1 ; COMMAND=/usr/bin/systemctl restart nginx")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if event.AdditionalData["syslog_command"] != "/usr/bin/systemctl restart nginx" || event.AdditionalData["syslog_tty"] != "pts/0" {
+		t.Errorf("Unexpected additional data %v", event.AdditionalData)
+	}
+}
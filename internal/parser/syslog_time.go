@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Допуск при определении года BSD метки времени: метка не может быть
+// позже времени приема больше чем на futureSkew (иначе это прошлый год)
+// и раньше больше чем на pastLimit (иначе это следующий год)
+const (
+	futureSkew = 31 * 24 * time.Hour
+	pastLimit  = 335 * 24 * time.Hour
+)
+
+// Форматы меток времени RFC 3164 и распространенных вариантов
+const (
+	bsdLayout         = "Jan 2 15:04:05"
+	bsdYearLayout     = "Jan 2 2006 15:04:05"
+	isoLocalLayout    = "2006-01-02T15:04:05"
+	isoLocalSepLayout = "2006-01-02 15:04:05"
+)
+
+// timeConfig - часовые пояса источников и часы для определения года
+type timeConfig struct {
+	mu       sync.RWMutex
+	location *time.Location
+	hosts    map[string]*time.Location
+	now      func() time.Time
+}
+
+func newTimeConfig() *timeConfig {
+	return &timeConfig{
+		location: time.UTC,
+		hosts:    make(map[string]*time.Location),
+		now:      time.Now,
+	}
+}
+
+// locationFor возвращает часовой пояс хоста
+func (c *timeConfig) locationFor(host string) *time.Location {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if loc, ok := c.hosts[strings.ToLower(host)]; ok {
+		return loc
+	}
+	return c.location
+}
+
+// parseBSDTimestamp разбирает метку времени RFC 3164 ("Oct 11 22:14:15",
+// "Oct  1 22:14:15"), вариант с годом ("Oct 11 2025 22:14:15") и ISO 8601
+// ("2025-10-11T22:14:15.003+03:00"). Метки без часового пояса
+// интерпретируются в поясе хоста, год без явного указания определяется
+// относительно времени приема.
+func (c *timeConfig) parseBSDTimestamp(timestamp, host string) (time.Time, error) {
+	loc := c.locationFor(host)
+
+	if len(timestamp) > 0 && timestamp[0] >= '0' && timestamp[0] <= '9' {
+		if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			return t, nil
+		}
+		for _, layout := range []string{isoLocalLayout, isoLocalSepLayout} {
+			if t, err := time.ParseInLocation(layout, timestamp, loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("невозможно распарсить время: %s", timestamp)
+	}
+
+	// Дни месяца дополняются пробелом ("Oct  1"), приводим к одному пробелу
+	normalized := strings.Join(strings.Fields(timestamp), " ")
+
+	if t, err := time.ParseInLocation(bsdYearLayout, normalized, loc); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(bsdLayout, normalized, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("невозможно распарсить время: %s", timestamp)
+	}
+
+	c.mu.RLock()
+	received := c.now().In(loc)
+	c.mu.RUnlock()
+
+	return inferYear(t, received), nil
+}
+
+// inferYear подставляет год в метку без года: берется год приема, а метки
+// из "будущего" (декабрьские логи, обработанные в январе) относятся к
+// прошлому году
+func inferYear(t, received time.Time) time.Time {
+	withYear := func(year int) time.Time {
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+
+	year := received.Year()
+	candidate := withYear(year)
+	switch {
+	case candidate.Sub(received) > futureSkew:
+		year--
+	case received.Sub(candidate) > pastLimit:
+		year++
+	}
+
+	// 29 февраля существует не в каждом году - ищем ближайший високосный в прошлом
+	if t.Month() == time.February && t.Day() == 29 {
+		for withYear(year).Month() != time.February {
+			year--
+		}
+	}
+
+	return withYear(year)
+}
+
+// ParseTimezones разбирает список часовых поясов хостов вида
+// "host1=Europe/Moscow,host2=Asia/Yekaterinburg"
+func ParseTimezones(spec string) (map[string]*time.Location, error) {
+	zones := make(map[string]*time.Location)
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		host, name, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(host) == "" {
+			return nil, fmt.Errorf("ожидается host=зона: %s", item)
+		}
+
+		loc, err := time.LoadLocation(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("неизвестный часовой пояс %s: %w", name, err)
+		}
+		zones[strings.TrimSpace(host)] = loc
+	}
+
+	return zones, nil
+}
@@ -0,0 +1,242 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// Поставщики событий Windows, у которых поля учетных записей
+// отличаются от общего соглашения Subject*/Target*
+const (
+	providerSecurity = "Microsoft-Windows-Security-Auditing"
+	providerSysmon   = "Microsoft-Windows-Sysmon"
+)
+
+// Биты System/Keywords журнала безопасности
+const (
+	keywordAuditFailure = 0x10000000000000
+	keywordAuditSuccess = 0x20000000000000
+)
+
+// accountFields - имена полей события с учетной записью
+type accountFields struct {
+	user, domain, sid string
+}
+
+// windowsAccounts - поля субъекта (кто выполнил действие) и объекта
+// (над какой учетной записью оно выполнено)
+type windowsAccounts struct {
+	subject, object accountFields
+}
+
+var (
+	subjectFields = accountFields{"SubjectUserName", "SubjectDomainName", "SubjectUserSid"}
+	targetFields  = accountFields{"TargetUserName", "TargetDomainName", "TargetSid"}
+	logonFields   = accountFields{"TargetUserName", "TargetDomainName", "TargetUserSid"}
+	sessionFields = accountFields{user: "AccountName", domain: "AccountDomain"}
+	memberFields  = accountFields{user: "MemberName", sid: "MemberSid"}
+	serviceFields = accountFields{user: "ServiceName", sid: "ServiceSid"}
+	sysmonFields  = accountFields{user: "User"}
+)
+
+// defaultWindowsAccounts - соглашение журнала безопасности: Subject*
+// выполняет действие над Target*
+var defaultWindowsAccounts = windowsAccounts{subject: subjectFields, object: targetFields}
+
+// securityAccounts - события безопасности, где субъект или объект
+// записаны в других полях. В событиях входа Subject* - служба, выполнившая
+// вход (обычно учетная запись компьютера), а вошедший пользователь - Target*.
+var securityAccounts = map[int]windowsAccounts{
+	4624: {subject: logonFields},
+	4625: {subject: logonFields},
+	4634: {subject: logonFields},
+	4647: {subject: logonFields},
+	4800: {subject: logonFields},
+	4801: {subject: logonFields},
+	4802: {subject: logonFields},
+	4803: {subject: logonFields},
+	4964: {subject: logonFields},
+	4688: {subject: subjectFields, object: logonFields},
+
+	4768: {subject: targetFields},
+	4769: {subject: targetFields, object: serviceFields},
+	4770: {subject: targetFields, object: serviceFields},
+	4771: {subject: targetFields},
+	4772: {subject: targetFields},
+	4776: {subject: targetFields},
+	4777: {subject: targetFields},
+
+	4778: {subject: sessionFields},
+	4779: {subject: sessionFields},
+
+	4728: {subject: subjectFields, object: memberFields},
+	4729: {subject: subjectFields, object: memberFields},
+	4732: {subject: subjectFields, object: memberFields},
+	4733: {subject: subjectFields, object: memberFields},
+	4746: {subject: subjectFields, object: memberFields},
+	4747: {subject: subjectFields, object: memberFields},
+	4751: {subject: subjectFields, object: memberFields},
+	4752: {subject: subjectFields, object: memberFields},
+	4756: {subject: subjectFields, object: memberFields},
+	4757: {subject: subjectFields, object: memberFields},
+	4761: {subject: subjectFields, object: memberFields},
+	4762: {subject: subjectFields, object: memberFields},
+}
+
+// windowsFailureEvents - события, которые всегда означают неуспех
+var windowsFailureEvents = map[int]bool{
+	4625: true,
+	4771: true,
+	4772: true,
+	4777: true,
+	5031: true,
+	5152: true,
+	5157: true,
+}
+
+// logonTypeNames - типы входа (поле LogonType)
+var logonTypeNames = map[string]string{
+	"0":  "System",
+	"2":  "Interactive",
+	"3":  "Network",
+	"4":  "Batch",
+	"5":  "Service",
+	"7":  "Unlock",
+	"8":  "NetworkCleartext",
+	"9":  "NewCredentials",
+	"10": "RemoteInteractive",
+	"11": "CachedInteractive",
+	"12": "CachedRemoteInteractive",
+	"13": "CachedUnlock",
+}
+
+// statusReasons - коды NTSTATUS (Status/SubStatus) и коды ошибок Kerberos
+// (Status/FailureCode в 4768, 4769, 4771); диапазоны не пересекаются
+var statusReasons = map[uint64]string{
+	0xc000005e: "нет серверов для обработки входа",
+	0xc0000064: "учетная запись не существует",
+	0xc000006a: "неверный пароль",
+	0xc000006d: "неверное имя пользователя или пароль",
+	0xc000006e: "ограничения учетной записи",
+	0xc000006f: "вход вне разрешенного времени",
+	0xc0000070: "вход с этой рабочей станции запрещен",
+	0xc0000071: "срок действия пароля истек",
+	0xc0000072: "учетная запись отключена",
+	0xc00000dc: "сервер в неверном состоянии",
+	0xc0000133: "расхождение времени с контроллером домена",
+	0xc000015b: "тип входа не разрешен",
+	0xc000018c: "нарушено доверие между доменами",
+	0xc0000192: "служба NetLogon не запущена",
+	0xc0000193: "срок действия учетной записи истек",
+	0xc0000224: "требуется смена пароля",
+	0xc0000225: "ошибка Windows",
+	0xc0000234: "учетная запись заблокирована",
+	0xc00002ee: "ошибка при входе",
+	0xc0000413: "сбой проверки подлинности брандмауэра",
+
+	0x6:  "клиент не найден в базе Kerberos",
+	0x7:  "сервер не найден в базе Kerberos",
+	0xc:  "ограничения политики",
+	0x12: "учетная запись отключена, заблокирована или просрочена",
+	0x17: "срок действия пароля истек",
+	0x18: "неверный пароль (предварительная проверка)",
+	0x1f: "проверка целостности не пройдена",
+	0x20: "срок действия билета истек",
+	0x25: "расхождение времени с контроллером домена",
+}
+
+// fieldValues возвращает значения полей события по имени; "-" и нулевой
+// SID, которыми Windows обозначает отсутствие значения, пропускаются
+func fieldValues(fields []Data) map[string]string {
+	values := make(map[string]string, len(fields))
+	for _, data := range fields {
+		value := strings.TrimSpace(data.Value)
+		if value == "" || value == "-" || value == "S-1-0-0" {
+			continue
+		}
+		values[data.Name] = value
+	}
+	return values
+}
+
+// account собирает учетную запись из полей; имя вида DOMAIN\user
+// (Sysmon) разделяется
+func (f accountFields) account(values map[string]string) *models.Account {
+	account := &models.Account{
+		Username: values[f.user],
+		Domain:   values[f.domain],
+		UserID:   values[f.sid],
+	}
+	if account.Domain == "" {
+		if domain, user, ok := strings.Cut(account.Username, `\`); ok {
+			account.Domain, account.Username = domain, user
+		}
+	}
+
+	if *account == (models.Account{}) {
+		return nil
+	}
+	return account
+}
+
+// accountsFor возвращает поля субъекта и объекта события
+func accountsFor(provider string, eventID int) windowsAccounts {
+	switch {
+	case strings.EqualFold(provider, providerSysmon):
+		return windowsAccounts{subject: sysmonFields}
+	case strings.EqualFold(provider, providerSecurity):
+		if accounts, ok := securityAccounts[eventID]; ok {
+			return accounts
+		}
+	}
+	return defaultWindowsAccounts
+}
+
+// parseCode разбирает код вида 0xC000006D или 24
+func parseCode(value string) (uint64, bool) {
+	code, err := strconv.ParseUint(strings.ToLower(value), 0, 64)
+	return code, err == nil
+}
+
+// windowsStatus возвращает код завершения события из Status, FailureCode
+// или ResultCode
+func windowsStatus(values map[string]string) (uint64, bool) {
+	for _, name := range []string{"Status", "FailureCode", "ResultCode"} {
+		if value, ok := values[name]; ok {
+			if code, ok := parseCode(value); ok {
+				return code, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// statusReason описывает причину неуспеха; SubStatus точнее Status
+func statusReason(values map[string]string) string {
+	for _, name := range []string{"SubStatus", "Status", "FailureCode", "ResultCode"} {
+		code, ok := parseCode(values[name])
+		if !ok || code == 0 {
+			continue
+		}
+		if reason, ok := statusReasons[code]; ok {
+			return reason
+		}
+	}
+	return ""
+}
+
+// auditResult определяет результат по битам Audit Success/Audit Failure
+func auditResult(keywords string) string {
+	mask, ok := parseCode(keywords)
+	switch {
+	case !ok:
+		return ""
+	case mask&keywordAuditFailure != 0:
+		return models.ResultFailure
+	case mask&keywordAuditSuccess != 0:
+		return models.ResultSuccess
+	}
+	return ""
+}
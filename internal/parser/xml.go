@@ -2,22 +2,30 @@ package parser
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
 	"github.com/google/uuid"
 )
 
 // XMLParser парсит XML логи (например Windows Event Log)
-type XMLParser struct{}
+type XMLParser struct {
+	rules *rules.Engine
+}
 
-// Event представляет базовую XML структуру события
+// Event представляет базовую XML структуру события. Пространство имен
+// не проверяется, поэтому подходят и документы с xmlns схемы событий Windows.
 type Event struct {
-	XMLName xml.Name `xml:"Event"`
-	System  System   `xml:"System"`
-	EventData EventData `xml:"EventData"`
+	XMLName       xml.Name      `xml:"Event"`
+	System        System        `xml:"System"`
+	EventData     EventData     `xml:"EventData"`
+	UserData      UserData      `xml:"UserData"`
+	RenderingInfo RenderingInfo `xml:"RenderingInfo"`
 }
 
 type System struct {
@@ -47,7 +55,8 @@ type TimeCreated struct {
 }
 
 type Correlation struct {
-	ActivityID string `xml:"ActivityID,attr"`
+	ActivityID        string `xml:"ActivityID,attr"`
+	RelatedActivityID string `xml:"RelatedActivityID,attr"`
 }
 
 type Execution struct {
@@ -60,7 +69,8 @@ type Security struct {
 }
 
 type EventData struct {
-	Data []Data `xml:"Data"`
+	Data   []Data `xml:"Data"`
+	Binary string `xml:"Binary"`
 }
 
 type Data struct {
@@ -68,36 +78,154 @@ type Data struct {
 	Value string `xml:",chardata"`
 }
 
+// UserData содержит произвольную XML структуру, заданную провайдером
+type UserData struct {
+	Nodes []XMLNode `xml:",any"`
+}
+
+// XMLNode - произвольный элемент XML
+type XMLNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []XMLNode  `xml:",any"`
+}
+
+// RenderingInfo - строки события, подготовленные Windows при экспорте
+type RenderingInfo struct {
+	Culture  string   `xml:"Culture,attr"`
+	Message  string   `xml:"Message"`
+	Level    string   `xml:"Level"`
+	Task     string   `xml:"Task"`
+	Opcode   string   `xml:"Opcode"`
+	Channel  string   `xml:"Channel"`
+	Provider string   `xml:"Provider"`
+	Keywords []string `xml:"Keywords>Keyword"`
+}
+
+// errStopParsing прерывает ParseReader без ошибки
+var errStopParsing = errors.New("разбор остановлен")
+
+// timeCreatedLayouts - форматы System/TimeCreated@SystemTime
+var timeCreatedLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
 func NewXMLParser() *XMLParser {
-	return &XMLParser{}
+	return &XMLParser{rules: rules.Default()}
 }
 
-// Parse парсит XML сообщение и возвращает GOSTEvent
+// SetRules задает правила классификации событий
+func (p *XMLParser) SetRules(engine *rules.Engine) {
+	p.rules = engine
+}
+
+// Detect определяет, является ли строка XML документом события
+func (p *XMLParser) Detect(logLine string) bool {
+	if strings.HasPrefix(logLine, "<?xml") || strings.HasPrefix(logLine, "<Event") {
+		return true
+	}
+	return strings.HasPrefix(logLine, "<") && strings.Contains(logLine, "<?xml")
+}
+
+// Parse парсит XML сообщение и возвращает GOSTEvent. Для документа
+// <Events> с несколькими событиями возвращается первое (см. ParseAll).
 func (p *XMLParser) Parse(logLine string) (*models.GOSTEvent, error) {
-	var event Event
-	
-	decoder := xml.NewDecoder(strings.NewReader(logLine))
-	if err := decoder.Decode(&event); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга XML: %w", err)
+	var first *models.GOSTEvent
+
+	err := p.ParseReader(strings.NewReader(logLine), func(event *models.GOSTEvent) error {
+		first = event
+		return errStopParsing
+	})
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, fmt.Errorf("в документе нет элемента Event")
+	}
+
+	return first, nil
+}
+
+// ParseAll парсит документ с одним событием или экспорт <Events> со
+// многими событиями
+func (p *XMLParser) ParseAll(logLine string) ([]*models.GOSTEvent, error) {
+	var events []*models.GOSTEvent
+
+	err := p.ParseReader(strings.NewReader(logLine), func(event *models.GOSTEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("в документе нет элемента Event")
+	}
+
+	return events, nil
+}
+
+// ParseReader последовательно разбирает все элементы <Event> из потока
+// (например, файла экспорта журнала) и передает события в handle
+func (p *XMLParser) ParseReader(r io.Reader, handle func(*models.GOSTEvent) error) error {
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка парсинга XML: %w", err)
+		}
 
-	timestamp, err := time.Parse(time.RFC3339Nano, event.System.TimeCreated.SystemTime)
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Event" {
+			continue
+		}
+
+		var event Event
+		if err := decoder.DecodeElement(&event, &start); err != nil {
+			return fmt.Errorf("ошибка парсинга XML: %w", err)
+		}
+
+		if err := handle(p.ConvertEvent(event)); err != nil {
+			if errors.Is(err, errStopParsing) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ConvertEvent преобразует разобранное событие Windows в GOSTEvent
+func (p *XMLParser) ConvertEvent(event Event) *models.GOSTEvent {
+	fields := eventFields(event)
+
+	synthesized := false
+	timestamp, err := parseTimeCreated(event.System.TimeCreated.SystemTime)
 	if err != nil {
 		timestamp = time.Now()
+		synthesized = true
 	}
 
 	gostEvent := &models.GOSTEvent{
-		EventID:     uuid.New().String(),
-		Timestamp:   timestamp,
-		Description: p.buildDescription(event),
+		EventID:              uuid.New().String(),
+		Timestamp:            timestamp,
+		TimestampSynthesized: synthesized,
+		Description:          p.buildDescription(event, fields),
 		Source: models.Source{
 			Hostname:    event.System.Computer,
 			Application: event.System.Provider.Name,
 			ProcessID:   event.System.Execution.ProcessID,
 		},
-		Severity:       p.mapXMLLevelToGOST(event.System.Level),
-		Category:       p.categorizeXMLEvent(event),
-		Result:         p.determineResult(event),
+		Severity:       models.SeverityInfo,
+		Category:       models.CategorySystemEvent,
+		Result:         p.determineResult(event, fields),
 		AdditionalData: make(map[string]interface{}),
 	}
 
@@ -110,9 +238,33 @@ func (p *XMLParser) Parse(logLine string) (*models.GOSTEvent, error) {
 	gostEvent.AdditionalData["xml_record_id"] = event.System.EventRecordID
 	gostEvent.AdditionalData["provider_guid"] = event.System.Provider.Guid
 
-	for _, data := range event.EventData.Data {
-		if data.Name != "" {
-			gostEvent.AdditionalData["xml_"+data.Name] = data.Value
+	if event.System.Correlation.ActivityID != "" {
+		gostEvent.AdditionalData["xml_activity_id"] = event.System.Correlation.ActivityID
+	}
+	if event.System.Correlation.RelatedActivityID != "" {
+		gostEvent.AdditionalData["xml_related_activity_id"] = event.System.Correlation.RelatedActivityID
+	}
+
+	for _, data := range fields {
+		gostEvent.AdditionalData["xml_"+data.Name] = data.Value
+	}
+	if event.EventData.Binary != "" {
+		gostEvent.AdditionalData["xml_binary"] = event.EventData.Binary
+	}
+	if len(event.UserData.Nodes) > 0 {
+		gostEvent.AdditionalData["xml_userdata_type"] = event.UserData.Nodes[0].XMLName.Local
+	}
+
+	rendering := event.RenderingInfo
+	for key, value := range map[string]string{
+		"xml_rendered_level":    rendering.Level,
+		"xml_rendered_task":     rendering.Task,
+		"xml_rendered_opcode":   rendering.Opcode,
+		"xml_rendered_keywords": strings.Join(rendering.Keywords, ", "),
+		"xml_culture":           rendering.Culture,
+	} {
+		if value != "" {
+			gostEvent.AdditionalData[key] = strings.TrimSpace(value)
 		}
 	}
 
@@ -122,77 +274,95 @@ func (p *XMLParser) Parse(logLine string) (*models.GOSTEvent, error) {
 		}
 	}
 
-	p.enrichEventFromEventData(gostEvent, event.EventData.Data)
+	p.enrichEventFromEventData(gostEvent, event, fields)
 
-	return gostEvent, nil
+	p.rules.Apply("xml", gostEvent)
+
+	return gostEvent
 }
 
-func (p *XMLParser) buildDescription(event Event) string {
-	if len(event.EventData.Data) > 0 {
-		var parts []string
-		for _, data := range event.EventData.Data {
-			if data.Value != "" {
-				parts = append(parts, fmt.Sprintf("%s: %s", data.Name, data.Value))
-			}
+// eventFields собирает поля события: именованные и безымянные элементы
+// EventData/Data (последние - как data_1, data_2, ... по позиции) и
+// листовые элементы UserData
+func eventFields(event Event) []Data {
+	var fields []Data
+
+	position := 0
+	for _, data := range event.EventData.Data {
+		position++
+		if data.Name == "" {
+			fields = append(fields, Data{Name: fmt.Sprintf("data_%d", position), Value: data.Value})
+			continue
 		}
-		if len(parts) > 0 {
-			return strings.Join(parts, "; ")
+		fields = append(fields, data)
+	}
+
+	for _, root := range event.UserData.Nodes {
+		for _, node := range root.Nodes {
+			fields = appendNodeFields(fields, "", node)
 		}
 	}
-	
-	return fmt.Sprintf("Event ID %d from %s", event.System.EventID, event.System.Provider.Name)
+
+	return fields
 }
 
-func (p *XMLParser) mapXMLLevelToGOST(level int) string {
-	switch level {
-	case 1:
-		return models.SeverityCritical
-	case 2:
-		return models.SeverityHigh
-	case 3:
-		return models.SeverityMedium
-	case 4:
-		return models.SeverityInfo
-	case 5:
-		return models.SeverityLow
-	default:
-		return models.SeverityInfo
+// appendNodeFields добавляет листовые элементы; вложенные получают имя
+// с префиксом родителя (Parent_Child)
+func appendNodeFields(fields []Data, prefix string, node XMLNode) []Data {
+	name := prefix + node.XMLName.Local
+	if len(node.Nodes) == 0 {
+		return append(fields, Data{Name: name, Value: strings.TrimSpace(node.Content)})
+	}
+	for _, child := range node.Nodes {
+		fields = appendNodeFields(fields, name+"_", child)
 	}
+	return fields
 }
 
-func (p *XMLParser) categorizeXMLEvent(event Event) string {
-	eventID := event.System.EventID
-	channel := strings.ToLower(event.System.Channel)
-	providerName := strings.ToLower(event.System.Provider.Name)
-
-	switch {
-	case eventID >= 4624 && eventID <= 4634:
-		return models.CategoryAuthentication
-	case eventID >= 4720 && eventID <= 4767:
-		return models.CategoryAuthorization
-	case eventID >= 4660 && eventID <= 4663:
-		return models.CategoryAccess
-	case eventID >= 4670 && eventID <= 4690:
-		return models.CategoryDataModification
+// parseTimeCreated разбирает System/TimeCreated@SystemTime; время без
+// смещения - UTC, как его записывает Windows
+func parseTimeCreated(value string) (time.Time, error) {
+	for _, layout := range timeCreatedLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("невозможно распарсить время: %s", value)
+}
 
-	if strings.Contains(channel, "security") || strings.Contains(providerName, "security") {
-		return models.CategorySecurityEvent
+func (p *XMLParser) buildDescription(event Event, fields []Data) string {
+	if message := strings.TrimSpace(event.RenderingInfo.Message); message != "" {
+		return message
 	}
 
-	if strings.Contains(channel, "system") || strings.Contains(providerName, "system") {
-		return models.CategorySystemEvent
+	if len(fields) > 0 {
+		var parts []string
+		for _, data := range fields {
+			if data.Value != "" {
+				parts = append(parts, fmt.Sprintf("%s: %s", data.Name, data.Value))
+			}
+		}
+		if len(parts) > 0 {
+			return strings.Join(parts, "; ")
+		}
 	}
+	
+	return fmt.Sprintf("Event ID %d from %s", event.System.EventID, event.System.Provider.Name)
+}
 
-	if strings.Contains(channel, "application") {
-		return models.CategorySystemEvent
+func (p *XMLParser) determineResult(event Event, fields []Data) string {
+	if code, ok := windowsStatus(fieldValues(fields)); ok {
+		if code == 0 {
+			return models.ResultSuccess
+		}
+		return models.ResultFailure
 	}
 
-	return models.CategorySystemEvent
-}
+	if result := auditResult(event.System.Keywords); result != "" {
+		return result
+	}
 
-func (p *XMLParser) determineResult(event Event) string {
-	for _, data := range event.EventData.Data {
+	for _, data := range fields {
 		nameLower := strings.ToLower(data.Name)
 		valueLower := strings.ToLower(data.Value)
 		
@@ -211,40 +381,50 @@ func (p *XMLParser) determineResult(event Event) string {
 	}
 
 	eventID := event.System.EventID
-	if (eventID >= 4624 && eventID <= 4625) || (eventID >= 4634 && eventID <= 4647) {
-		if eventID == 4625 {
-			return models.ResultFailure
-		}
+	if windowsFailureEvents[eventID] {
+		return models.ResultFailure
+	}
+	if eventID == 4624 || (eventID >= 4634 && eventID <= 4647) {
 		return models.ResultSuccess
 	}
 
 	return models.ResultUnknown
 }
 
-func (p *XMLParser) enrichEventFromEventData(gostEvent *models.GOSTEvent, data []Data) {
-	for _, d := range data {
-		nameLower := strings.ToLower(d.Name)
-		
-		switch {
-		case strings.Contains(nameLower, "targetusername") || strings.Contains(nameLower, "subjectusername"):
-			if gostEvent.SubjectAccount == nil {
-				gostEvent.SubjectAccount = &models.Account{}
-			}
-			gostEvent.SubjectAccount.Username = d.Value
-			
-		case strings.Contains(nameLower, "targetdomainname") || strings.Contains(nameLower, "subjectdomainname"):
-			if gostEvent.SubjectAccount == nil {
-				gostEvent.SubjectAccount = &models.Account{}
-			}
-			gostEvent.SubjectAccount.Domain = d.Value
-			
-		case strings.Contains(nameLower, "ipaddress") || strings.Contains(nameLower, "workstationname"):
-			if gostEvent.Source.IPAddress == "" {
-				gostEvent.Source.IPAddress = d.Value
+// enrichEventFromEventData заполняет субъект и объект события, адрес и
+// процесс источника, тип входа и причину неуспеха
+func (p *XMLParser) enrichEventFromEventData(gostEvent *models.GOSTEvent, event Event, fields []Data) {
+	values := fieldValues(fields)
+	accounts := accountsFor(event.System.Provider.Name, event.System.EventID)
+
+	// System/Security@UserID - учетная запись, записавшая событие; если
+	// субъект указан в данных события, используется он
+	if subject := accounts.subject.account(values); subject != nil {
+		gostEvent.SubjectAccount = subject
+	}
+	gostEvent.ObjectAccount = accounts.object.account(values)
+
+	for _, name := range []string{"IpAddress", "ClientAddress", "SourceAddress", "SourceIp"} {
+		if value, ok := values[name]; ok {
+			gostEvent.Source.IPAddress = strings.TrimPrefix(value, "::ffff:")
+			break
+		}
+	}
+
+	for _, names := range [][2]string{{"NewProcessName", "NewProcessId"}, {"ProcessName", "ProcessId"}, {"Image", "ProcessId"}} {
+		if process, ok := values[names[0]]; ok {
+			gostEvent.Source.Process = process
+			if pid, ok := parseCode(values[names[1]]); ok {
+				gostEvent.Source.ProcessID = int(pid)
 			}
-			
-		case strings.Contains(nameLower, "processname"):
-			gostEvent.Source.Process = d.Value
+			break
 		}
 	}
+
+	if name, ok := logonTypeNames[values["LogonType"]]; ok {
+		gostEvent.AdditionalData["xml_logon_type_name"] = name
+	}
+	if reason := statusReason(values); reason != "" {
+		gostEvent.AdditionalData["xml_status_reason"] = reason
+	}
 }
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"os"
+	"strconv"
 	"testing"
 	"github.com/kxrty/loggerv2/internal/models"
 )
@@ -52,3 +54,217 @@ func TestXMLParser_Parse(t *testing.T) {
 		t.Errorf("Expected username 'john.doe', got '%s'", event.SubjectAccount.Username)
 	}
 }
+
+func TestXMLParser_EventsDocument(t *testing.T) {
+	parser := NewXMLParser()
+
+	data, err := os.ReadFile("../../examples/windows_events.xml")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	events, err := parser.ParseAll(string(data))
+	if err != nil {
+		t.Fatalf("ParseAll failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	// RenderingInfo/Message и нестандартная точность TimeCreated
+	logon := events[0]
+	if logon.Description != "An account failed to log on." {
+		t.Errorf("Expected description from RenderingInfo, got %q", logon.Description)
+	}
+	if logon.Timestamp.Nanosecond() != 123456700 || logon.TimestampSynthesized {
+		t.Errorf("Unexpected timestamp %s", logon.Timestamp)
+	}
+	if logon.AdditionalData["xml_rendered_keywords"] != "Audit Failure" {
+		t.Errorf("Expected rendered keywords, got %v", logon.AdditionalData["xml_rendered_keywords"])
+	}
+
+	// UserData и RelatedActivityID
+	cleared := events[1]
+	if cleared.AdditionalData["xml_SubjectUserName"] != "Administrator" {
+		t.Errorf("Expected UserData fields, got %v", cleared.AdditionalData)
+	}
+	if cleared.AdditionalData["xml_userdata_type"] != "LogFileCleared" {
+		t.Errorf("Expected UserData type, got %v", cleared.AdditionalData["xml_userdata_type"])
+	}
+	if cleared.AdditionalData["xml_related_activity_id"] != "{A1B2C3D4-0000-0000-0000-000000000001}" {
+		t.Errorf("Expected related activity id, got %v", cleared.AdditionalData["xml_related_activity_id"])
+	}
+	if cleared.Timestamp.IsZero() || cleared.TimestampSynthesized {
+		t.Errorf("Expected TimeCreated with space separator to be parsed")
+	}
+
+	// Безымянные Data сохраняются по позиции
+	service := events[2]
+	if service.AdditionalData["xml_data_1"] != "Windows Update" || service.AdditionalData["xml_data_2"] != "running" {
+		t.Errorf("Expected positional data, got %v", service.AdditionalData)
+	}
+	if service.AdditionalData["xml_binary"] == nil {
+		t.Error("Expected binary data to be kept")
+	}
+
+	// Parse возвращает первое событие документа
+	first, err := parser.Parse(string(data))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if first.AdditionalData["xml_event_id"] != 4625 {
+		t.Errorf("Expected first event 4625, got %v", first.AdditionalData["xml_event_id"])
+	}
+}
+
+func TestXMLParser_WindowsEventMapping(t *testing.T) {
+	parser := NewXMLParser()
+
+	event := func(provider string, id int, data string) string {
+		return `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event"><System>` +
+			`<Provider Name="` + provider + `"/><EventID>` + strconv.Itoa(id) + `</EventID>` +
+			`<TimeCreated SystemTime="2025-10-11T22:14:15Z"/><Computer>dc01</Computer></System>` +
+			`<EventData>` + data + `</EventData></Event>`
+	}
+	security := "Microsoft-Windows-Security-Auditing"
+	sysmon := "Microsoft-Windows-Sysmon"
+
+	tests := []struct {
+		name     string
+		xml      string
+		category string
+		action   string
+		result   string
+		subject  string
+		object   string
+		check    func(t *testing.T, e *models.GOSTEvent)
+	}{
+		{
+			name: "4624 logon",
+			xml: event(security, 4624, `<Data Name="SubjectUserName">DC01$</Data><Data Name="TargetUserName">john.doe</Data>`+
+				`<Data Name="TargetDomainName">EXAMPLE</Data><Data Name="TargetUserSid">S-1-5-21-1-2-3-1104</Data>`+
+				`<Data Name="LogonType">10</Data><Data Name="IpAddress">::ffff:10.0.0.15</Data>`),
+			category: models.CategoryAuthentication, action: "logon", result: models.ResultSuccess, subject: "john.doe",
+			check: func(t *testing.T, e *models.GOSTEvent) {
+				if e.SubjectAccount.UserID != "S-1-5-21-1-2-3-1104" || e.Source.IPAddress != "10.0.0.15" {
+					t.Errorf("Unexpected subject %+v, ip %q", e.SubjectAccount, e.Source.IPAddress)
+				}
+				if e.AdditionalData["xml_logon_type_name"] != "RemoteInteractive" {
+					t.Errorf("Expected logon type name, got %v", e.AdditionalData["xml_logon_type_name"])
+				}
+			},
+		},
+		{
+			name: "4625 bad password",
+			xml: event(security, 4625, `<Data Name="SubjectUserName">-</Data><Data Name="TargetUserName">john.doe</Data>`+
+				`<Data Name="Status">0xC000006D</Data><Data Name="SubStatus">0xC000006A</Data>`),
+			category: models.CategoryAuthentication, action: "logon_failed", result: models.ResultFailure, subject: "john.doe",
+			check: func(t *testing.T, e *models.GOSTEvent) {
+				if e.AdditionalData["xml_status_reason"] != "неверный пароль" {
+					t.Errorf("Expected SubStatus reason, got %v", e.AdditionalData["xml_status_reason"])
+				}
+			},
+		},
+		{
+			name: "4648 explicit credentials",
+			xml: event(security, 4648, `<Data Name="SubjectUserName">alice</Data><Data Name="TargetUserName">admin</Data>`+
+				`<Data Name="TargetDomainName">EXAMPLE</Data>`),
+			category: models.CategoryAuthentication, action: "explicit_credentials_logon", subject: "alice", object: "admin",
+		},
+		{
+			name:     "4672 special privileges",
+			xml:      event(security, 4672, `<Data Name="SubjectUserName">admin</Data><Data Name="PrivilegeList">SeDebugPrivilege</Data>`),
+			category: models.CategoryAuthorization, action: "special_privileges_logon", subject: "admin",
+		},
+		{
+			name: "4688 process created",
+			xml: event(security, 4688, `<Data Name="SubjectUserName">alice</Data><Data Name="NewProcessId">0x1a2c</Data>`+
+				`<Data Name="NewProcessName">C:\Windows\System32\cmd.exe</Data>`),
+			category: models.CategorySystemEvent, action: "process_created", subject: "alice",
+			check: func(t *testing.T, e *models.GOSTEvent) {
+				if e.Source.Process != `C:\Windows\System32\cmd.exe` || e.Source.ProcessID != 0x1a2c {
+					t.Errorf("Unexpected process %q (%d)", e.Source.Process, e.Source.ProcessID)
+				}
+			},
+		},
+		{
+			name:     "4720 user created",
+			xml:      event(security, 4720, `<Data Name="SubjectUserName">admin</Data><Data Name="TargetUserName">bob</Data><Data Name="TargetSid">S-1-5-21-1-2-3-1105</Data>`),
+			category: models.CategoryAuthorization, action: "user_created", subject: "admin", object: "bob",
+		},
+		{
+			name: "4732 member added",
+			xml: event(security, 4732, `<Data Name="SubjectUserName">admin</Data><Data Name="MemberName">-</Data>`+
+				`<Data Name="MemberSid">S-1-5-21-1-2-3-1105</Data><Data Name="TargetUserName">Administrators</Data>`),
+			category: models.CategoryAuthorization, action: "group_member_added", subject: "admin",
+			check: func(t *testing.T, e *models.GOSTEvent) {
+				if e.ObjectAccount == nil || e.ObjectAccount.UserID != "S-1-5-21-1-2-3-1105" {
+					t.Errorf("Expected member as object, got %+v", e.ObjectAccount)
+				}
+				if e.Severity != models.SeverityMedium {
+					t.Errorf("Expected severity СРЕДНИЙ, got %s", e.Severity)
+				}
+			},
+		},
+		{
+			name:     "4771 kerberos pre-auth",
+			xml:      event(security, 4771, `<Data Name="TargetUserName">bob</Data><Data Name="FailureCode">0x18</Data>`),
+			category: models.CategoryAuthentication, action: "kerberos_preauth_failed", result: models.ResultFailure, subject: "bob",
+		},
+		{
+			name:     "1102 log cleared",
+			xml:      event("Microsoft-Windows-Eventlog", 1102, ``),
+			category: models.CategorySecurityEvent, action: "audit_log_cleared",
+			check: func(t *testing.T, e *models.GOSTEvent) {
+				if e.Severity != models.SeverityHigh {
+					t.Errorf("Expected severity ВЫСОКИЙ, got %s", e.Severity)
+				}
+			},
+		},
+		{
+			name: "sysmon 1 process create",
+			xml: event(sysmon, 1, `<Data Name="ProcessId">4242</Data><Data Name="Image">C:\Tools\psexec.exe</Data>`+
+				`<Data Name="User">EXAMPLE\alice</Data>`),
+			category: models.CategorySystemEvent, action: "process_created", subject: "alice",
+			check: func(t *testing.T, e *models.GOSTEvent) {
+				if e.SubjectAccount.Domain != "EXAMPLE" || e.Source.ProcessID != 4242 {
+					t.Errorf("Unexpected subject %+v, pid %d", e.SubjectAccount, e.Source.ProcessID)
+				}
+			},
+		},
+		{
+			name:     "sysmon 3 network",
+			xml:      event(sysmon, 3, `<Data Name="SourceIp">10.0.0.7</Data><Data Name="DestinationIp">8.8.8.8</Data><Data Name="User">EXAMPLE\alice</Data>`),
+			category: models.CategoryNetworkEvent, action: "network_connection", subject: "alice",
+		},
+		{
+			name:     "sysmon 11 file create",
+			xml:      event(sysmon, 11, `<Data Name="TargetFilename">C:\Temp\a.exe</Data>`),
+			category: models.CategoryDataModification, action: "file_created",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parser.Parse(tt.xml)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if e.Category != tt.category || e.Action != tt.action {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.category, tt.action, e.Category, e.Action)
+			}
+			if tt.result != "" && e.Result != tt.result {
+				t.Errorf("Expected result %s, got %s", tt.result, e.Result)
+			}
+			if tt.subject != "" && (e.SubjectAccount == nil || e.SubjectAccount.Username != tt.subject) {
+				t.Errorf("Expected subject %s, got %+v", tt.subject, e.SubjectAccount)
+			}
+			if tt.object != "" && (e.ObjectAccount == nil || e.ObjectAccount.Username != tt.object) {
+				t.Errorf("Expected object %s, got %+v", tt.object, e.ObjectAccount)
+			}
+			if tt.check != nil {
+				tt.check(t, e)
+			}
+		})
+	}
+}
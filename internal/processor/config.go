@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/parser"
+)
+
+// ConfigureTimezones задает часовой пояс по умолчанию и часовые пояса хостов
+// в формате parser.ParseTimezones
+func (p *Processor) ConfigureTimezones(timezone, hostTimezones string) error {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("неизвестный часовой пояс %s: %w", timezone, err)
+	}
+	p.SetTimezone(loc)
+
+	hosts, err := parser.ParseTimezones(hostTimezones)
+	if err != nil {
+		return err
+	}
+	for host, hostLoc := range hosts {
+		p.SetHostTimezone(host, hostLoc)
+	}
+	return nil
+}
+
+// LoadJSONProfiles задает профили сопоставления полей парсера JSON из файла
+func (p *Processor) LoadJSONProfiles(path string) error {
+	profiles, err := parser.LoadJSONProfilesFile(path)
+	if err != nil {
+		return err
+	}
+	prs, ok := p.Parser("json")
+	if !ok {
+		return fmt.Errorf("парсер json не зарегистрирован")
+	}
+	return prs.(*parser.JSONParser).SetProfiles(profiles)
+}
+
+// ConfigureKV задает профили (если указан файл) и разделители парсера
+// ключ=значение
+func (p *Processor) ConfigureKV(profilesPath, pairSep, valueSep string) error {
+	prs, ok := p.Parser("kv")
+	if !ok {
+		return fmt.Errorf("парсер kv не зарегистрирован")
+	}
+	kvParser := prs.(*parser.KVParser)
+
+	if profilesPath != "" {
+		profiles, err := parser.LoadKVProfilesFile(profilesPath)
+		if err != nil {
+			return err
+		}
+		if err := kvParser.SetProfiles(profiles); err != nil {
+			return err
+		}
+	}
+	return kvParser.SetSeparators(pairSep, valueSep)
+}
+
+// ConfigureGrok дополняет библиотеку шаблонов и задает профили парсера grok;
+// пустой путь пропускается
+func (p *Processor) ConfigureGrok(patternsPath, profilesPath string) error {
+	prs, ok := p.Parser("grok")
+	if !ok {
+		return fmt.Errorf("парсер grok не зарегистрирован")
+	}
+	grokParser := prs.(*parser.GrokParser)
+
+	if patternsPath != "" {
+		patterns, err := parser.LoadGrokPatternsFile(patternsPath)
+		if err != nil {
+			return err
+		}
+		if err := grokParser.AddPatterns(patterns); err != nil {
+			return err
+		}
+	}
+	if profilesPath != "" {
+		profiles, err := parser.LoadGrokProfilesFile(profilesPath)
+		if err != nil {
+			return err
+		}
+		if err := grokParser.SetProfiles(profiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigureDedup задает идентификаторы по содержимому и дедупликацию;
+// modeName - имя режима для ParseDedupMode
+func (p *Processor) ConfigureDedup(stableIDs bool, window time.Duration, modeName string, maxEntries int) error {
+	mode, err := ParseDedupMode(modeName)
+	if err != nil {
+		return err
+	}
+	p.SetDeterministicIDs(stableIDs)
+	p.SetDedup(DedupConfig{Window: window, MaxEntries: maxEntries, Mode: mode})
+	return nil
+}
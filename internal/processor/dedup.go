@@ -0,0 +1,336 @@
+package processor
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// ErrDuplicate возвращается, если событие отброшено как повтор (DedupDrop)
+var ErrDuplicate = errors.New("повторное событие")
+
+// eventNamespace - пространство имен UUIDv5 идентификаторов событий
+var eventNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/kxrty/loggerv2/event"))
+
+// DefaultDedupMaxEntries - число запоминаемых событий по умолчанию
+const DefaultDedupMaxEntries = 100000
+
+// DedupMode определяет обработку повторов
+type DedupMode int
+
+const (
+	// DedupDrop - повторы отбрасываются с ErrDuplicate; число отброшенных
+	// повторов (dedup_suppressed) получает следующее после окна событие или
+	// событие, возвращаемое FlushDedup
+	DedupDrop DedupMode = iota
+	// DedupCount - повторы выдаются, dedup_count - номер повтора в окне
+	DedupCount
+)
+
+// ParseDedupMode разбирает имя режима: drop, count
+func ParseDedupMode(name string) (DedupMode, error) {
+	switch name {
+	case "drop":
+		return DedupDrop, nil
+	case "count":
+		return DedupCount, nil
+	}
+	return DedupDrop, fmt.Errorf("неизвестный режим дедупликации: %s", name)
+}
+
+// DedupConfig - параметры дедупликации
+type DedupConfig struct {
+	// Window - интервал времени обработки, в котором одинаковые события
+	// считаются повторами (0 - дедупликация отключена)
+	Window time.Duration
+	// MaxEntries ограничивает число запоминаемых событий; при переполнении
+	// забываются самые старые
+	MaxEntries int
+	Mode       DedupMode
+}
+
+// DedupStats - счетчики дедупликации
+type DedupStats struct {
+	Unique     int64
+	Duplicates int64
+	Entries    int
+}
+
+// dedupEntry - запомненное событие
+type dedupEntry struct {
+	key        string
+	first      time.Time
+	count      int
+	suppressed int
+	// last - последний отброшенный повтор, из него FlushDedup строит
+	// событие с dedup_suppressed
+	last *models.GOSTEvent
+	elem *list.Element
+}
+
+// deduplicator запоминает ключи событий в пределах окна
+type deduplicator struct {
+	cfg DedupConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+	order   *list.List // от старых окон к новым
+	// evicted - вытесненные записи с отброшенными повторами, ожидающие FlushDedup
+	evicted []*models.GOSTEvent
+
+	unique     atomic.Int64
+	duplicates atomic.Int64
+}
+
+func newDeduplicator(cfg DedupConfig) *deduplicator {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultDedupMaxEntries
+	}
+	return &deduplicator{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*dedupEntry),
+		order:   list.New(),
+	}
+}
+
+// check отмечает событие; возвращает false, если событие нужно отбросить
+func (d *deduplicator) check(key string, event *models.GOSTEvent) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	entry, ok := d.entries[key]
+	if ok && now.Sub(entry.first) <= d.cfg.Window {
+		entry.count++
+		d.duplicates.Add(1)
+		if d.cfg.Mode == DedupDrop {
+			entry.suppressed++
+			entry.last = event
+			return false
+		}
+		setAdditional(event, "dedup_count", entry.count)
+		return true
+	}
+
+	d.unique.Add(1)
+	if ok {
+		// Окно истекло: событие выдается заново с числом отброшенных повторов
+		if entry.suppressed > 0 {
+			setAdditional(event, "dedup_suppressed", entry.suppressed)
+		}
+		entry.first, entry.count, entry.suppressed, entry.last = now, 1, 0, nil
+		d.order.MoveToBack(entry.elem)
+		return true
+	}
+
+	entry = &dedupEntry{key: key, first: now, count: 1}
+	entry.elem = d.order.PushBack(entry)
+	d.entries[key] = entry
+	for len(d.entries) > d.cfg.MaxEntries {
+		oldest := d.order.Remove(d.order.Front()).(*dedupEntry)
+		delete(d.entries, oldest.key)
+		if summary := oldest.summary(); summary != nil {
+			d.evicted = append(d.evicted, summary)
+		}
+	}
+	return true
+}
+
+// flush возвращает события с числом отброшенных повторов для истекших окон
+// (all - для всех) и забывает истекшие окна
+func (d *deduplicator) flush(all bool) []*models.GOSTEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := d.evicted
+	d.evicted = nil
+
+	now := d.now()
+	for elem := d.order.Front(); elem != nil; {
+		entry := elem.Value.(*dedupEntry)
+		next := elem.Next()
+		expired := now.Sub(entry.first) > d.cfg.Window
+		if !expired && !all {
+			// Дальше окна начались позже
+			break
+		}
+
+		if summary := entry.summary(); summary != nil {
+			events = append(events, summary)
+		}
+		if expired {
+			d.order.Remove(elem)
+			delete(d.entries, entry.key)
+		}
+		elem = next
+	}
+	return events
+}
+
+// summary возвращает последний отброшенный повтор с dedup_suppressed и
+// сбрасывает счетчик; nil - повторов не было
+func (e *dedupEntry) summary() *models.GOSTEvent {
+	if e.suppressed == 0 {
+		return nil
+	}
+	event := e.last
+	setAdditional(event, "dedup_suppressed", e.suppressed)
+	e.suppressed, e.last = 0, nil
+	return event
+}
+
+func (d *deduplicator) stats() DedupStats {
+	d.mu.Lock()
+	entries := len(d.entries)
+	d.mu.Unlock()
+
+	return DedupStats{Unique: d.unique.Load(), Duplicates: d.duplicates.Load(), Entries: entries}
+}
+
+// SetDeterministicIDs включает EventID, вычисляемые по содержимому (UUIDv5
+// от строки, источника и метки времени): повторная обработка той же строки
+// дает тот же идентификатор
+func (p *Processor) SetDeterministicIDs(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deterministicIDs = enabled
+}
+
+// SetDedup включает дедупликацию событий Process, ProcessAll, ProcessWith
+// и потоковой обработки. Повтором считается событие с тем же содержимым
+// (см. SetDeterministicIDs). Window <= 0 отключает дедупликацию.
+func (p *Processor) SetDedup(cfg DedupConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cfg.Window <= 0 {
+		p.dedup = nil
+		return
+	}
+	p.dedup = newDeduplicator(cfg)
+}
+
+// DedupWindow возвращает окно дедупликации (0 - отключена)
+func (p *Processor) DedupWindow() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.dedup == nil {
+		return 0
+	}
+	return p.dedup.cfg.Window
+}
+
+// FlushDedup возвращает в режиме DedupDrop события с числом отброшенных
+// повторов (dedup_suppressed) для истекших окон, а с all - для всех окон
+// (при завершении обработки). Без вызова FlushDedup число повторов получает
+// только следующее после окна одинаковое событие. Событие строится из
+// последнего отброшенного повтора; для каждого окна оно выдается один раз.
+func (p *Processor) FlushDedup(all bool) []*models.GOSTEvent {
+	p.mu.RLock()
+	dedup := p.dedup
+	p.mu.RUnlock()
+
+	if dedup == nil {
+		return nil
+	}
+	return dedup.flush(all)
+}
+
+// DedupStats возвращает счетчики дедупликации
+func (p *Processor) DedupStats() DedupStats {
+	p.mu.RLock()
+	dedup := p.dedup
+	p.mu.RUnlock()
+
+	if dedup == nil {
+		return DedupStats{}
+	}
+	return dedup.stats()
+}
+
+// finish назначает идентификаторы и, если checkDup, отбрасывает повторы
+// разобранных событий. Если отброшены все события, возвращается
+// ErrDuplicate.
+func (p *Processor) finish(logLine string, events []*models.GOSTEvent, checkDup bool) ([]*models.GOSTEvent, error) {
+	p.mu.RLock()
+	deterministic, dedup := p.deterministicIDs, p.dedup
+	p.mu.RUnlock()
+	if !checkDup {
+		dedup = nil
+	}
+
+	if !deterministic && dedup == nil {
+		return events, nil
+	}
+
+	logLine = strings.TrimSpace(logLine)
+	kept := events[:0]
+	for i, event := range events {
+		id := contentID(logLine, event, i)
+		if deterministic {
+			event.EventID = id
+		}
+		if dedup != nil && !dedup.check(id, event) {
+			continue
+		}
+		kept = append(kept, event)
+	}
+
+	if len(kept) == 0 {
+		return nil, ErrDuplicate
+	}
+	return kept, nil
+}
+
+// isDuplicate проверяет событие строки logLine, разобранное без
+// дедупликации (process с dedup = false). Потоковая обработка вызывает ее
+// в порядке выдачи результатов, чтобы при нескольких воркерах оставалось
+// одно и то же событие из повторов.
+func (p *Processor) isDuplicate(logLine string, event *models.GOSTEvent) bool {
+	p.mu.RLock()
+	dedup := p.dedup
+	p.mu.RUnlock()
+
+	if dedup == nil {
+		return false
+	}
+	return !dedup.check(contentID(strings.TrimSpace(logLine), event, 0), event)
+}
+
+// contentID вычисляет UUIDv5 события по строке, источнику и метке времени.
+// Подставленное время обработки не учитывается. index различает события
+// одной записи (MultiParser).
+func contentID(logLine string, event *models.GOSTEvent, index int) string {
+	var b strings.Builder
+	b.WriteString(logLine)
+	b.WriteByte(0)
+	b.WriteString(event.Source.Hostname)
+	b.WriteByte(0)
+	b.WriteString(event.Source.IPAddress)
+	b.WriteByte(0)
+	if !event.TimestampSynthesized {
+		b.WriteString(event.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+	b.WriteByte(0)
+	b.WriteString(strconv.Itoa(index))
+
+	return uuid.NewSHA1(eventNamespace, []byte(b.String())).String()
+}
+
+func setAdditional(event *models.GOSTEvent, key string, value interface{}) {
+	if event.AdditionalData == nil {
+		event.AdditionalData = make(map[string]interface{})
+	}
+	event.AdditionalData[key] = value
+}
@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// Encoder записывает события в выходной поток по одному, не накапливая их
+// в памяти. Close завершает вывод (например, закрывает JSON массив) и
+// сбрасывает буфер, но не закрывает нижележащий io.Writer.
+type Encoder interface {
+	Encode(event *models.GOSTEvent) error
+	Close() error
+}
+
+// EncoderFormats - форматы, поддерживаемые NewEncoder
+var EncoderFormats = []string{"ndjson", "json-array", "pretty", "csv"}
+
+// NewEncoder создает кодировщик формата:
+//
+//	ndjson     - компактный JSON, одно событие на строку
+//	json-array - JSON массив событий
+//	pretty     - JSON с отступами (как ConvertToJSON), события подряд
+//	csv        - CSV с заголовком, AdditionalData в столбце additional_data (JSON)
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	buf := bufio.NewWriter(w)
+
+	switch format {
+	case "ndjson":
+		return &jsonEncoder{w: buf, encoder: newJSONEncoder(buf, "")}, nil
+	case "json-array":
+		return &jsonArrayEncoder{w: buf}, nil
+	case "pretty":
+		return &jsonEncoder{w: buf, encoder: newJSONEncoder(buf, "  ")}, nil
+	case "csv":
+		return &csvEncoder{w: buf, writer: csv.NewWriter(buf)}, nil
+	}
+	return nil, fmt.Errorf("неизвестный формат вывода: %s", format)
+}
+
+// OmitRaw возвращает кодировщик, выводящий события без исходной строки
+// (Origin.Raw)
+func OmitRaw(encoder Encoder) Encoder {
+	return omitRawEncoder{encoder}
+}
+
+type omitRawEncoder struct {
+	Encoder
+}
+
+func (e omitRawEncoder) Encode(event *models.GOSTEvent) error {
+	return e.Encoder.Encode(event.WithoutRaw())
+}
+
+func newJSONEncoder(w io.Writer, indent string) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", indent)
+	return encoder
+}
+
+// jsonEncoder - ndjson и pretty
+type jsonEncoder struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (e *jsonEncoder) Encode(event *models.GOSTEvent) error {
+	if err := e.encoder.Encode(event); err != nil {
+		return fmt.Errorf("ошибка сериализации в JSON: %w", err)
+	}
+	return nil
+}
+
+func (e *jsonEncoder) Close() error {
+	return e.w.Flush()
+}
+
+// jsonArrayEncoder пишет элементы массива по мере поступления событий
+type jsonArrayEncoder struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (e *jsonArrayEncoder) Encode(event *models.GOSTEvent) error {
+	data, err := json.MarshalIndent(event, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации в JSON: %w", err)
+	}
+
+	sep := ",\n  "
+	if e.count == 0 {
+		sep = "[\n  "
+	}
+	e.count++
+	if _, err := e.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonArrayEncoder) Close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	if _, err := e.w.WriteString(end); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// csvColumns - столбцы CSV вывода
+var csvColumns = []string{
+	"event_id", "timestamp", "timestamp_synthesized",
+	"source_hostname", "source_ip_address", "source_application", "source_process", "source_process_id",
+	"category", "severity", "description",
+	"subject_username", "subject_domain", "subject_user_id",
+	"object_username", "object_domain", "object_user_id",
+	"result", "action", "additional_data",
+	"origin_format", "origin_ingest_time", "origin_input", "origin_parser_version", "origin_raw",
+}
+
+// csvEncoder пишет события строками CSV; заголовок выводится первой строкой
+type csvEncoder struct {
+	w      *bufio.Writer
+	writer *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) Encode(event *models.GOSTEvent) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	additional := ""
+	if len(event.AdditionalData) > 0 {
+		data, err := json.Marshal(event.AdditionalData)
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации в JSON: %w", err)
+		}
+		additional = string(data)
+	}
+
+	processID := ""
+	if event.Source.ProcessID != 0 {
+		processID = strconv.Itoa(event.Source.ProcessID)
+	}
+	synthesized := ""
+	if event.TimestampSynthesized {
+		synthesized = "true"
+	}
+
+	record := []string{
+		event.EventID, event.Timestamp.Format(time.RFC3339Nano), synthesized,
+		event.Source.Hostname, event.Source.IPAddress, event.Source.Application, event.Source.Process, processID,
+		event.Category, event.Severity, event.Description,
+	}
+	record = append(record, csvAccount(event.SubjectAccount)...)
+	record = append(record, csvAccount(event.ObjectAccount)...)
+	record = append(record, event.Result, event.Action, additional)
+	record = append(record, csvOrigin(event.Origin)...)
+
+	return e.writer.Write(record)
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	if err := e.writer.Error(); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.writer.Write(csvColumns)
+}
+
+func csvOrigin(origin *models.Origin) []string {
+	if origin == nil {
+		return []string{"", "", "", "", ""}
+	}
+	return []string{origin.Format, origin.IngestTime.Format(time.RFC3339Nano), origin.Input, origin.ParserVersion, origin.Raw}
+}
+
+func csvAccount(account *models.Account) []string {
+	if account == nil {
+		return []string{"", "", ""}
+	}
+	return []string{account.Username, account.Domain, account.UserID}
+}
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// Значения parse_status событий мягкого режима
+const (
+	// ParseStatusUnknownFormat - формат строки не определен
+	ParseStatusUnknownFormat = "unknown_format"
+	// ParseStatusFailed - формат определен, но разобрать строку не удалось
+	ParseStatusFailed = "parse_error"
+)
+
+// SetLenient включает мягкий режим: строки неизвестного формата и строки,
+// которые не удалось разобрать, не возвращаются с ошибкой, а превращаются
+// в событие СИСТЕМНОЕ_СОБЫТИЕ с исходным текстом в Description, ошибкой в
+// parse_error и отметкой parse_status. Пустые строки по-прежнему
+// возвращают ошибку.
+func (p *Processor) SetLenient(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lenient = enabled
+}
+
+// lenientEvents заменяет ошибку разбора событием в мягком режиме;
+// d - найденный парсер (nil - формат не определен)
+func (p *Processor) lenientEvents(logLine string, d *detection, events []*models.GOSTEvent, err error) ([]*models.GOSTEvent, error) {
+	p.mu.RLock()
+	lenient := p.lenient
+	p.mu.RUnlock()
+
+	if err == nil || !lenient || strings.TrimSpace(logLine) == "" {
+		return events, err
+	}
+
+	event := &models.GOSTEvent{
+		EventID:              uuid.New().String(),
+		Timestamp:            time.Now().UTC(),
+		TimestampSynthesized: true,
+		Category:             models.CategorySystemEvent,
+		Severity:             models.SeverityInfo,
+		Description:          logLine,
+		Result:               models.ResultUnknown,
+		AdditionalData: map[string]interface{}{
+			"parse_status": ParseStatusUnknownFormat,
+			"parse_error":  err.Error(),
+		},
+	}
+	if d != nil {
+		event.AdditionalData["parse_status"] = ParseStatusFailed
+		event.AdditionalData["parse_log_type"] = d.name
+		// Поля заголовка обертки (хост, время syslog) сохраняются
+		if d.header != nil {
+			mergeHeader(event, d.header)
+		}
+	}
+	return []*models.GOSTEvent{event}, nil
+}
@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// Version - версия обработчика в Origin.ParserVersion; задается при сборке:
+// -ldflags "-X github.com/kxrty/loggerv2/internal/processor.Version=1.1.0"
+var Version = "1.0.0"
+
+// Versioner реализуют парсеры с собственной версией для Origin.ParserVersion
+// (по умолчанию используется Version)
+type Versioner interface {
+	Version() string
+}
+
+// SetOrigin включает заполнение Origin событий: исходная строка, тип лога,
+// время приема и версия парсера. Вход (Origin.Input) задает вызывающий код.
+func (p *Processor) SetOrigin(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origin = enabled
+}
+
+// setOrigin заполняет Origin разобранных событий; d - парсер, разобравший
+// строку (nil - формат не определен, событие мягкого режима)
+func (p *Processor) setOrigin(logLine string, d *detection, events []*models.GOSTEvent) {
+	p.mu.RLock()
+	enabled := p.origin
+	p.mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	origin := models.Origin{Raw: logLine, IngestTime: time.Now().UTC()}
+	if d == nil {
+		origin.Format = p.LogTypeName(LogTypeUnknown)
+	} else {
+		version := Version
+		if versioner, ok := d.parser.(Versioner); ok {
+			version = versioner.Version()
+		}
+		origin.Format = d.name
+		origin.ParserVersion = d.name + "/" + version
+	}
+
+	for _, event := range events {
+		eventOrigin := origin
+		event.Origin = &eventOrigin
+	}
+}
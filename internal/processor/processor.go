@@ -1,12 +1,17 @@
 package processor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kxrty/loggerv2/internal/models"
 	"github.com/kxrty/loggerv2/internal/parser"
+	"github.com/kxrty/loggerv2/internal/rules"
 )
 
 // LogType представляет тип лога
@@ -18,92 +23,376 @@ const (
 	LogTypeCEF
 	LogTypeLEEF
 	LogTypeXML
+	LogTypeJSON
+	LogTypeAuditd
+	LogTypeKV
+	LogTypeGrok
 )
 
+// firstCustomLogType - первый тип, выдаваемый пользовательским парсерам
+const firstCustomLogType LogType = 1000
+
+// Приоритеты встроенных парсеров: чем выше значение, тем раньше
+// парсер проверяется при автоопределении формата
+const (
+	PriorityGrok   = 10
+	PriorityJSON   = 50
+	PrioritySyslog = 100
+	PriorityKV     = 150
+	PriorityAuditd = 160
+	PriorityXML    = 200
+	PriorityLEEF   = 300
+	PriorityCEF    = 400
+)
+
+// Parser описывает парсер формата логов, подключаемый к процессору
+type Parser interface {
+	// Detect сообщает, относится ли строка лога к формату парсера
+	Detect(logLine string) bool
+	// Parse преобразует строку лога в событие ГОСТ
+	Parse(logLine string) (*models.GOSTEvent, error)
+}
+
+// ParserFuncs позволяет зарегистрировать парсер из пары обычных функций
+type ParserFuncs struct {
+	DetectFunc func(logLine string) bool
+	ParseFunc  func(logLine string) (*models.GOSTEvent, error)
+}
+
+// Detect вызывает DetectFunc
+func (f ParserFuncs) Detect(logLine string) bool {
+	return f.DetectFunc(logLine)
+}
+
+// Parse вызывает ParseFunc
+func (f ParserFuncs) Parse(logLine string) (*models.GOSTEvent, error) {
+	return f.ParseFunc(logLine)
+}
+
+// RulesSetter реализуют парсеры, классифицирующие события по правилам
+type RulesSetter interface {
+	SetRules(engine *rules.Engine)
+}
+
+// MultiParser реализуют парсеры, у которых одна запись может содержать
+// несколько событий (например, экспорт <Events> журнала Windows)
+type MultiParser interface {
+	ParseAll(logLine string) ([]*models.GOSTEvent, error)
+}
+
+// TimezoneSetter реализуют парсеры, интерпретирующие метки времени без
+// часового пояса (например, RFC 3164)
+type TimezoneSetter interface {
+	SetTimezone(loc *time.Location)
+	SetHostTimezone(host string, loc *time.Location)
+}
+
+// Unwrapper реализуют парсеры форматов-оберток (syslog), внутри которых
+// передаются сообщения других форматов. Unwrap возвращает событие с полями
+// заголовка и вложенное сообщение.
+type Unwrapper interface {
+	Unwrap(logLine string) (*models.GOSTEvent, string, bool)
+}
+
+// registeredParser - запись реестра парсеров
+type registeredParser struct {
+	name     string
+	logType  LogType
+	priority int
+	parser   Parser
+}
+
 // Processor обрабатывает логи различных форматов
 type Processor struct {
-	syslogParser *parser.SyslogParser
-	cefParser    *parser.CEFParser
-	leefParser   *parser.LEEFParser
-	xmlParser    *parser.XMLParser
+	mu       sync.RWMutex
+	parsers  []*registeredParser
+	nextType LogType
+	rules    *rules.Engine
+
+	// Часовые пояса источников для TimezoneSetter
+	timezone      *time.Location
+	hostTimezones map[string]*time.Location
+
+	// Параметры ProcessStream
+	workers   int
+	unordered bool
+
+	// Идентификаторы по содержимому и дедупликация (dedup.go)
+	deterministicIDs bool
+	dedup            *deduplicator
+
+	// Мягкий режим (lenient.go)
+	lenient bool
+	// Заполнение Origin (origin.go)
+	origin bool
 }
 
-// NewProcessor создает новый процессор логов
+// NewProcessor создает новый процессор логов со встроенными парсерами
 func NewProcessor() *Processor {
-	return &Processor{
-		syslogParser: parser.NewSyslogParser(),
-		cefParser:    parser.NewCEFParser(),
-		leefParser:   parser.NewLEEFParser(),
-		xmlParser:    parser.NewXMLParser(),
+	p := &Processor{nextType: firstCustomLogType}
+
+	p.register("syslog", LogTypeSyslog, PrioritySyslog, parser.NewSyslogParser())
+	p.register("cef", LogTypeCEF, PriorityCEF, parser.NewCEFParser())
+	p.register("leef", LogTypeLEEF, PriorityLEEF, parser.NewLEEFParser())
+	p.register("xml", LogTypeXML, PriorityXML, parser.NewXMLParser())
+	p.register("json", LogTypeJSON, PriorityJSON, parser.NewJSONParser())
+	p.register("auditd", LogTypeAuditd, PriorityAuditd, parser.NewAuditdParser())
+	p.register("kv", LogTypeKV, PriorityKV, parser.NewKVParser())
+	p.register("grok", LogTypeGrok, PriorityGrok, parser.NewGrokParser())
+
+	return p
+}
+
+// RegisterParser добавляет парсер в реестр и возвращает выделенный ему тип лога.
+// Парсеры проверяются в порядке убывания приоритета, при равном приоритете -
+// в порядке регистрации.
+func (p *Processor) RegisterParser(name string, priority int, prs Parser) (LogType, error) {
+	if name == "" {
+		return LogTypeUnknown, fmt.Errorf("имя парсера не может быть пустым")
+	}
+	if prs == nil {
+		return LogTypeUnknown, fmt.Errorf("парсер %q не задан", name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.find(name) != nil {
+		return LogTypeUnknown, fmt.Errorf("парсер %q уже зарегистрирован", name)
+	}
+
+	if setter, ok := prs.(RulesSetter); ok && p.rules != nil {
+		setter.SetRules(p.rules)
+	}
+	p.applyTimezones(prs)
+
+	logType := p.nextType
+	p.nextType++
+	p.insert(&registeredParser{name: name, logType: logType, priority: priority, parser: prs})
+
+	return logType, nil
+}
+
+// SetRules задает правила классификации для всех зарегистрированных
+// парсеров, поддерживающих RulesSetter. Вызывается до начала обработки.
+func (p *Processor) SetRules(engine *rules.Engine) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rules = engine
+	for _, rp := range p.parsers {
+		if setter, ok := rp.parser.(RulesSetter); ok {
+			setter.SetRules(engine)
+		}
+	}
+}
+
+// SetTimezone задает часовой пояс по умолчанию для меток времени без
+// смещения во всех парсерах, поддерживающих TimezoneSetter
+func (p *Processor) SetTimezone(loc *time.Location) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.timezone = loc
+	for _, rp := range p.parsers {
+		p.applyTimezones(rp.parser)
+	}
+}
+
+// SetHostTimezone задает часовой пояс отдельного хоста
+func (p *Processor) SetHostTimezone(host string, loc *time.Location) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.hostTimezones == nil {
+		p.hostTimezones = make(map[string]*time.Location)
+	}
+	p.hostTimezones[host] = loc
+	for _, rp := range p.parsers {
+		p.applyTimezones(rp.parser)
+	}
+}
+
+// UnregisterParser удаляет парсер из реестра по имени
+func (p *Processor) UnregisterParser(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, rp := range p.parsers {
+		if rp.name == name {
+			p.parsers = append(p.parsers[:i], p.parsers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Parser возвращает зарегистрированный парсер по имени
+func (p *Processor) Parser(name string) (Parser, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if rp := p.find(name); rp != nil {
+		return rp.parser, true
+	}
+	return nil, false
+}
+
+// Parsers возвращает имена зарегистрированных парсеров в порядке проверки
+func (p *Processor) Parsers() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, 0, len(p.parsers))
+	for _, rp := range p.parsers {
+		names = append(names, rp.name)
+	}
+	return names
+}
+
+// LogTypeName возвращает имя парсера, которому принадлежит тип лога
+func (p *Processor) LogTypeName(logType LogType) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, rp := range p.parsers {
+		if rp.logType == logType {
+			return rp.name
+		}
 	}
+	return "unknown"
 }
 
-// Process обрабатывает лог и преобразует его в формат ГОСТ
+// Process обрабатывает лог и преобразует его в формат ГОСТ. Сообщение
+// другого формата внутри обертки (например, CEF в syslog) разбирается
+// своим парсером, поля заголовка переносятся в событие.
 func (p *Processor) Process(logLine string) (*models.GOSTEvent, error) {
-	logType := p.DetectLogType(logLine)
-	
-	switch logType {
-	case LogTypeSyslog:
-		return p.syslogParser.Parse(logLine)
-	case LogTypeCEF:
-		return p.cefParser.Parse(logLine)
-	case LogTypeLEEF:
-		return p.leefParser.Parse(logLine)
-	case LogTypeXML:
-		return p.xmlParser.Parse(logLine)
-	default:
-		return nil, fmt.Errorf("неизвестный тип лога")
-	}
-}
-
-// ProcessBatch обрабатывает массив логов
+	return p.process(logLine, true)
+}
+
+// process - Process; без dedup повторы не отбрасываются (потоковая
+// обработка проверяет их сама в порядке строк)
+func (p *Processor) process(logLine string, dedup bool) (*models.GOSTEvent, error) {
+	events, err := p.parseDetected(logLine, false)
+	if err != nil {
+		return nil, err
+	}
+	events, err = p.finish(logLine, events, dedup)
+	if err != nil {
+		return nil, err
+	}
+	return events[0], nil
+}
+
+// ProcessAll обрабатывает запись, которая может содержать несколько событий.
+// Для парсеров без MultiParser результат совпадает с Process.
+func (p *Processor) ProcessAll(logLine string) ([]*models.GOSTEvent, error) {
+	events, err := p.parseDetected(logLine, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.finish(logLine, events, true)
+}
+
+// parseDetected определяет формат строки и разбирает ее
+func (p *Processor) parseDetected(logLine string, all bool) ([]*models.GOSTEvent, error) {
+	var events []*models.GOSTEvent
+	err := fmt.Errorf("неизвестный тип лога")
+
+	d := p.detect(logLine)
+	if d != nil {
+		events, err = d.parse(logLine, all)
+	}
+	events, err = p.lenientEvents(logLine, d, events, err)
+	if err != nil {
+		return nil, err
+	}
+	p.setOrigin(logLine, d, events)
+	return events, nil
+}
+
+// ProcessWith обрабатывает строку парсером name без автоопределения формата.
+// Если парсер не распознает строку, но она передана в обертке (syslog),
+// разбирается вложенное сообщение.
+func (p *Processor) ProcessWith(name, logLine string) (*models.GOSTEvent, error) {
+	return p.processWith(name, logLine, true)
+}
+
+// processWith - ProcessWith; dedup - как у process
+func (p *Processor) processWith(name, logLine string, dedup bool) (*models.GOSTEvent, error) {
+	d, err := p.detectWith(name, logLine)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := d.parse(logLine, false)
+	events, err = p.lenientEvents(logLine, d, events, err)
+	if err != nil {
+		return nil, err
+	}
+	p.setOrigin(logLine, d, events)
+	events, err = p.finish(logLine, events, dedup)
+	if err != nil {
+		return nil, err
+	}
+	return events[0], nil
+}
+
+// Finish выполняет для событий, разобранных вызывающим кодом (например,
+// потоковой сборкой событий auditd из нескольких строк), завершающие шаги
+// Process: заполнение Origin, идентификаторы по содержимому и дедупликацию.
+// name - парсер, разобравший запись raw. Если все события отброшены как
+// повторы, возвращается ErrDuplicate.
+func (p *Processor) Finish(name, raw string, events []*models.GOSTEvent) ([]*models.GOSTEvent, error) {
+	p.mu.RLock()
+	rp := p.find(name)
+	p.mu.RUnlock()
+
+	if rp == nil {
+		return nil, fmt.Errorf("парсер %q не зарегистрирован", name)
+	}
+	p.setOrigin(raw, &detection{registeredParser: rp}, events)
+	return p.finish(raw, events, true)
+}
+
+// ProcessBatch обрабатывает массив логов параллельно (см. ProcessStream).
+// События возвращаются в порядке строк. В отличие от ProcessStream пустые
+// строки не пропускаются: для каждой возвращается ошибка с номером строки.
 func (p *Processor) ProcessBatch(logLines []string) ([]*models.GOSTEvent, []error) {
 	events := make([]*models.GOSTEvent, 0, len(logLines))
 	errors := make([]error, 0)
-	
-	for i, logLine := range logLines {
-		event, err := p.Process(logLine)
-		if err != nil {
-			errors = append(errors, fmt.Errorf("строка %d: %w", i+1, err))
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for _, logLine := range logLines {
+			lines <- logLine
+		}
+	}()
+
+	// Порядок событий сохраняется независимо от SetOrdered
+	p.mu.RLock()
+	workers := p.workers
+	p.mu.RUnlock()
+	process := func(logLine string) (*models.GOSTEvent, error) {
+		return p.process(logLine, false)
+	}
+	for result := range p.processStream(context.Background(), lines, workers, true, false, process) {
+		if result.Err != nil {
+			errors = append(errors, result.Err)
 			continue
 		}
-		events = append(events, event)
+		events = append(events, result.Event)
 	}
-	
+
 	return events, errors
 }
 
 // DetectLogType автоматически определяет тип лога
 func (p *Processor) DetectLogType(logLine string) LogType {
-	logLine = strings.TrimSpace(logLine)
-	
-	if strings.HasPrefix(logLine, "CEF:") {
-		return LogTypeCEF
-	}
-	
-	if strings.HasPrefix(logLine, "LEEF:") {
-		return LogTypeLEEF
-	}
-	
-	if strings.HasPrefix(logLine, "<") && strings.Contains(logLine, "<?xml") || 
-	   strings.HasPrefix(logLine, "<?xml") {
-		return LogTypeXML
-	}
-	
-	if strings.HasPrefix(logLine, "<Event") {
-		return LogTypeXML
-	}
-	
-	if strings.HasPrefix(logLine, "<") && strings.Contains(logLine, ">") {
-		priorityEnd := strings.Index(logLine, ">")
-		if priorityEnd > 0 && priorityEnd < 10 {
-			priority := logLine[1:priorityEnd]
-			if isNumeric(priority) {
-				return LogTypeSyslog
-			}
-		}
+	if d := p.detect(logLine); d != nil {
+		return d.logType
 	}
-	
 	return LogTypeUnknown
 }
 
@@ -125,11 +414,181 @@ func (p *Processor) ConvertBatchToJSON(events []*models.GOSTEvent) (string, erro
 	return string(data), nil
 }
 
-func isNumeric(s string) bool {
-	for _, c := range s {
-		if c < '0' || c > '9' {
-			return false
+// detection - результат автоопределения формата. Для сообщения в обертке
+// registeredParser - парсер вложенного формата, wrapper - парсер обертки.
+type detection struct {
+	*registeredParser
+	wrapper *registeredParser
+	header  *models.GOSTEvent
+	message string
+}
+
+// detect возвращает первый парсер, распознавший строку. Если это обертка
+// и вложенное сообщение распознает другой парсер, возвращается он.
+func (p *Processor) detect(logLine string) *detection {
+	logLine = strings.TrimSpace(logLine)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, rp := range p.parsers {
+		if !rp.parser.Detect(logLine) {
+			continue
+		}
+		if unwrapper, ok := rp.parser.(Unwrapper); ok {
+			if header, message, ok := unwrapper.Unwrap(logLine); ok {
+				if inner := p.detectInner(message); inner != nil {
+					return &detection{registeredParser: inner, wrapper: rp, header: header, message: message}
+				}
+			}
+		}
+		return &detection{registeredParser: rp}
+	}
+	return nil
+}
+
+// detectWith возвращает парсер name; если строку распознает только
+// обертка, возвращается разбор вложенного сообщения
+func (p *Processor) detectWith(name, logLine string) (*detection, error) {
+	logLine = strings.TrimSpace(logLine)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	rp := p.find(name)
+	if rp == nil {
+		return nil, fmt.Errorf("парсер %q не зарегистрирован", name)
+	}
+	if rp.parser.Detect(logLine) {
+		return &detection{registeredParser: rp}, nil
+	}
+
+	for _, wrapper := range p.parsers {
+		unwrapper, ok := wrapper.parser.(Unwrapper)
+		if !ok || wrapper == rp || !wrapper.parser.Detect(logLine) {
+			continue
+		}
+		header, message, ok := unwrapper.Unwrap(logLine)
+		if ok && rp.parser.Detect(strings.TrimSpace(message)) {
+			return &detection{registeredParser: rp, wrapper: wrapper, header: header, message: message}, nil
+		}
+	}
+	return &detection{registeredParser: rp}, nil
+}
+
+// detectInner ищет парсер вложенного сообщения; обертки не вкладываются
+// друг в друга
+func (p *Processor) detectInner(message string) *registeredParser {
+	message = strings.TrimSpace(message)
+	for _, rp := range p.parsers {
+		if _, ok := rp.parser.(Unwrapper); ok {
+			continue
+		}
+		if rp.parser.Detect(message) {
+			return rp
+		}
+	}
+	return nil
+}
+
+// parse разбирает строку найденным парсером; all - все события записи
+// (MultiParser). Если вложенное сообщение разобрать не удалось, строка
+// разбирается парсером обертки.
+func (d *detection) parse(logLine string, all bool) ([]*models.GOSTEvent, error) {
+	if d.wrapper == nil {
+		return parseWith(d.parser, logLine, all)
+	}
+
+	events, err := parseWith(d.parser, d.message, all)
+	if err != nil {
+		if wrapped, wrapErr := parseWith(d.wrapper.parser, logLine, all); wrapErr == nil {
+			// Строку разобрал парсер обертки
+			d.registeredParser, d.wrapper = d.wrapper, nil
+			return wrapped, nil
+		}
+		return nil, err
+	}
+	for _, event := range events {
+		mergeHeader(event, d.header)
+	}
+	return events, nil
+}
+
+func parseWith(prs Parser, logLine string, all bool) ([]*models.GOSTEvent, error) {
+	if multi, ok := prs.(MultiParser); ok && all {
+		return multi.ParseAll(logLine)
+	}
+
+	event, err := prs.Parse(logLine)
+	if err != nil {
+		return nil, err
+	}
+	return []*models.GOSTEvent{event}, nil
+}
+
+// mergeHeader переносит поля заголовка обертки во вложенное событие:
+// незаполненные поля источника, время (если во вложенном сообщении его нет)
+// и AdditionalData заголовка, не заданные вложенным парсером
+func mergeHeader(event, header *models.GOSTEvent) {
+	if event.Source.Hostname == "" {
+		event.Source.Hostname = header.Source.Hostname
+	}
+	if event.Source.IPAddress == "" {
+		event.Source.IPAddress = header.Source.IPAddress
+	}
+	if event.Source.Application == "" {
+		event.Source.Application = header.Source.Application
+	}
+	if event.Source.ProcessID == 0 {
+		event.Source.ProcessID = header.Source.ProcessID
+	}
+	if event.TimestampSynthesized && !header.TimestampSynthesized {
+		event.Timestamp = header.Timestamp
+		event.TimestampSynthesized = false
+	}
+
+	if event.AdditionalData == nil {
+		event.AdditionalData = make(map[string]interface{}, len(header.AdditionalData))
+	}
+	for key, value := range header.AdditionalData {
+		if _, ok := event.AdditionalData[key]; !ok {
+			event.AdditionalData[key] = value
+		}
+	}
+}
+
+// applyTimezones передает парсеру, поддерживающему TimezoneSetter,
+// часовые пояса процессора
+func (p *Processor) applyTimezones(prs Parser) {
+	setter, ok := prs.(TimezoneSetter)
+	if !ok {
+		return
+	}
+	if p.timezone != nil {
+		setter.SetTimezone(p.timezone)
+	}
+	for host, loc := range p.hostTimezones {
+		setter.SetHostTimezone(host, loc)
+	}
+}
+
+// register добавляет встроенный парсер с фиксированным типом лога
+func (p *Processor) register(name string, logType LogType, priority int, prs Parser) {
+	p.insert(&registeredParser{name: name, logType: logType, priority: priority, parser: prs})
+}
+
+func (p *Processor) insert(rp *registeredParser) {
+	p.parsers = append(p.parsers, rp)
+	sort.SliceStable(p.parsers, func(i, j int) bool {
+		return p.parsers[i].priority > p.parsers[j].priority
+	})
+}
+
+func (p *Processor) find(name string) *registeredParser {
+	for _, rp := range p.parsers {
+		if rp.name == name {
+			return rp
 		}
 	}
-	return len(s) > 0
+	return nil
 }
@@ -1,7 +1,19 @@
 package processor
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/parser"
+	"github.com/kxrty/loggerv2/internal/rules"
 )
 
 func TestProcessor_DetectLogType(t *testing.T) {
@@ -32,6 +44,46 @@ func TestProcessor_DetectLogType(t *testing.T) {
 			logLine:  "<134>Oct 11 22:14:15 mymachine test: message",
 			expected: LogTypeSyslog,
 		},
+		{
+			name:     "JSON format",
+			logLine:  `{"log":"hello\n","stream":"stdout","time":"2025-10-11T22:14:15Z"}`,
+			expected: LogTypeJSON,
+		},
+		{
+			name:     "Auditd format",
+			logLine:  `type=SYSCALL msg=audit(1697040000.123:4567): arch=c000003e syscall=59 success=yes`,
+			expected: LogTypeAuditd,
+		},
+		{
+			name:     "Logfmt format",
+			logLine:  `ts=2025-10-11T22:14:15Z level=error msg="db timeout" service=billing`,
+			expected: LogTypeKV,
+		},
+		{
+			name:     "FortiGate over syslog",
+			logLine:  `<189>date=2025-10-11 time=22:14:15 devname="FGT60E" devid="FGT60E4Q1600" logid="0000000013" type="traffic" srcip=10.1.1.5 dstip=8.8.8.8 action="accept"`,
+			expected: LogTypeKV,
+		},
+		{
+			name:     "CEF over syslog",
+			logLine:  `<134>Oct 11 22:14:15 fw01 CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1`,
+			expected: LogTypeCEF,
+		},
+		{
+			name:     "LEEF over RFC 5424",
+			logLine:  `<134>1 2025-10-11T22:14:15Z relay - - - - LEEF:1.0|Microsoft|MSExchange|4.0|15345|src=10.0.0.1`,
+			expected: LogTypeLEEF,
+		},
+		{
+			name:     "Syslog with kv fragments",
+			logLine:  `<38>Oct 11 22:14:15 srv01 sshd[2201]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 rhost=10.0.0.5 user=root`,
+			expected: LogTypeSyslog,
+		},
+		{
+			name:     "Nginx access log",
+			logLine:  `203.0.113.9 - - [11/Oct/2025:22:14:15 +0300] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`,
+			expected: LogTypeGrok,
+		},
 	}
 	
 	for _, tt := range tests {
@@ -122,3 +174,748 @@ func stringContains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestProcessor_RegisterParser(t *testing.T) {
+	proc := NewProcessor()
+
+	custom := ParserFuncs{
+		DetectFunc: func(logLine string) bool {
+			return strings.HasPrefix(logLine, "APP|")
+		},
+		ParseFunc: func(logLine string) (*models.GOSTEvent, error) {
+			return &models.GOSTEvent{Description: strings.TrimPrefix(logLine, "APP|")}, nil
+		},
+	}
+
+	logType, err := proc.RegisterParser("app", 50, custom)
+	if err != nil {
+		t.Fatalf("RegisterParser failed: %v", err)
+	}
+
+	if got := proc.DetectLogType("APP|hello"); got != logType {
+		t.Errorf("Expected %v, got %v", logType, got)
+	}
+
+	if name := proc.LogTypeName(logType); name != "app" {
+		t.Errorf("Expected name 'app', got '%s'", name)
+	}
+
+	event, err := proc.Process("APP|hello")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Description != "hello" {
+		t.Errorf("Unexpected description: %s", event.Description)
+	}
+
+	if _, err := proc.RegisterParser("app", 10, custom); err == nil {
+		t.Error("Expected error for duplicate parser name")
+	}
+}
+
+func TestProcessor_ParserPriority(t *testing.T) {
+	proc := NewProcessor()
+
+	// Парсер с наивысшим приоритетом перехватывает CEF строки
+	override := ParserFuncs{
+		DetectFunc: func(logLine string) bool { return strings.HasPrefix(logLine, "CEF:") },
+		ParseFunc: func(logLine string) (*models.GOSTEvent, error) {
+			return &models.GOSTEvent{Description: "override"}, nil
+		},
+	}
+
+	logType, err := proc.RegisterParser("cef-override", PriorityCEF+1, override)
+	if err != nil {
+		t.Fatalf("RegisterParser failed: %v", err)
+	}
+
+	if got := proc.DetectLogType("CEF:0|Vendor|Product|1.0|100|Test|5|src=1.1.1.1"); got != logType {
+		t.Errorf("Expected %v, got %v", logType, got)
+	}
+
+	if !proc.UnregisterParser("cef-override") {
+		t.Fatal("Expected parser to be unregistered")
+	}
+
+	if got := proc.DetectLogType("CEF:0|Vendor|Product|1.0|100|Test|5|src=1.1.1.1"); got != LogTypeCEF {
+		t.Errorf("Expected %v, got %v", LogTypeCEF, got)
+	}
+}
+
+func TestProcessor_SetRules(t *testing.T) {
+	proc := NewProcessor()
+
+	engine, err := rules.Load(strings.NewReader(`{"include_defaults": true, "rules": [
+    {"name": "su-failure", "formats": ["syslog"], "when": [{"field": "source.application", "equals": ["su"]}, {"field": "description", "contains": ["failed"]}],
+     "set": {"category": "АУТЕНТИФИКАЦИЯ", "result": "НЕУСПЕХ", "severity": "ВЫСОКИЙ"}}
+  ]}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	proc.SetRules(engine)
+
+	event, err := proc.Process("<134>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	if event.Result != models.ResultFailure {
+		t.Errorf("Expected result НЕУСПЕХ, got %s", event.Result)
+	}
+	if event.Severity != models.SeverityHigh {
+		t.Errorf("Expected severity ВЫСОКИЙ, got %s", event.Severity)
+	}
+
+	// Правила по умолчанию продолжают работать для остальных форматов
+	event, err = proc.Process("CEF:0|Security|IDS|1.0|100|Attack detected|10|src=10.0.0.1")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Category != models.CategorySecurityEvent {
+		t.Errorf("Expected category СОБЫТИЕ_БЕЗОПАСНОСТИ, got %s", event.Category)
+	}
+}
+
+func TestProcessor_SyslogWrapped(t *testing.T) {
+	proc := NewProcessor()
+
+	event, err := proc.Process("<134>Oct 11 22:14:15 fw01 CEF:0|Security|IDS|1.0|100|Attack detected|10|src=10.0.0.1")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Description != "Attack detected" || event.Category != models.CategorySecurityEvent {
+		t.Errorf("Expected CEF event, got %q %s", event.Description, event.Category)
+	}
+	if event.Source.Hostname != "fw01" || event.Source.IPAddress != "10.0.0.1" {
+		t.Errorf("Expected syslog host to fill source, got %+v", event.Source)
+	}
+	if event.TimestampSynthesized || event.Timestamp.Month() != 10 || event.Timestamp.Day() != 11 {
+		t.Errorf("Expected syslog timestamp, got %v", event.Timestamp)
+	}
+	if event.AdditionalData["syslog_facility"] != 16 || event.AdditionalData["syslog_hostname"] != "fw01" {
+		t.Errorf("Expected syslog header in AdditionalData, got %v", event.AdditionalData)
+	}
+
+	// Хост из CEF сохраняется, хост заголовка остается в syslog_hostname
+	event, err = proc.Process("<134>1 2025-10-11T22:14:15Z relay ids - - - CEF:0|Security|IDS|1.0|100|Attack|10|dvchost=sensor1")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Source.Hostname != "sensor1" || event.AdditionalData["syslog_hostname"] != "relay" {
+		t.Errorf("Unexpected host merge: %+v %v", event.Source, event.AdditionalData["syslog_hostname"])
+	}
+
+	// Невалидное вложенное сообщение разбирается как syslog
+	event, err = proc.Process("<134>Oct 11 22:14:15 host app: CEF:0|broken")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Description != "CEF:0|broken" || event.Source.Application != "app" {
+		t.Errorf("Expected syslog fallback, got %q %+v", event.Description, event.Source)
+	}
+}
+
+func TestProcessor_ProcessWith(t *testing.T) {
+	proc := NewProcessor()
+
+	// Строка syslog разбирается как syslog, хотя сообщение - журнал доступа
+	line := `<190>Oct 11 22:14:15 web01 nginx: 203.0.113.9 - bob [11/Oct/2025:22:14:15 +0300] "POST /login HTTP/1.1" 401 0 "-" "curl/8.0"`
+	event, err := proc.ProcessWith("grok", line)
+	if err != nil {
+		t.Fatalf("ProcessWith failed: %v", err)
+	}
+	if event.Action != "access_denied" || event.Result != models.ResultFailure || event.SubjectAccount == nil || event.SubjectAccount.Username != "bob" {
+		t.Errorf("Unexpected event %s/%s %+v", event.Action, event.Result, event.SubjectAccount)
+	}
+	if event.Source.Hostname != "web01" || event.AdditionalData["syslog_app_name"] != "nginx" {
+		t.Errorf("Expected syslog header to be merged, got %+v %v", event.Source, event.AdditionalData)
+	}
+
+	event, err = proc.ProcessWith("syslog", line)
+	if err != nil {
+		t.Fatalf("ProcessWith failed: %v", err)
+	}
+	if _, ok := event.AdditionalData["grok_profile"]; ok {
+		t.Error("Expected plain syslog event")
+	}
+
+	if _, err := proc.ProcessWith("grok", "<134>Oct 11 22:14:15 host app: free text"); err == nil {
+		t.Error("Expected error for line not matching grok")
+	}
+	if _, err := proc.ProcessWith("missing", line); err == nil {
+		t.Error("Expected error for unknown parser")
+	}
+
+	lines := make(chan string, 2)
+	lines <- `10.0.0.1 - - [11/Oct/2025:22:14:15 +0000] "GET / HTTP/1.1" 200 612`
+	lines <- `{"message": "json"}`
+	close(lines)
+	results, err := proc.ProcessStreamWith(context.Background(), "grok", lines)
+	if err != nil {
+		t.Fatalf("ProcessStreamWith failed: %v", err)
+	}
+	var parsed, failed int
+	for result := range results {
+		if result.Err != nil {
+			failed++
+		} else {
+			parsed++
+		}
+	}
+	if parsed != 1 || failed != 1 {
+		t.Errorf("Expected 1 parsed and 1 failed line, got %d and %d", parsed, failed)
+	}
+	if _, err := proc.ProcessStreamWith(context.Background(), "missing", lines); err == nil {
+		t.Error("Expected error for unknown parser")
+	}
+}
+
+func TestProcessor_ProcessStream(t *testing.T) {
+	proc := NewProcessor()
+	proc.SetWorkers(4)
+
+	var input []string
+	for i := 1; i <= 200; i++ {
+		switch {
+		case i%50 == 0:
+			input = append(input, "not a log line")
+		case i%40 == 0:
+			input = append(input, "")
+		default:
+			input = append(input, fmt.Sprintf("<134>Oct 11 22:14:15 host%d app: message %d", i, i))
+		}
+	}
+
+	run := func() []Result {
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			for _, line := range input {
+				lines <- line
+			}
+		}()
+
+		var results []Result
+		for result := range proc.ProcessStream(context.Background(), lines) {
+			results = append(results, result)
+		}
+		return results
+	}
+
+	// 200 строк, из них 4 пустых пропускаются
+	results := run()
+	if len(results) != 196 {
+		t.Fatalf("Expected 196 results, got %d", len(results))
+	}
+
+	prev := 0
+	for _, result := range results {
+		if result.Line <= prev {
+			t.Fatalf("Results out of order: line %d after %d", result.Line, prev)
+		}
+		prev = result.Line
+
+		if result.Line%50 == 0 {
+			if result.Err == nil || !strings.Contains(result.Err.Error(), fmt.Sprintf("строка %d:", result.Line)) {
+				t.Errorf("Expected error with line number %d, got %v", result.Line, result.Err)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("Line %d: unexpected error %v", result.Line, result.Err)
+			continue
+		}
+		if want := fmt.Sprintf("host%d", result.Line); result.Event.Source.Hostname != want {
+			t.Errorf("Line %d: expected hostname %s, got %s", result.Line, want, result.Event.Source.Hostname)
+		}
+	}
+
+	// Без сохранения порядка обрабатываются те же строки
+	proc.SetOrdered(false)
+	seen := make(map[int]bool)
+	for _, result := range run() {
+		seen[result.Line] = true
+	}
+	if len(seen) != 196 {
+		t.Errorf("Expected 196 distinct lines, got %d", len(seen))
+	}
+}
+
+func TestProcessor_ProcessBatchBlankLines(t *testing.T) {
+	proc := NewProcessor()
+	proc.SetLenient(true)
+
+	// В отличие от ProcessStream пустые строки возвращают ошибку, в том
+	// числе в мягком режиме
+	events, errs := proc.ProcessBatch([]string{
+		"<134>Oct 11 22:14:15 host app: message",
+		"",
+		"   ",
+		"not a log line",
+	})
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got %d", len(events))
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+	for i, line := range []int{2, 3} {
+		if !strings.HasPrefix(errs[i].Error(), fmt.Sprintf("строка %d:", line)) {
+			t.Errorf("Expected error for line %d, got %v", line, errs[i])
+		}
+	}
+}
+
+func TestProcessor_ProcessStreamCancel(t *testing.T) {
+	proc := NewProcessor()
+	lines := make(chan string)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	results := proc.ProcessStream(ctx, lines)
+	lines <- "<134>Oct 11 22:14:15 host app: message"
+	cancel()
+
+	// Канал результатов закрывается после отмены, хотя вход не закрыт
+	for range results {
+	}
+}
+
+func TestProcessor_DeterministicIDs(t *testing.T) {
+	proc := NewProcessor()
+	line := "<134>Oct 11 22:14:15 host app: message"
+	// Метка времени JSON отсутствует и подставляется при обработке
+	synthesized := `{"message": "no timestamp", "host": "app01"}`
+
+	first, _ := proc.Process(line)
+	second, _ := proc.Process(line)
+	if first.EventID == second.EventID {
+		t.Fatal("Expected random IDs by default")
+	}
+
+	proc.SetDeterministicIDs(true)
+	ids := make(map[string]bool)
+	for _, l := range []string{line, line, synthesized, synthesized} {
+		event, err := proc.Process(l)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+		if _, err := uuid.Parse(event.EventID); err != nil {
+			t.Errorf("Expected UUID, got %q", event.EventID)
+		}
+		ids[event.EventID] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected 2 distinct IDs, got %d", len(ids))
+	}
+
+	other, _ := proc.Process("<134>Oct 11 22:14:16 host app: message")
+	if ids[other.EventID] {
+		t.Error("Expected different ID for different timestamp")
+	}
+}
+
+func TestProcessor_Dedup(t *testing.T) {
+	proc := NewProcessor()
+	proc.SetDedup(DedupConfig{Window: time.Minute})
+	now := time.Date(2025, 10, 11, 22, 0, 0, 0, time.UTC)
+	proc.dedup.now = func() time.Time { return now }
+
+	line := "<134>Oct 11 22:14:15 host app: message"
+	if _, err := proc.Process(line); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := proc.Process(line); !errors.Is(err, ErrDuplicate) {
+			t.Fatalf("Expected ErrDuplicate, got %v", err)
+		}
+	}
+
+	// После окна событие выдается с числом отброшенных повторов
+	now = now.Add(2 * time.Minute)
+	event, err := proc.Process(line)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.AdditionalData["dedup_suppressed"] != 2 {
+		t.Errorf("Expected dedup_suppressed 2, got %v", event.AdditionalData["dedup_suppressed"])
+	}
+	if stats := proc.DedupStats(); stats.Unique != 2 || stats.Duplicates != 2 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	proc.SetDedup(DedupConfig{Window: time.Minute, Mode: DedupCount, MaxEntries: 1})
+	for i, l := range []string{line, line, "<134>Oct 11 22:14:15 host app: other", line} {
+		event, err := proc.Process(l)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+		count, counted := event.AdditionalData["dedup_count"]
+		// Четвертая строка забыта: MaxEntries вытесняет старые события
+		if wantCounted := i == 1; counted != wantCounted || (counted && count != 2) {
+			t.Errorf("Line %d: unexpected dedup_count %v", i, count)
+		}
+	}
+
+	if _, err := ParseDedupMode("skip"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+func TestProcessor_StreamDedupOrder(t *testing.T) {
+	var input []string
+	for i := 0; i < 2000; i++ {
+		input = append(input, fmt.Sprintf("<134>Oct 11 22:14:15 host app: message %d", i%7))
+	}
+
+	// При нескольких воркерах номер повтора соответствует порядку строк
+	for run := 0; run < 3; run++ {
+		proc := NewProcessor()
+		proc.SetWorkers(8)
+		proc.SetDedup(DedupConfig{Window: time.Hour, Mode: DedupCount})
+
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			for _, line := range input {
+				lines <- line
+			}
+		}()
+
+		seen := make(map[string]int)
+		for result := range proc.ProcessStream(context.Background(), lines) {
+			if result.Err != nil {
+				t.Fatalf("Line %d: unexpected error %v", result.Line, result.Err)
+			}
+			seen[result.Raw]++
+			count, _ := result.Event.AdditionalData["dedup_count"].(int)
+			if want := seen[result.Raw]; want > 1 && count != want || want == 1 && count != 0 {
+				t.Fatalf("Run %d, line %d: expected dedup_count %d, got %d", run, result.Line, want, count)
+			}
+		}
+	}
+}
+
+func TestProcessor_FlushDedup(t *testing.T) {
+	proc := NewProcessor()
+	proc.SetDedup(DedupConfig{Window: time.Minute})
+	now := time.Date(2025, 10, 11, 22, 0, 0, 0, time.UTC)
+	proc.dedup.now = func() time.Time { return now }
+
+	line := "<134>Oct 11 22:14:15 host app: message"
+	other := "<134>Oct 11 22:14:15 host app: other"
+	for _, l := range []string{line, line, line, other} {
+		proc.Process(l)
+	}
+	if events := proc.FlushDedup(false); len(events) != 0 {
+		t.Fatalf("Expected no events before window expiry, got %d", len(events))
+	}
+
+	// Повтор больше не приходит: число отброшенных выдается по истечении окна
+	now = now.Add(2 * time.Minute)
+	events := proc.FlushDedup(false)
+	if len(events) != 1 || events[0].AdditionalData["dedup_suppressed"] != 2 {
+		t.Fatalf("Expected one event with dedup_suppressed 2, got %+v", events)
+	}
+	if stats := proc.DedupStats(); stats.Entries != 0 {
+		t.Errorf("Expected expired entries to be forgotten, got %+v", stats)
+	}
+
+	// При завершении выдаются и незакрытые окна, но только один раз
+	proc.Process(line)
+	proc.Process(line)
+	if events := proc.FlushDedup(true); len(events) != 1 || events[0].AdditionalData["dedup_suppressed"] != 1 {
+		t.Fatalf("Expected final flush event, got %+v", events)
+	}
+	now = now.Add(2 * time.Minute)
+	event, err := proc.Process(line)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if _, ok := event.AdditionalData["dedup_suppressed"]; ok {
+		t.Error("Expected suppressed count to be reported once")
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	proc := NewProcessor()
+	var events []*models.GOSTEvent
+	for _, line := range []string{
+		"<134>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+		`<86>Oct 11 22:14:16 host sshd[42]: Accepted password for bob from 10.0.0.1 port 22 ssh2`,
+	} {
+		event, err := proc.Process(line)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	encode := func(format string, events []*models.GOSTEvent) string {
+		var b strings.Builder
+		encoder, err := NewEncoder(format, &b)
+		if err != nil {
+			t.Fatalf("NewEncoder(%s) failed: %v", format, err)
+		}
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				t.Fatalf("Encode(%s) failed: %v", format, err)
+			}
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatalf("Close(%s) failed: %v", format, err)
+		}
+		return b.String()
+	}
+
+	// ndjson: одно событие на строку
+	lines := strings.Split(strings.TrimSuffix(encode("ndjson", events), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 ndjson lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var event models.GOSTEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Errorf("Invalid ndjson line %q: %v", line, err)
+		}
+	}
+
+	// json-array: корректный массив, пустой вывод - []
+	var array []models.GOSTEvent
+	if err := json.Unmarshal([]byte(encode("json-array", events)), &array); err != nil || len(array) != 2 {
+		t.Errorf("Invalid json array (%d events): %v", len(array), err)
+	}
+	if array[1].Source.ProcessID != 42 || array[1].SubjectAccount == nil || array[1].SubjectAccount.Username != "bob" {
+		t.Errorf("Unexpected array event %+v", array[1])
+	}
+	if out := encode("json-array", nil); out != "[]\n" {
+		t.Errorf("Expected empty array, got %q", out)
+	}
+
+	// pretty совпадает с ConvertToJSON
+	pretty, _ := proc.ConvertToJSON(events[0])
+	if out := encode("pretty", events[:1]); out != pretty+"\n" {
+		t.Errorf("Unexpected pretty output %q", out)
+	}
+
+	// csv: заголовок и строка на событие
+	records, err := csv.NewReader(strings.NewReader(encode("csv", events))).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid csv: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "event_id" || len(records[1]) != len(records[0]) {
+		t.Fatalf("Unexpected csv records %v", records)
+	}
+	row := records[2]
+	if row[4] != "10.0.0.1" || row[7] != "42" || row[11] != "bob" || !strings.Contains(row[19], `"syslog_facility"`) {
+		t.Errorf("Unexpected csv row %v", row)
+	}
+	if out := encode("csv", nil); !strings.HasPrefix(out, "event_id,") {
+		t.Errorf("Expected csv header for empty output, got %q", out)
+	}
+
+	if _, err := NewEncoder("xml", &strings.Builder{}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestProcessor_Lenient(t *testing.T) {
+	proc := NewProcessor()
+
+	if _, err := proc.Process("free text line"); err == nil {
+		t.Fatal("Expected error without lenient mode")
+	}
+
+	proc.SetLenient(true)
+
+	event, err := proc.Process("free text line")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Category != models.CategorySystemEvent || event.Result != models.ResultUnknown || event.Description != "free text line" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if event.AdditionalData["parse_status"] != ParseStatusUnknownFormat || event.AdditionalData["parse_error"] != "неизвестный тип лога" {
+		t.Errorf("Unexpected additional data %v", event.AdditionalData)
+	}
+	if event.EventID == "" || !event.TimestampSynthesized {
+		t.Errorf("Expected generated id and timestamp, got %q %v", event.EventID, event.TimestampSynthesized)
+	}
+
+	// Формат определен, но разбор не удался: сохраняется заголовок syslog
+	events, err := proc.ProcessAll(`<134>Oct 11 22:14:15 fw01 CEF:0|broken`)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("ProcessAll failed: %v", err)
+	}
+	event = events[0]
+	if event.AdditionalData["parse_status"] != ParseStatusFailed || event.AdditionalData["parse_log_type"] != "cef" {
+		t.Errorf("Unexpected additional data %v", event.AdditionalData)
+	}
+	if event.Source.Hostname != "fw01" || event.TimestampSynthesized || event.AdditionalData["parse_error"] == "" {
+		t.Errorf("Expected syslog header to be kept, got %+v", event)
+	}
+
+	event, err = proc.ProcessWith("json", "not json")
+	if err != nil {
+		t.Fatalf("ProcessWith failed: %v", err)
+	}
+	if event.AdditionalData["parse_log_type"] != "json" || event.Description != "not json" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	// Пустые строки и ошибки настройки не маскируются
+	if _, err := proc.Process("   "); err == nil {
+		t.Error("Expected error for empty line")
+	}
+	if _, err := proc.ProcessWith("missing", "line"); err == nil {
+		t.Error("Expected error for unknown parser")
+	}
+
+	// Повторы отбрасываются и в мягком режиме
+	proc.SetDedup(DedupConfig{Window: time.Minute})
+	proc.Process("free text line")
+	if _, err := proc.Process("free text line"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+}
+
+func TestProcessor_Origin(t *testing.T) {
+	proc := NewProcessor()
+
+	line := "<134>Oct 11 22:14:15 fw01 CEF:0|Vendor|Product|1.0|100|Blocked|5|src=10.0.0.1"
+	event, err := proc.Process(line)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Origin != nil {
+		t.Fatal("Expected no origin by default")
+	}
+
+	proc.SetOrigin(true)
+	before := time.Now().UTC()
+	event, err = proc.Process(line)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	origin := event.Origin
+	if origin == nil || origin.Raw != line || origin.Format != "cef" || origin.ParserVersion != "cef/"+Version {
+		t.Fatalf("Unexpected origin %+v", origin)
+	}
+	if origin.IngestTime.Before(before) {
+		t.Errorf("Unexpected ingest time %v", origin.IngestTime)
+	}
+
+	// Парсер с собственной версией
+	if _, err := proc.RegisterParser("ticket", 500, versionedParser{}); err != nil {
+		t.Fatalf("RegisterParser failed: %v", err)
+	}
+	event, err = proc.Process("TICKET-1")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Origin.Format != "ticket" || event.Origin.ParserVersion != "ticket/2.3" {
+		t.Errorf("Unexpected origin %+v", event.Origin)
+	}
+
+	// Событие мягкого режима
+	proc.SetLenient(true)
+	event, err = proc.Process("free text")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if event.Origin.Format != "unknown" || event.Origin.Raw != "free text" || event.Origin.ParserVersion != "" {
+		t.Errorf("Unexpected origin %+v", event.Origin)
+	}
+
+	// Вывод без исходной строки
+	var b strings.Builder
+	encoder, err := NewEncoder("ndjson", &b)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	encoder = OmitRaw(encoder)
+	encoder.Encode(event)
+	encoder.Close()
+	if strings.Contains(b.String(), `"raw"`) || !strings.Contains(b.String(), `"format":"unknown"`) || event.Origin.Raw == "" {
+		t.Errorf("Unexpected output %s", b.String())
+	}
+}
+
+func TestProcessor_Finish(t *testing.T) {
+	proc := NewProcessor()
+	proc.SetOrigin(true)
+	proc.SetDeterministicIDs(true)
+	proc.SetDedup(DedupConfig{Window: time.Minute})
+
+	log := "type=SYSCALL msg=audit(1697040040.000:10): arch=c000003e syscall=42 success=yes exit=0 items=0 pid=4000 auid=1000 uid=1000 comm=\"curl\" exe=\"/usr/bin/curl\"\n" +
+		"type=EOE msg=audit(1697040040.000:10):\n"
+
+	// Тот же журнал дважды: второе событие - повтор. В исходную запись
+	// входят записи события без завершающей EOE
+	var events []*models.GOSTEvent
+	var lines []int
+	var duplicates int
+	err := parser.NewAuditdParser().ParseRecords(strings.NewReader(log+log), func(event *models.GOSTEvent, raw string, line int) error {
+		lines = append(lines, line)
+		finished, err := proc.Finish("auditd", raw, []*models.GOSTEvent{event})
+		if errors.Is(err, ErrDuplicate) {
+			duplicates++
+			return nil
+		}
+		events = append(events, finished...)
+		return err
+	}, nil)
+	if err != nil {
+		t.Fatalf("ParseRecords failed: %v", err)
+	}
+
+	if len(events) != 1 || duplicates != 1 {
+		t.Fatalf("Expected 1 event and 1 duplicate, got %d and %d", len(events), duplicates)
+	}
+	if len(lines) != 2 || lines[0] != 1 || lines[1] != 3 {
+		t.Errorf("Expected events at lines 1 and 3, got %v", lines)
+	}
+	origin := events[0].Origin
+	if origin == nil || origin.Format != "auditd" || origin.Raw != strings.SplitN(log, "\n", 2)[0] {
+		t.Errorf("Unexpected origin %+v", origin)
+	}
+	if _, err := uuid.Parse(events[0].EventID); err != nil {
+		t.Errorf("Unexpected event id %q", events[0].EventID)
+	}
+
+	if _, err := proc.Finish("missing", "", nil); err == nil {
+		t.Error("Expected error for unknown parser")
+	}
+}
+
+type versionedParser struct{}
+
+func (versionedParser) Detect(logLine string) bool { return strings.HasPrefix(logLine, "TICKET-") }
+
+func (versionedParser) Parse(logLine string) (*models.GOSTEvent, error) {
+	return &models.GOSTEvent{Description: logLine}, nil
+}
+
+func (versionedParser) Version() string { return "2.3" }
+
+func TestProcessor_Configure(t *testing.T) {
+	proc := NewProcessor()
+
+	if err := proc.ConfigureTimezones("Europe/Moscow", "fw01=UTC"); err != nil {
+		t.Errorf("ConfigureTimezones failed: %v", err)
+	}
+	if err := proc.ConfigureTimezones("Mars/Olympus", ""); err == nil {
+		t.Error("Expected error for unknown timezone")
+	}
+	if err := proc.ConfigureKV("", " ", "="); err != nil {
+		t.Errorf("ConfigureKV failed: %v", err)
+	}
+	if err := proc.ConfigureGrok("", ""); err != nil {
+		t.Errorf("ConfigureGrok failed: %v", err)
+	}
+	if err := proc.ConfigureDedup(true, time.Minute, "unknown", 0); err == nil {
+		t.Error("Expected error for unknown dedup mode")
+	}
+	if err := proc.LoadJSONProfiles("/nonexistent/profiles.json"); err == nil {
+		t.Error("Expected error for missing profiles file")
+	}
+}
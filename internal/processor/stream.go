@@ -0,0 +1,202 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// streamWindow - число строк в обработке на одного воркера; ограничивает
+// память при упорядоченной выдаче, если одна строка обрабатывается долго
+const streamWindow = 64
+
+// Result - результат обработки строки потока
+type Result struct {
+	// Line - номер строки во входном потоке, начиная с 1
+	Line  int
+	Raw   string
+	Event *models.GOSTEvent
+	// Err содержит ошибку разбора с номером строки
+	Err error
+
+	seq int
+}
+
+// streamJob - строка, переданная воркеру
+type streamJob struct {
+	seq  int
+	line int
+	raw  string
+}
+
+// SetWorkers задает число воркеров ProcessStream (n <= 0 - по числу CPU)
+func (p *Processor) SetWorkers(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers = n
+}
+
+// SetOrdered задает, сохраняет ли ProcessStream порядок входных строк
+// (по умолчанию сохраняет). Без сохранения порядка повторы проверяются в
+// порядке готовности, и какое из одинаковых событий будет выдано (и с
+// каким dedup_count), зависит от запуска.
+func (p *Processor) SetOrdered(ordered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unordered = !ordered
+}
+
+// ProcessStream обрабатывает строки из канала пулом воркеров и возвращает
+// канал результатов, который закрывается после окончания входа или отмены
+// ctx. Пустые строки пропускаются, но учитываются в нумерации.
+func (p *Processor) ProcessStream(ctx context.Context, lines <-chan string) <-chan Result {
+	p.mu.RLock()
+	workers, ordered := p.workers, !p.unordered
+	p.mu.RUnlock()
+
+	process := func(logLine string) (*models.GOSTEvent, error) {
+		return p.process(logLine, false)
+	}
+	return p.processStream(ctx, lines, workers, ordered, true, process)
+}
+
+// ProcessStreamWith работает как ProcessStream, но разбирает все строки
+// парсером name (см. ProcessWith)
+func (p *Processor) ProcessStreamWith(ctx context.Context, name string, lines <-chan string) (<-chan Result, error) {
+	if _, ok := p.Parser(name); !ok {
+		return nil, fmt.Errorf("парсер %q не зарегистрирован", name)
+	}
+
+	p.mu.RLock()
+	workers, ordered := p.workers, !p.unordered
+	p.mu.RUnlock()
+
+	process := func(logLine string) (*models.GOSTEvent, error) {
+		return p.processWith(name, logLine, false)
+	}
+	return p.processStream(ctx, lines, workers, ordered, true, process), nil
+}
+
+// processStream обрабатывает строки пулом воркеров; при skipBlank пустые
+// строки не передаются в process, иначе разбираются как остальные.
+// process не должен отбрасывать повторы: дедупликация выполняется при
+// выдаче результатов, а при ordered - в порядке строк, поэтому результат
+// не зависит от числа воркеров.
+func (p *Processor) processStream(ctx context.Context, lines <-chan string, workers int, ordered, skipBlank bool, process func(string) (*models.GOSTEvent, error)) <-chan Result {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make(chan streamJob, workers)
+	results := make(chan Result, workers)
+	out := make(chan Result, workers)
+	window := make(chan struct{}, workers*streamWindow)
+
+	go func() {
+		defer close(jobs)
+
+		line, seq := 0, 0
+		for {
+			var raw string
+			select {
+			case <-ctx.Done():
+				return
+			case l, ok := <-lines:
+				if !ok {
+					return
+				}
+				raw = l
+			}
+
+			line++
+			if skipBlank && strings.TrimSpace(raw) == "" {
+				continue
+			}
+
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- streamJob{seq: seq, line: line, raw: raw}:
+			case <-ctx.Done():
+				return
+			}
+			seq++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := Result{Line: job.line, Raw: job.raw, seq: job.seq}
+				result.Event, result.Err = process(job.raw)
+				if result.Err != nil {
+					result.Err = fmt.Errorf("строка %d: %w", job.line, result.Err)
+				}
+
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		defer close(out)
+
+		emit := func(result Result) bool {
+			if result.Err == nil && p.isDuplicate(result.Raw, result.Event) {
+				result.Event = nil
+				result.Err = fmt.Errorf("строка %d: %w", result.Line, ErrDuplicate)
+			}
+			select {
+			case out <- result:
+				<-window
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		pending := make(map[int]Result)
+		next := 0
+		for result := range results {
+			if !ordered {
+				if !emit(result) {
+					return
+				}
+				continue
+			}
+
+			pending[result.seq] = result
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if !emit(r) {
+					return
+				}
+				next++
+			}
+		}
+	}()
+
+	return out
+}
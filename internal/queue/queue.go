@@ -0,0 +1,688 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ошибки очереди
+var (
+	ErrEmpty    = errors.New("очередь пуста")
+	ErrFull     = errors.New("очередь переполнена")
+	ErrClosed   = errors.New("очередь закрыта")
+	ErrTooLarge = errors.New("запись превышает максимальный размер очереди")
+	ErrNoData   = errors.New("пустая запись")
+	// ErrCorrupt - запись на диске повреждена (неверная длина или
+	// контрольная сумма); удалить ее можно через Discard
+	ErrCorrupt = errors.New("запись очереди повреждена")
+)
+
+// OverflowPolicy определяет поведение Push при достижении MaxSize
+type OverflowPolicy int
+
+const (
+	// OverflowReject - Push возвращает ErrFull, новая запись отбрасывается
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropOldest - из очереди удаляются самые старые записи
+	OverflowDropOldest
+	// OverflowBlock - Push ждет, пока потребитель освободит место
+	OverflowBlock
+)
+
+// ParseOverflowPolicy разбирает имя политики: reject, drop-oldest, block
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch name {
+	case "reject", "drop-newest":
+		return OverflowReject, nil
+	case "drop-oldest":
+		return OverflowDropOldest, nil
+	case "block":
+		return OverflowBlock, nil
+	}
+	return OverflowReject, fmt.Errorf("неизвестная политика переполнения: %s", name)
+}
+
+// DefaultSegmentSize - размер сегмента по умолчанию
+const DefaultSegmentSize = 16 * 1024 * 1024
+
+const (
+	segmentExt   = ".seg"
+	cursorFile   = "cursor"
+	headerSize   = 8 // длина (uint32) + CRC32 (uint32)
+	cursorFormat = "%d %d\n"
+)
+
+// Options - параметры очереди
+type Options struct {
+	// SegmentSize - размер файла сегмента, после которого начинается новый
+	SegmentSize int64
+	// MaxSize - ограничение суммарного размера неподтвержденных записей
+	// в байтах (0 - без ограничения)
+	MaxSize int64
+	// Overflow - политика при достижении MaxSize
+	Overflow OverflowPolicy
+	// Sync включает fsync после каждой записи и подтверждения
+	Sync bool
+}
+
+// Stats - счетчики очереди
+type Stats struct {
+	Records  int
+	Bytes    int64
+	Segments int
+	Dropped  int64
+	// Corrupt - записи, удаленные через Discard
+	Corrupt int64
+	// CorruptBytes - байты поврежденных сегментов, отброшенные при Open
+	// (недописанная последняя запись после сбоя сюда не входит)
+	CorruptBytes int64
+}
+
+// Position - позиция записи в очереди. Peek возвращает позицию выданной
+// записи, Ack и Discard по ней проверяют, что запись все еще первая.
+type Position struct {
+	segment uint64
+	offset  int64
+}
+
+// Queue - очередь записей на диске (write-ahead log из файлов-сегментов).
+// Записи читаются в порядке добавления; позиция чтения сохраняется при
+// подтверждении (Ack), поэтому после перезапуска неподтвержденные записи
+// будут выданы повторно.
+type Queue struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	space    *sync.Cond
+	ready    chan struct{}
+	segments []uint64
+	head     Position
+	tail     *os.File
+	tailSize int64
+	reader   *os.File
+	readSeg  uint64
+	records  int
+	bytes    int64
+	dropped  int64
+	corrupt  int64
+	lost     int64
+	closed   bool
+}
+
+// Open открывает очередь в каталоге dir, восстанавливая ее состояние
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога очереди: %w", err)
+	}
+
+	q := &Queue{dir: dir, opts: opts, ready: make(chan struct{}, 1)}
+	q.space = sync.NewCond(&q.mu)
+
+	if err := q.recover(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+	if q.records > 0 {
+		q.notify()
+	}
+
+	return q, nil
+}
+
+// Push добавляет запись в конец очереди
+func (q *Queue) Push(data []byte) error {
+	size := int64(headerSize + len(data))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if len(data) == 0 {
+		return ErrNoData
+	}
+	if q.opts.MaxSize > 0 && size > q.opts.MaxSize {
+		return ErrTooLarge
+	}
+
+	for q.opts.MaxSize > 0 && q.bytes+size > q.opts.MaxSize {
+		switch q.opts.Overflow {
+		case OverflowDropOldest:
+			err := q.advance()
+			if errors.Is(err, ErrCorrupt) {
+				err = q.skipSegment()
+			}
+			if err != nil {
+				return err
+			}
+			q.dropped++
+		case OverflowBlock:
+			q.space.Wait()
+			if q.closed {
+				return ErrClosed
+			}
+		default:
+			q.dropped++
+			return ErrFull
+		}
+	}
+
+	if q.tailSize > 0 && q.tailSize+size > q.opts.SegmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[headerSize:], data)
+
+	if _, err := q.tail.Write(record); err != nil {
+		return fmt.Errorf("ошибка записи в очередь: %w", err)
+	}
+	if q.opts.Sync {
+		if err := q.tail.Sync(); err != nil {
+			return fmt.Errorf("ошибка синхронизации очереди: %w", err)
+		}
+	}
+
+	q.tailSize += size
+	q.records++
+	q.bytes += size
+	q.notify()
+
+	return nil
+}
+
+// Peek возвращает первую неподтвержденную запись и ее позицию, не удаляя
+// запись. Для поврежденной записи возвращается ErrCorrupt и ее позиция.
+func (q *Queue) Peek() ([]byte, Position, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, Position{}, ErrClosed
+	}
+	if q.records == 0 {
+		return nil, Position{}, ErrEmpty
+	}
+
+	data, _, err := q.readAt(q.head)
+	return data, q.head, err
+}
+
+// Ack подтверждает обработку записи pos, полученной от Peek, и сохраняет
+// позицию чтения. Если запись уже удалена из очереди (например, вытеснена
+// при OverflowDropOldest), Ack ничего не делает.
+func (q *Queue) Ack(pos Position) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.records == 0 || q.head != pos {
+		return nil
+	}
+
+	return q.advance()
+}
+
+// Discard удаляет запись pos, которую невозможно обработать, и учитывает
+// ее в Stats.Corrupt. У записи с поврежденным заголовком длина неизвестна,
+// поэтому отбрасывается весь остаток ее сегмента. Как и Ack, ничего не
+// делает, если запись уже удалена из очереди.
+func (q *Queue) Discard(pos Position) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.records == 0 || q.head != pos {
+		return nil
+	}
+
+	_, _, err := q.readAt(q.head)
+	if errors.Is(err, ErrCorrupt) {
+		return q.skipSegment()
+	}
+	if err != nil {
+		return err
+	}
+	q.corrupt++
+	return q.advance()
+}
+
+// Ready возвращает канал, получающий сигнал при появлении новых записей
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Stats возвращает текущие счетчики очереди
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		Records:      q.records,
+		Bytes:        q.bytes,
+		Segments:     len(q.segments),
+		Dropped:      q.dropped,
+		Corrupt:      q.corrupt,
+		CorruptBytes: q.lost,
+	}
+}
+
+// Close закрывает файлы очереди; записанные данные сохраняются на диске
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.space.Broadcast()
+
+	return q.closeFiles()
+}
+
+// advance сдвигает позицию чтения за первую запись, удаляя прочитанные сегменты
+func (q *Queue) advance() error {
+	_, size, err := q.readAt(q.head)
+	if err != nil {
+		return err
+	}
+
+	q.head.offset += size
+	q.records--
+	q.bytes -= size
+
+	for q.head.segment != q.segments[len(q.segments)-1] && q.head.offset >= q.segmentSize(q.head.segment) {
+		if err := q.removeSegment(q.head.segment); err != nil {
+			return err
+		}
+		q.head = Position{segment: q.segments[0]}
+	}
+
+	q.space.Broadcast()
+	return q.saveCursor()
+}
+
+// skipSegment отбрасывает остаток сегмента первой записи и пересчитывает
+// счетчики по оставшимся сегментам
+func (q *Queue) skipSegment() error {
+	if q.head.segment == q.segments[len(q.segments)-1] {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := q.removeSegment(q.head.segment); err != nil {
+		return err
+	}
+	q.head = Position{segment: q.segments[0]}
+
+	records, bytes := 0, int64(0)
+	for _, id := range q.segments {
+		valid, n, err := scanSegment(q.segmentPath(id), 0)
+		if err != nil {
+			return err
+		}
+		records += n
+		bytes += valid
+	}
+
+	lost := int64(q.records - records)
+	if lost < 1 {
+		lost = 1
+	}
+	q.corrupt += lost
+	q.records, q.bytes = records, bytes
+
+	q.space.Broadcast()
+	return q.saveCursor()
+}
+
+// readAt читает запись по позиции и возвращает данные и полный размер записи
+func (q *Queue) readAt(pos Position) ([]byte, int64, error) {
+	if q.reader == nil || q.readSeg != pos.segment {
+		if q.reader != nil {
+			q.reader.Close()
+		}
+		file, err := os.Open(q.segmentPath(pos.segment))
+		if err != nil {
+			q.reader = nil
+			return nil, 0, fmt.Errorf("ошибка открытия сегмента: %w", err)
+		}
+		q.reader = file
+		q.readSeg = pos.segment
+	}
+
+	data, err := readRecord(q.reader, pos.offset, q.segmentSize(pos.segment))
+	if err != nil {
+		return nil, 0, fmt.Errorf("сегмент %d, смещение %d: %w", pos.segment, pos.offset, err)
+	}
+	return data, int64(headerSize + len(data)), nil
+}
+
+// recover восстанавливает состояние по файлам сегментов и курсору.
+// Поврежденная часть сегмента отбрасывается, как при Discard: записи до
+// повреждения сохраняются, очередь продолжает со следующего сегмента.
+// Отброшенные байты учитываются в Stats.CorruptBytes.
+func (q *Queue) recover() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения каталога очереди: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, id)
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if len(q.segments) == 0 {
+		q.segments = []uint64{1}
+	}
+	q.head = Position{segment: q.segments[0]}
+
+	if data, err := os.ReadFile(filepath.Join(q.dir, cursorFile)); err == nil {
+		var cursor Position
+		if _, err := fmt.Sscanf(string(data), cursorFormat, &cursor.segment, &cursor.offset); err == nil {
+			// Сегменты до курсора уже обработаны
+			for len(q.segments) > 1 && q.segments[0] < cursor.segment {
+				if err := os.Remove(q.segmentPath(q.segments[0])); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("ошибка удаления сегмента: %w", err)
+				}
+				q.segments = q.segments[1:]
+			}
+			// Курсор за концом сегмента не используется: Truncate дополнил
+			// бы файл нулями. Сегмент тогда читается с начала.
+			if q.segments[0] == cursor.segment && cursor.offset >= 0 && cursor.offset <= fileSize(q.segmentPath(cursor.segment)) {
+				q.head = cursor
+			}
+		}
+	}
+
+	last := q.segments[len(q.segments)-1]
+	segments := q.segments[:0]
+	for _, id := range q.segments {
+		start := int64(0)
+		if id == q.head.segment {
+			start = q.head.offset
+		}
+		valid, records, err := scanSegment(q.segmentPath(id), start)
+		if err != nil {
+			return err
+		}
+		size := fileSize(q.segmentPath(id))
+		if id == last {
+			// Недописанная последняя запись - обычное следствие сбоя, она
+			// отбрасывается без учета как повреждение
+			if valid < size && !tornRecord(q.segmentPath(id), valid, size) {
+				q.lost += size - valid
+			}
+		} else if valid < size {
+			q.lost += size - valid
+			if records == 0 {
+				if err := os.Remove(q.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("ошибка удаления сегмента: %w", err)
+				}
+				continue
+			}
+			if err := os.Truncate(q.segmentPath(id), valid); err != nil {
+				return fmt.Errorf("ошибка восстановления сегмента: %w", err)
+			}
+		}
+		segments = append(segments, id)
+		q.records += records
+		q.bytes += valid - start
+		if id == last {
+			q.tailSize = valid
+		}
+	}
+	q.segments = segments
+	if q.head.segment != q.segments[0] {
+		q.head = Position{segment: q.segments[0]}
+	}
+
+	tail, err := os.OpenFile(q.segmentPath(last), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия сегмента: %w", err)
+	}
+	// Отбрасываем недописанную запись в конце последнего сегмента
+	if err := tail.Truncate(q.tailSize); err != nil {
+		tail.Close()
+		return fmt.Errorf("ошибка восстановления сегмента: %w", err)
+	}
+	if _, err := tail.Seek(q.tailSize, io.SeekStart); err != nil {
+		tail.Close()
+		return fmt.Errorf("ошибка восстановления сегмента: %w", err)
+	}
+	q.tail = tail
+
+	return nil
+}
+
+// rotate начинает новый сегмент
+func (q *Queue) rotate() error {
+	if q.opts.Sync {
+		q.tail.Sync()
+	}
+	if err := q.tail.Close(); err != nil {
+		return fmt.Errorf("ошибка закрытия сегмента: %w", err)
+	}
+
+	id := q.segments[len(q.segments)-1] + 1
+	tail, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("ошибка создания сегмента: %w", err)
+	}
+
+	q.segments = append(q.segments, id)
+	q.tail = tail
+	q.tailSize = 0
+	return nil
+}
+
+func (q *Queue) removeSegment(id uint64) error {
+	if q.reader != nil && q.readSeg == id {
+		q.reader.Close()
+		q.reader = nil
+	}
+	if err := os.Remove(q.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("ошибка удаления сегмента: %w", err)
+	}
+	q.segments = q.segments[1:]
+	return nil
+}
+
+// saveCursor атомарно сохраняет позицию чтения
+func (q *Queue) saveCursor() error {
+	path := filepath.Join(q.dir, cursorFile)
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения позиции очереди: %w", err)
+	}
+	fmt.Fprintf(file, cursorFormat, q.head.segment, q.head.offset)
+	if q.opts.Sync {
+		file.Sync()
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("ошибка сохранения позиции очереди: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("ошибка сохранения позиции очереди: %w", err)
+	}
+	return nil
+}
+
+func (q *Queue) segmentSize(id uint64) int64 {
+	if id == q.segments[len(q.segments)-1] {
+		return q.tailSize
+	}
+	info, err := os.Stat(q.segmentPath(id))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (q *Queue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) closeFiles() error {
+	var err error
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+	if q.tail != nil {
+		if q.opts.Sync {
+			q.tail.Sync()
+		}
+		err = q.tail.Close()
+		q.tail = nil
+	}
+	return err
+}
+
+// scanSegment проверяет записи сегмента начиная с offset и возвращает
+// смещение конца последней целой записи и число записей
+func scanSegment(path string, offset int64) (int64, int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return offset, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка открытия сегмента: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка чтения сегмента: %w", err)
+	}
+
+	records := 0
+	for {
+		data, err := readRecord(file, offset, info.Size())
+		if err != nil {
+			return offset, records, nil
+		}
+		offset += int64(headerSize + len(data))
+		records++
+	}
+}
+
+// readRecord читает и проверяет запись по смещению; size - размер сегмента
+func readRecord(file *os.File, offset, size int64) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := file.ReadAt(header[:], offset); err == io.EOF {
+		return nil, fmt.Errorf("%w: заголовок записи обрезан", ErrCorrupt)
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка чтения заголовка записи: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	// Пустые записи не пишутся: нулевой заголовок - заполнение нулями после
+	// сбоя. Длина проверяется до выделения памяти под запись.
+	if length == 0 {
+		return nil, fmt.Errorf("%w: нулевая длина записи", ErrCorrupt)
+	}
+	if int64(length) > size-offset-headerSize {
+		return nil, fmt.Errorf("%w: длина записи %d больше остатка сегмента", ErrCorrupt, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, offset+headerSize); err == io.EOF {
+		return nil, fmt.Errorf("%w: запись обрезана", ErrCorrupt)
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка чтения записи: %w", err)
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, fmt.Errorf("%w: неверная контрольная сумма", ErrCorrupt)
+	}
+
+	return data, nil
+}
+
+// fileSize возвращает размер файла (0, если файл недоступен)
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// tornRecord проверяет, что данные сегмента с offset до size - одна
+// недописанная запись: обрезанный заголовок, запись, выходящая за конец
+// файла, или заполнение нулями
+func tornRecord(path string, offset, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	var header [headerSize]byte
+	if _, err := file.ReadAt(header[:], offset); err != nil {
+		return err == io.EOF
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > 0 {
+		return offset+headerSize+length > size
+	}
+
+	rest := make([]byte, 32*1024)
+	for pos := offset; pos < size; {
+		n, err := file.ReadAt(rest, pos)
+		for _, b := range rest[:n] {
+			if b != 0 {
+				return false
+			}
+		}
+		pos += int64(n)
+		if err != nil {
+			return err == io.EOF
+		}
+	}
+	return true
+}
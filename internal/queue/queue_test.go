@@ -0,0 +1,403 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func pop(t *testing.T, q *Queue) string {
+	t.Helper()
+	data, pos, err := q.Peek()
+	if err != nil {
+		t.Fatalf("Peek failed: %v", err)
+	}
+	if err := q.Ack(pos); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	return string(data)
+}
+
+func TestQueue_OrderAndRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, Options{SegmentSize: 64})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := q.Push([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+	if got := q.Stats().Segments; got < 2 {
+		t.Errorf("Expected several segments, got %d", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := pop(t, q); got != fmt.Sprintf("record-%d", i) {
+			t.Errorf("Expected record-%d, got %s", i, got)
+		}
+	}
+	// Прочитанная, но не подтвержденная запись должна вернуться после перезапуска
+	if _, _, err := q.Peek(); err != nil {
+		t.Fatalf("Peek failed: %v", err)
+	}
+	q.Close()
+
+	q, err = Open(dir, Options{SegmentSize: 64})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer q.Close()
+
+	if got := q.Stats().Records; got != 7 {
+		t.Fatalf("Expected 7 records after restart, got %d", got)
+	}
+	for i := 3; i < 10; i++ {
+		if got := pop(t, q); got != fmt.Sprintf("record-%d", i) {
+			t.Errorf("Expected record-%d, got %s", i, got)
+		}
+	}
+	if _, _, err := q.Peek(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	if got := q.Stats().Segments; got != 1 {
+		t.Errorf("Expected consumed segments to be removed, got %d", got)
+	}
+}
+
+func TestQueue_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	q.Push([]byte("first"))
+	q.Push([]byte("second"))
+	q.Close()
+
+	// Имитируем обрыв записи: обрезаем последнюю запись наполовину
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(matches) != 1 {
+		t.Fatalf("Expected one segment, got %d", len(matches))
+	}
+	info, _ := os.Stat(matches[0])
+	if err := os.Truncate(matches[0], info.Size()-3); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	q, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer q.Close()
+
+	if got := q.Stats().Records; got != 1 {
+		t.Fatalf("Expected 1 record, got %d", got)
+	}
+	q.Push([]byte("third"))
+
+	if got := pop(t, q); got != "first" {
+		t.Errorf("Expected first, got %s", got)
+	}
+	if got := pop(t, q); got != "third" {
+		t.Errorf("Expected third, got %s", got)
+	}
+}
+
+func TestQueue_Overflow(t *testing.T) {
+	record := []byte("rec-0")
+	limit := int64(3 * (headerSize + len(record)))
+
+	t.Run("reject", func(t *testing.T) {
+		q, err := Open(t.TempDir(), Options{MaxSize: limit, Overflow: OverflowReject})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer q.Close()
+
+		for i := 0; i < 3; i++ {
+			if err := q.Push(record); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+		}
+		if err := q.Push(record); !errors.Is(err, ErrFull) {
+			t.Errorf("Expected ErrFull, got %v", err)
+		}
+		if got := q.Stats().Dropped; got != 1 {
+			t.Errorf("Expected 1 dropped, got %d", got)
+		}
+	})
+
+	t.Run("drop-oldest", func(t *testing.T) {
+		q, err := Open(t.TempDir(), Options{MaxSize: limit, Overflow: OverflowDropOldest})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer q.Close()
+
+		for i := 0; i < 5; i++ {
+			if err := q.Push([]byte(fmt.Sprintf("rec-%d", i))); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+		}
+		stats := q.Stats()
+		if stats.Records != 3 || stats.Dropped != 2 {
+			t.Errorf("Expected 3 records and 2 dropped, got %+v", stats)
+		}
+		if got := pop(t, q); got != "rec-2" {
+			t.Errorf("Expected oldest remaining rec-2, got %s", got)
+		}
+	})
+
+	t.Run("drop-oldest in flight", func(t *testing.T) {
+		q, err := Open(t.TempDir(), Options{MaxSize: limit, Overflow: OverflowDropOldest})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer q.Close()
+
+		for i := 0; i < 3; i++ {
+			q.Push([]byte(fmt.Sprintf("rec-%d", i)))
+		}
+		// Выданная запись вытесняется до подтверждения: Ack не должен
+		// удалить следующую, еще не доставленную запись
+		data, pos, err := q.Peek()
+		if err != nil || string(data) != "rec-0" {
+			t.Fatalf("Peek failed: %q, %v", data, err)
+		}
+		q.Push([]byte("rec-3"))
+		if err := q.Ack(pos); err != nil {
+			t.Fatalf("Ack failed: %v", err)
+		}
+
+		if stats := q.Stats(); stats.Records != 3 || stats.Dropped != 1 {
+			t.Errorf("Expected 3 records and 1 dropped, got %+v", stats)
+		}
+		if got := pop(t, q); got != "rec-1" {
+			t.Errorf("Expected rec-1, got %s", got)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		q, err := Open(t.TempDir(), Options{MaxSize: limit, Overflow: OverflowBlock})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer q.Close()
+
+		for i := 0; i < 3; i++ {
+			q.Push(record)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- q.Push(record) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("Push should block on full queue, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		pop(t, q)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Push failed: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Push was not unblocked by Ack")
+		}
+	})
+}
+
+func TestQueue_Corrupt(t *testing.T) {
+	t.Run("zero padding", func(t *testing.T) {
+		dir := t.TempDir()
+
+		q, err := Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		q.Push([]byte("first"))
+		q.Close()
+
+		// После сбоя файл дополнен нулями: это не пустые записи
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		file, err := os.OpenFile(matches[0], os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Open segment failed: %v", err)
+		}
+		file.Write(make([]byte, 64))
+		file.Close()
+
+		q, err = Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Reopen failed: %v", err)
+		}
+		defer q.Close()
+
+		if stats := q.Stats(); stats.Records != 1 || stats.CorruptBytes != 0 {
+			t.Fatalf("Expected 1 record and no corrupt bytes, got %+v", stats)
+		}
+		if err := q.Push(nil); !errors.Is(err, ErrNoData) {
+			t.Errorf("Expected ErrNoData, got %v", err)
+		}
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		dir := t.TempDir()
+
+		q, err := Open(dir, Options{SegmentSize: 40})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer q.Close()
+
+		for i := 0; i < 4; i++ {
+			q.Push([]byte(fmt.Sprintf("record-%d", i)))
+		}
+
+		// Повреждаем длину первой записи: она больше остатка сегмента
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		file, err := os.OpenFile(matches[0], os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Open segment failed: %v", err)
+		}
+		file.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 0)
+		file.Close()
+
+		_, pos, err := q.Peek()
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Expected ErrCorrupt, got %v", err)
+		}
+		if err := q.Discard(pos); err != nil {
+			t.Fatalf("Discard failed: %v", err)
+		}
+
+		// Вместе с записью отброшен остаток ее сегмента (record-1)
+		stats := q.Stats()
+		if stats.Records != 2 || stats.Corrupt != 2 {
+			t.Errorf("Expected 2 records and 2 corrupt, got %+v", stats)
+		}
+		if got := pop(t, q); got != "record-2" {
+			t.Errorf("Expected record-2, got %s", got)
+		}
+	})
+
+	t.Run("corrupt segment on open", func(t *testing.T) {
+		dir := t.TempDir()
+
+		q, err := Open(dir, Options{SegmentSize: 40})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		for i := 0; i < 6; i++ {
+			q.Push([]byte(fmt.Sprintf("record-%d", i)))
+		}
+		q.Close()
+
+		// Повреждаем вторую запись первого сегмента и обрезаем второй
+		// сегмент посередине записи
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		if len(matches) != 3 {
+			t.Fatalf("Expected 3 segments, got %d", len(matches))
+		}
+		file, err := os.OpenFile(matches[0], os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Open segment failed: %v", err)
+		}
+		file.WriteAt([]byte{0xff}, 20)
+		file.Close()
+		if err := os.Truncate(matches[1], 10); err != nil {
+			t.Fatalf("Truncate failed: %v", err)
+		}
+
+		// Очередь открывается, поврежденные части сегментов отброшены
+		q, err = Open(dir, Options{SegmentSize: 40})
+		if err != nil {
+			t.Fatalf("Reopen failed: %v", err)
+		}
+		defer q.Close()
+
+		stats := q.Stats()
+		if stats.Records != 3 || stats.CorruptBytes != 26 {
+			t.Errorf("Expected 3 records and 26 corrupt bytes, got %+v", stats)
+		}
+		for _, want := range []string{"record-0", "record-4", "record-5"} {
+			if got := pop(t, q); got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		}
+	})
+
+	t.Run("corrupt tail segment on open", func(t *testing.T) {
+		dir := t.TempDir()
+
+		q, err := Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			q.Push([]byte(fmt.Sprintf("record-%d", i)))
+		}
+		q.Close()
+
+		// Повреждаем данные второй записи: она и следующая за ней
+		// отбрасываются и учитываются как повреждение
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		file, err := os.OpenFile(matches[0], os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Open segment failed: %v", err)
+		}
+		file.WriteAt([]byte{'X'}, 16+headerSize)
+		file.Close()
+
+		q, err = Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Reopen failed: %v", err)
+		}
+		defer q.Close()
+
+		if stats := q.Stats(); stats.Records != 1 || stats.CorruptBytes != 32 {
+			t.Errorf("Expected 1 record and 32 corrupt bytes, got %+v", stats)
+		}
+		if got := pop(t, q); got != "record-0" {
+			t.Errorf("Expected record-0, got %s", got)
+		}
+	})
+
+	t.Run("cursor beyond segment", func(t *testing.T) {
+		dir := t.TempDir()
+
+		q, err := Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		q.Push([]byte("record-0"))
+		q.Close()
+
+		// Курсор указывает за конец сегмента: сегмент читается с начала
+		// и не дополняется нулями
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		os.WriteFile(filepath.Join(dir, cursorFile), []byte("1 4096\n"), 0o644)
+
+		q, err = Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("Reopen failed: %v", err)
+		}
+		defer q.Close()
+
+		if info, err := os.Stat(matches[0]); err != nil || info.Size() != 16 {
+			t.Errorf("Expected segment to keep its size, got %v %v", info, err)
+		}
+		if stats := q.Stats(); stats.Records != 1 || stats.CorruptBytes != 0 {
+			t.Errorf("Unexpected stats %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package rules
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+//go:embed default_rules.json
+var defaultRulesJSON []byte
+
+// defaultEngine - встроенный набор правил, воспроизводящий исходную
+// классификацию парсеров
+var defaultEngine *Engine
+
+func init() {
+	defaultEngine = mustLoad(defaultRulesJSON)
+}
+
+// Condition описывает проверку одного поля события. Все заданные проверки
+// должны выполниться; списки Equals, Contains и Prefix срабатывают при
+// совпадении с любым элементом. Сравнение строк регистронезависимое.
+type Condition struct {
+	Field    string   `json:"field"`
+	Equals   []string `json:"equals,omitempty"`
+	Contains []string `json:"contains,omitempty"`
+	Prefix   []string `json:"prefix,omitempty"`
+	Regex    string   `json:"regex,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Exists   *bool    `json:"exists,omitempty"`
+	Not      bool     `json:"not,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Assignment задает значения полей ГОСТ, назначаемые правилом.
+// Значение может ссылаться на поле события в виде ${field}.
+type Assignment struct {
+	Category string `json:"category,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Result   string `json:"result,omitempty"`
+	Action   string `json:"action,omitempty"`
+}
+
+// Rule - декларативное правило классификации
+type Rule struct {
+	Name    string      `json:"name"`
+	Formats []string    `json:"formats,omitempty"`
+	When    []Condition `json:"when,omitempty"`
+	Set     Assignment  `json:"set"`
+}
+
+// ruleFile - структура файла правил
+type ruleFile struct {
+	IncludeDefaults bool   `json:"include_defaults"`
+	Rules           []Rule `json:"rules"`
+}
+
+// Engine назначает Category, Severity, Result и Action по списку правил.
+// Для каждого поля используется первое подходящее правило, задающее его;
+// если ни одно правило не подошло, поле не изменяется.
+type Engine struct {
+	rules []Rule
+}
+
+// Default возвращает встроенный набор правил
+func Default() *Engine {
+	return defaultEngine
+}
+
+// New создает движок из списка правил
+func New(rules []Rule) (*Engine, error) {
+	compiled := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if err := compile(&rule); err != nil {
+			return nil, fmt.Errorf("правило %d (%s): %w", i+1, rule.Name, err)
+		}
+		compiled[i] = rule
+	}
+	return &Engine{rules: compiled}, nil
+}
+
+// Load читает правила в формате JSON (другие форматы не поддерживаются).
+// Без include_defaults правила файла заменяют встроенный набор целиком,
+// включая правила Windows и auditd.
+func Load(r io.Reader) (*Engine, error) {
+	var file ruleFile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("ошибка чтения правил: %w", err)
+	}
+
+	rules := file.Rules
+	if file.IncludeDefaults {
+		rules = append(rules, defaultEngine.rules...)
+	}
+
+	return New(rules)
+}
+
+// LoadFile читает правила из файла
+func LoadFile(path string) (*Engine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла правил: %w", err)
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Rules возвращает копию списка правил движка
+func (e *Engine) Rules() []Rule {
+	if e == nil {
+		e = defaultEngine
+	}
+	return append([]Rule(nil), e.rules...)
+}
+
+// Apply применяет правила формата format к событию.
+// Nil-движок использует встроенный набор правил.
+func (e *Engine) Apply(format string, event *models.GOSTEvent) {
+	if e == nil {
+		e = defaultEngine
+	}
+
+	var category, severity, result, action bool
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if category && severity && result && action {
+			return
+		}
+		if !rule.appliesTo(format) || !rule.matches(event) {
+			continue
+		}
+
+		if rule.Set.Category != "" && !category {
+			event.Category = expand(rule.Set.Category, event)
+			category = true
+		}
+		if rule.Set.Severity != "" && !severity {
+			event.Severity = expand(rule.Set.Severity, event)
+			severity = true
+		}
+		if rule.Set.Result != "" && !result {
+			event.Result = expand(rule.Set.Result, event)
+			result = true
+		}
+		if rule.Set.Action != "" && !action {
+			event.Action = expand(rule.Set.Action, event)
+			action = true
+		}
+	}
+}
+
+// Field возвращает строковое значение поля события по имени: поля ГОСТ
+// адресуются как "description", "source.hostname", "subject.username" и т.д.,
+// остальные имена ищутся в AdditionalData.
+func Field(event *models.GOSTEvent, name string) (string, bool) {
+	switch name {
+	case "description":
+		return event.Description, true
+	case "category":
+		return event.Category, true
+	case "severity":
+		return event.Severity, true
+	case "result":
+		return event.Result, true
+	case "action":
+		return event.Action, true
+	case "source.hostname":
+		return event.Source.Hostname, true
+	case "source.ip_address":
+		return event.Source.IPAddress, true
+	case "source.application":
+		return event.Source.Application, true
+	case "source.process":
+		return event.Source.Process, true
+	case "subject.username", "subject.domain", "object.username", "object.domain":
+		account := event.SubjectAccount
+		if strings.HasPrefix(name, "object.") {
+			account = event.ObjectAccount
+		}
+		if account == nil {
+			return "", false
+		}
+		if strings.HasSuffix(name, ".username") {
+			return account.Username, true
+		}
+		return account.Domain, true
+	}
+
+	value, ok := event.AdditionalData[name]
+	if !ok || value == nil {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+func (r *Rule) appliesTo(format string) bool {
+	if len(r.Formats) == 0 {
+		return true
+	}
+	for _, f := range r.Formats {
+		if strings.EqualFold(f, format) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matches(event *models.GOSTEvent) bool {
+	for i := range r.When {
+		if !r.When[i].matches(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Condition) matches(event *models.GOSTEvent) bool {
+	value, ok := Field(event, c.Field)
+	return c.check(value, ok) != c.Not
+}
+
+func (c *Condition) check(value string, exists bool) bool {
+	if c.Exists != nil && *c.Exists != exists {
+		return false
+	}
+	if !exists {
+		// Для отсутствующего поля имеет смысл только проверка exists
+		return c.Exists != nil
+	}
+
+	lower := strings.ToLower(value)
+
+	if len(c.Equals) > 0 && !anyOf(c.Equals, func(s string) bool { return lower == strings.ToLower(s) }) {
+		return false
+	}
+	if len(c.Contains) > 0 && !anyOf(c.Contains, func(s string) bool { return strings.Contains(lower, strings.ToLower(s)) }) {
+		return false
+	}
+	if len(c.Prefix) > 0 && !anyOf(c.Prefix, func(s string) bool { return strings.HasPrefix(lower, strings.ToLower(s)) }) {
+		return false
+	}
+	if c.re != nil && !c.re.MatchString(value) {
+		return false
+	}
+	if c.Min != nil || c.Max != nil {
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return false
+		}
+		if c.Min != nil && number < *c.Min {
+			return false
+		}
+		if c.Max != nil && number > *c.Max {
+			return false
+		}
+	}
+
+	return true
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand подставляет значения полей события вместо ${field}
+func expand(value string, event *models.GOSTEvent) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+	return os.Expand(value, func(name string) string {
+		v, _ := Field(event, name)
+		return v
+	})
+}
+
+// compile проверяет правило и компилирует регулярные выражения
+func compile(rule *Rule) error {
+	if rule.Set == (Assignment{}) {
+		return fmt.Errorf("правило не назначает ни одного поля")
+	}
+	if err := validate(rule.Set.Category, categories, "категория"); err != nil {
+		return err
+	}
+	if err := validate(rule.Set.Severity, severities, "критичность"); err != nil {
+		return err
+	}
+	if err := validate(rule.Set.Result, results, "результат"); err != nil {
+		return err
+	}
+
+	conditions := make([]Condition, len(rule.When))
+	for i, cond := range rule.When {
+		if cond.Field == "" {
+			return fmt.Errorf("условие %d: не задано поле", i+1)
+		}
+		if cond.Regex != "" {
+			re, err := regexp.Compile(cond.Regex)
+			if err != nil {
+				return fmt.Errorf("условие %d: %w", i+1, err)
+			}
+			cond.re = re
+		}
+		conditions[i] = cond
+	}
+	rule.When = conditions
+
+	return nil
+}
+
+var (
+	categories = []string{
+		models.CategoryAuthentication, models.CategoryAuthorization, models.CategoryAccess,
+		models.CategoryDataModification, models.CategorySystemEvent, models.CategorySecurityEvent,
+		models.CategoryNetworkEvent,
+	}
+	severities = []string{
+		models.SeverityCritical, models.SeverityHigh, models.SeverityMedium,
+		models.SeverityLow, models.SeverityInfo,
+	}
+	results = []string{models.ResultSuccess, models.ResultFailure, models.ResultUnknown}
+)
+
+// validate проверяет, что значение входит в список допустимых констант ГОСТ.
+// Значения с подстановкой ${field} не проверяются.
+func validate(value string, allowed []string, what string) error {
+	if value == "" || strings.Contains(value, "$") {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("недопустимое значение (%s): %s", what, value)
+}
+
+func mustLoad(data []byte) *Engine {
+	engine, err := Load(strings.NewReader(string(data)))
+	if err != nil {
+		panic(fmt.Sprintf("встроенные правила: %v", err))
+	}
+	return engine
+}
@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+func TestEngine_FirstMatchWins(t *testing.T) {
+	engine, err := Load(strings.NewReader(`{
+  "rules": [
+    {"name": "vpn-login", "formats": ["cef"], "when": [{"field": "description", "contains": ["vpn"]}, {"field": "cef_outcome", "equals": ["failure"]}],
+     "set": {"category": "АУТЕНТИФИКАЦИЯ", "severity": "ВЫСОКИЙ", "result": "НЕУСПЕХ", "action": "vpn-${cef_act}"}},
+    {"name": "catch-all", "set": {"category": "СИСТЕМНОЕ_СОБЫТИЕ", "severity": "НИЗКИЙ"}}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	event := &models.GOSTEvent{
+		Description: "VPN Login",
+		AdditionalData: map[string]interface{}{
+			"cef_outcome": "Failure",
+			"cef_act":     "connect",
+		},
+	}
+
+	engine.Apply("cef", event)
+
+	if event.Category != models.CategoryAuthentication {
+		t.Errorf("Expected category АУТЕНТИФИКАЦИЯ, got %s", event.Category)
+	}
+	if event.Severity != models.SeverityHigh {
+		t.Errorf("Expected severity ВЫСОКИЙ, got %s", event.Severity)
+	}
+	if event.Result != models.ResultFailure {
+		t.Errorf("Expected result НЕУСПЕХ, got %s", event.Result)
+	}
+	if event.Action != "vpn-connect" {
+		t.Errorf("Expected action 'vpn-connect', got '%s'", event.Action)
+	}
+
+	other := &models.GOSTEvent{Description: "VPN Login", Result: models.ResultUnknown}
+	engine.Apply("leef", other)
+
+	if other.Severity != models.SeverityLow {
+		t.Errorf("Expected catch-all severity НИЗКИЙ, got %s", other.Severity)
+	}
+	if other.Result != models.ResultUnknown {
+		t.Errorf("Expected result to stay НЕИЗВЕСТНО, got %s", other.Result)
+	}
+}
+
+func TestEngine_NumericRange(t *testing.T) {
+	engine, err := New([]Rule{{
+		Name: "logon-range",
+		When: []Condition{{Field: "xml_event_id", Min: float64Ptr(4624), Max: float64Ptr(4634)}},
+		Set:  Assignment{Category: models.CategoryAuthentication},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	event := &models.GOSTEvent{AdditionalData: map[string]interface{}{"xml_event_id": 4625}}
+	engine.Apply("xml", event)
+	if event.Category != models.CategoryAuthentication {
+		t.Errorf("Expected category АУТЕНТИФИКАЦИЯ, got %s", event.Category)
+	}
+
+	event = &models.GOSTEvent{AdditionalData: map[string]interface{}{"xml_event_id": 4720}}
+	engine.Apply("xml", event)
+	if event.Category != "" {
+		t.Errorf("Expected category to stay empty, got %s", event.Category)
+	}
+}
+
+func TestLoad_IncludeDefaults(t *testing.T) {
+	engine, err := Load(strings.NewReader(`{"include_defaults": true, "rules": [
+    {"name": "ssh", "formats": ["syslog"], "when": [{"field": "source.application", "equals": ["sshd"]}], "set": {"category": "АУТЕНТИФИКАЦИЯ"}}
+  ]}`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(engine.Rules()) != len(Default().Rules())+1 {
+		t.Errorf("Expected default rules to be appended, got %d rules", len(engine.Rules()))
+	}
+}
+
+func TestLoad_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unknown category", `{"rules": [{"name": "x", "set": {"category": "LOGIN"}}]}`},
+		{"empty assignment", `{"rules": [{"name": "x", "set": {}}]}`},
+		{"bad regex", `{"rules": [{"name": "x", "when": [{"field": "description", "regex": "("}], "set": {"severity": "НИЗКИЙ"}}]}`},
+		{"unknown key", `{"rules": [{"name": "x", "match": [], "set": {"severity": "НИЗКИЙ"}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(strings.NewReader(tt.data)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,340 @@
+package siem
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/rules"
+)
+
+// Filter - выражение отбора событий для получателя Router.
+//
+// Синтаксис: сравнения "поле оператор значение", объединенные && и ||,
+// отрицание ! и скобки. Операторы: == != ~= (регулярное выражение)
+// > >= < <=. Поля - как в правилах классификации (severity, category,
+// source.hostname, ключи AdditionalData). Для severity сравнение идет по
+// уровню критичности, для чисел - численно, иначе - как строк. Значения
+// с пробелами берутся в кавычки. Пустое выражение пропускает все события.
+//
+//	severity >= ВЫСОКИЙ && category != СИСТЕМНОЕ_СОБЫТИЕ
+//	source.hostname ~= "^dc[0-9]+" || result == НЕУСПЕХ
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// severityRank - порядок уровней критичности для сравнения
+var severityRank = map[string]int{
+	models.SeverityInfo:     0,
+	models.SeverityLow:      1,
+	models.SeverityMedium:   2,
+	models.SeverityHigh:     3,
+	models.SeverityCritical: 4,
+}
+
+// ParseFilter разбирает выражение фильтра
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{expr: expr}
+	if strings.TrimSpace(expr) == "" {
+		return f, nil
+	}
+
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора фильтра %q: %w", expr, err)
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("лишний элемент %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора фильтра %q: %w", expr, err)
+	}
+
+	f.root = root
+	return f, nil
+}
+
+// Match проверяет, подходит ли событие под фильтр
+func (f *Filter) Match(event *models.GOSTEvent) bool {
+	if f == nil || f.root == nil {
+		return true
+	}
+	return f.root.match(event)
+}
+
+// String возвращает исходное выражение
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+type filterNode interface {
+	match(event *models.GOSTEvent) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(event *models.GOSTEvent) bool {
+	return n.left.match(event) && n.right.match(event)
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(event *models.GOSTEvent) bool {
+	return n.left.match(event) || n.right.match(event)
+}
+
+type notNode struct{ node filterNode }
+
+func (n notNode) match(event *models.GOSTEvent) bool {
+	return !n.node.match(event)
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (n compareNode) match(event *models.GOSTEvent) bool {
+	actual, ok := rules.Field(event, n.field)
+	if !ok {
+		actual, ok = rules.Field(event, strings.ToLower(n.field))
+	}
+	if !ok {
+		// Отсутствующее поле подходит только под !=
+		return n.op == "!="
+	}
+
+	switch n.op {
+	case "==":
+		return strings.EqualFold(actual, n.value)
+	case "!=":
+		return !strings.EqualFold(actual, n.value)
+	case "~=":
+		return n.re.MatchString(actual)
+	}
+
+	cmp, ok := compareValues(strings.ToLower(n.field), actual, n.value)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+// compareValues сравнивает значения с учетом типа поля
+func compareValues(field, actual, expected string) (int, bool) {
+	if field == "severity" {
+		a, okA := severityRank[strings.ToUpper(actual)]
+		b, okB := severityRank[strings.ToUpper(expected)]
+		if !okA || !okB {
+			return 0, false
+		}
+		return a - b, true
+	}
+
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(expected, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return strings.Compare(actual, expected), true
+}
+
+// filterToken - лексема выражения фильтра
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+var filterOperators = []string{"&&", "||", "==", "!=", "~=", ">=", "<=", ">", "<", "!", "(", ")"}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if unicode.IsSpace(r) {
+			i++
+			continue
+		}
+
+		if r == '"' {
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("незакрытая кавычка")
+			}
+			tokens = append(tokens, filterToken{text: sb.String(), quoted: true})
+			i = j + 1
+			continue
+		}
+
+		if op := operatorAt(runes[i:]); op != "" {
+			tokens = append(tokens, filterToken{text: op})
+			i += len([]rune(op))
+			continue
+		}
+
+		j := i
+		for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '"' && operatorAt(runes[j:]) == "" {
+			j++
+		}
+		tokens = append(tokens, filterToken{text: string(runes[i:j])})
+		i = j
+	}
+
+	return tokens, nil
+}
+
+func operatorAt(runes []rune) string {
+	for _, op := range filterOperators {
+		if strings.HasPrefix(string(runes[:min(len(runes), 2)]), op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// filterParser - рекурсивный спуск: or -> and -> unary -> comparison
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek(op string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].text == op
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.peek("!") {
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+
+	if p.peek("(") {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("ожидалась )")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("неполное сравнение")
+	}
+
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.quoted || isFilterOperator(field.text) {
+		return nil, fmt.Errorf("ожидалось имя поля, получено %q", field.text)
+	}
+	if op.quoted {
+		return nil, fmt.Errorf("ожидался оператор после %q", field.text)
+	}
+	switch op.text {
+	case "==", "!=", "~=", ">", ">=", "<", "<=":
+	default:
+		return nil, fmt.Errorf("неизвестный оператор %q", op.text)
+	}
+	if !value.quoted && isFilterOperator(value.text) {
+		return nil, fmt.Errorf("ожидалось значение после %q", op.text)
+	}
+	p.pos += 3
+
+	node := compareNode{field: field.text, op: op.text, value: value.text}
+	if op.text == "~=" {
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("неверное регулярное выражение %q: %w", value.text, err)
+		}
+		node.re = re
+	}
+	return node, nil
+}
+
+func isFilterOperator(text string) bool {
+	for _, op := range filterOperators {
+		if text == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package siem
+
+import "github.com/kxrty/loggerv2/internal/models"
+
+// Forwarder - общий интерфейс получателей событий SIEM
+type Forwarder interface {
+	// Forward отправляет одно событие
+	Forward(event *models.GOSTEvent) error
+	// ForwardBatch отправляет несколько событий; ошибки по отдельным
+	// событиям объединяются через errors.Join
+	ForwardBatch(events []*models.GOSTEvent) error
+	// Close освобождает ресурсы получателя
+	Close() error
+}
+
+var (
+	_ Forwarder = (*SyslogForwarder)(nil)
+	_ Forwarder = (*HTTPForwarder)(nil)
+	_ Forwarder = (*QueuedForwarder)(nil)
+	_ Forwarder = (*Router)(nil)
+)
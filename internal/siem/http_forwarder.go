@@ -103,3 +103,9 @@ func (f *HTTPForwarder) ForwardBatch(events []*models.GOSTEvent) error {
 
 	return nil
 }
+
+// Close закрывает неиспользуемые соединения HTTP клиента
+func (f *HTTPForwarder) Close() error {
+	f.client.CloseIdleConnections()
+	return nil
+}
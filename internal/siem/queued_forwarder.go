@@ -0,0 +1,167 @@
+package siem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/queue"
+)
+
+// eventForwarder - получатель, которому QueuedForwarder доставляет события
+type eventForwarder interface {
+	Forward(event *models.GOSTEvent) error
+}
+
+// QueueStats - счетчики QueuedForwarder
+type QueueStats struct {
+	queue.Stats
+	Delivered int64
+	Retries   int64
+}
+
+// QueuedForwarder сохраняет события в очередь на диске и доставляет их
+// получателю в фоне в порядке поступления. Пока получатель недоступен,
+// события накапливаются в очереди (с учетом ее ограничения размера) и
+// переживают перезапуск процесса.
+type QueuedForwarder struct {
+	target     eventForwarder
+	queue      *queue.Queue
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	delivered atomic.Int64
+	retries   atomic.Int64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewQueuedForwarder создает форвардер поверх открытой очереди и запускает
+// доставку. Очередь закрывается вместе с форвардером, получатель - нет.
+func NewQueuedForwarder(target eventForwarder, q *queue.Queue) *QueuedForwarder {
+	f := &QueuedForwarder{
+		target:     target,
+		queue:      q,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go f.run()
+	return f
+}
+
+// Forward помещает событие в очередь
+func (f *QueuedForwarder) Forward(event *models.GOSTEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации события: %w", err)
+	}
+
+	if err := f.queue.Push(payload); err != nil {
+		return fmt.Errorf("ошибка постановки события в очередь: %w", err)
+	}
+	return nil
+}
+
+// ForwardBatch помещает в очередь несколько событий
+func (f *QueuedForwarder) ForwardBatch(events []*models.GOSTEvent) error {
+	var errs []error
+	for i, event := range events {
+		if err := f.Forward(event); err != nil {
+			errs = append(errs, fmt.Errorf("событие %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats возвращает счетчики очереди и доставки
+func (f *QueuedForwarder) Stats() QueueStats {
+	return QueueStats{
+		Stats:     f.queue.Stats(),
+		Delivered: f.delivered.Load(),
+		Retries:   f.retries.Load(),
+	}
+}
+
+// Close останавливает доставку и закрывает очередь. Недоставленные
+// события остаются на диске до следующего запуска.
+func (f *QueuedForwarder) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		close(f.stop)
+		<-f.done
+		err = f.queue.Close()
+	})
+	return err
+}
+
+// run доставляет события из очереди, пока форвардер не закрыт
+func (f *QueuedForwarder) run() {
+	defer close(f.done)
+
+	delay := f.minBackoff
+	for {
+		data, pos, err := f.queue.Peek()
+		if errors.Is(err, queue.ErrEmpty) {
+			select {
+			case <-f.queue.Ready():
+				continue
+			case <-f.stop:
+				return
+			}
+		}
+		if errors.Is(err, queue.ErrClosed) {
+			return
+		}
+
+		if err == nil {
+			var event models.GOSTEvent
+			if err = json.Unmarshal(data, &event); err == nil {
+				err = f.target.Forward(&event)
+				if err == nil {
+					// Запись, вытесненную из очереди во время отправки, Ack
+					// пропускает, не затрагивая следующую
+					if err := f.queue.Ack(pos); err != nil {
+						log.Printf("siem: ошибка подтверждения записи очереди: %v", err)
+					}
+					f.delivered.Add(1)
+					delay = f.minBackoff
+					continue
+				}
+			} else {
+				err = fmt.Errorf("%w: %v", queue.ErrCorrupt, err)
+			}
+		}
+
+		// Запись не восстановить - пропускаем, чтобы не блокировать очередь
+		if errors.Is(err, queue.ErrCorrupt) {
+			log.Printf("siem: пропущена поврежденная запись очереди: %v", err)
+			if err = f.queue.Discard(pos); err == nil {
+				continue
+			}
+			log.Printf("siem: ошибка удаления записи очереди: %v", err)
+		}
+
+		// Получатель или диск недоступен - повторяем то же событие после
+		// паузы, сохраняя порядок доставки
+		f.retries.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-f.stop:
+			return
+		}
+		delay *= 2
+		if delay > f.maxBackoff {
+			delay = f.maxBackoff
+		}
+	}
+}
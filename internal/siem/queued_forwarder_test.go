@@ -0,0 +1,106 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/queue"
+)
+
+type recordingForwarder struct {
+	mu     sync.Mutex
+	fail   bool
+	events []string
+}
+
+func (r *recordingForwarder) Forward(event *models.GOSTEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return errors.New("SIEM недоступен")
+	}
+	r.events = append(r.events, event.Description)
+	return nil
+}
+
+func (r *recordingForwarder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestQueuedForwarder_ReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// SIEM недоступен: события остаются в очереди
+	q, err := queue.Open(dir, queue.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	down := &recordingForwarder{fail: true}
+	f := NewQueuedForwarder(down, q)
+	for i := 0; i < 5; i++ {
+		if err := f.Forward(&models.GOSTEvent{Description: fmt.Sprintf("event-%d", i)}); err != nil {
+			t.Fatalf("Forward failed: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// После перезапуска события доставляются по порядку
+	q, err = queue.Open(dir, queue.Options{})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	up := &recordingForwarder{}
+	f = NewQueuedForwarder(up, q)
+	defer f.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for f.Stats().Delivered < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got := up.received()
+	if len(got) != 5 {
+		t.Fatalf("Expected 5 replayed events, got %d", len(got))
+	}
+	for i, description := range got {
+		if description != fmt.Sprintf("event-%d", i) {
+			t.Errorf("Event %d out of order: %s", i, description)
+		}
+	}
+	if stats := f.Stats(); stats.Records != 0 || stats.Delivered != 5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestQueuedForwarder_SkipsCorrupt(t *testing.T) {
+	q, err := queue.Open(t.TempDir(), queue.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	q.Push([]byte("not json"))
+
+	up := &recordingForwarder{}
+	f := NewQueuedForwarder(up, q)
+	defer f.Close()
+	f.Forward(&models.GOSTEvent{Description: "event-0"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for f.Stats().Delivered < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := up.received(); len(got) != 1 || got[0] != "event-0" {
+		t.Fatalf("Expected event after corrupt record, got %v", got)
+	}
+	if stats := f.Stats(); stats.Corrupt != 1 || stats.Records != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,270 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+// Значения по умолчанию для Route
+const (
+	DefaultRouteBuffer  = 1000
+	DefaultRouteRetries = 3
+)
+
+// Route описывает получателя Router
+type Route struct {
+	Name      string
+	Forwarder Forwarder
+	// Filter - выражение отбора событий (см. Filter); пустое - все события
+	Filter string
+	// OmitRaw удаляет из событий исходную строку (Origin.Raw)
+	OmitRaw bool
+	// BufferSize - размер буфера событий получателя; при переполнении
+	// новые события для этого получателя отбрасываются. Получатель с
+	// очередью на диске (QueuedForwarder) буфера не использует
+	BufferSize int
+	// MaxRetries - число попыток отправки одного события
+	MaxRetries int
+	// MinBackoff и MaxBackoff ограничивают паузу между попытками
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// RouteStats - счетчики получателя Router. Для получателя с очередью на
+// диске Sent - число событий, поставленных в очередь
+type RouteStats struct {
+	Name    string
+	Matched int64
+	Sent    int64
+	Failed  int64
+	Dropped int64
+	Retries int64
+	Pending int
+}
+
+// destination - получатель с собственным буфером, горутиной и повторами.
+// Получатель durable сам хранит события на диске и повторяет отправку,
+// поэтому ему события передаются синхронно, без буфера в памяти.
+type destination struct {
+	route   Route
+	filter  *Filter
+	events  chan *models.GOSTEvent
+	durable bool
+
+	matched atomic.Int64
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+	retries atomic.Int64
+}
+
+// Router рассылает каждое событие всем получателям, чей фильтр его
+// пропускает. Каждый получатель обрабатывает свой буфер в отдельной
+// горутине, поэтому медленный или недоступный получатель не задерживает
+// остальных. События для QueuedForwarder записываются в его очередь прямо
+// в Forward, чтобы они не терялись в буфере до попадания на диск.
+type Router struct {
+	destinations []*destination
+
+	mu      sync.RWMutex
+	closing atomic.Bool
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewRouter создает маршрутизатор и запускает получателей
+func NewRouter(routes ...Route) (*Router, error) {
+	r := &Router{}
+	names := make(map[string]bool)
+
+	for i, route := range routes {
+		if route.Forwarder == nil {
+			return nil, fmt.Errorf("получатель %d: не задан форвардер", i)
+		}
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route-%d", i+1)
+		}
+		if names[route.Name] {
+			return nil, fmt.Errorf("получатель %s уже зарегистрирован", route.Name)
+		}
+		names[route.Name] = true
+
+		filter, err := ParseFilter(route.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("получатель %s: %w", route.Name, err)
+		}
+		if route.BufferSize <= 0 {
+			route.BufferSize = DefaultRouteBuffer
+		}
+		if route.MaxRetries <= 0 {
+			route.MaxRetries = DefaultRouteRetries
+		}
+		if route.MinBackoff <= 0 {
+			route.MinBackoff = DefaultMinBackoff
+		}
+		if route.MaxBackoff < route.MinBackoff {
+			route.MaxBackoff = DefaultMaxBackoff
+		}
+
+		d := &destination{
+			route:  route,
+			filter: filter,
+		}
+		if _, ok := route.Forwarder.(*QueuedForwarder); ok {
+			d.durable = true
+		} else {
+			d.events = make(chan *models.GOSTEvent, route.BufferSize)
+		}
+		r.destinations = append(r.destinations, d)
+	}
+
+	for _, d := range r.destinations {
+		if d.durable {
+			continue
+		}
+		r.wg.Add(1)
+		go r.run(d)
+	}
+
+	return r, nil
+}
+
+// Forward передает событие подходящим получателям не дожидаясь отправки.
+// Ошибка возвращается, если буфер какого-либо получателя переполнен или
+// событие не удалось поставить в очередь получателя на диске.
+func (r *Router) Forward(event *models.GOSTEvent) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return fmt.Errorf("маршрутизатор закрыт")
+	}
+
+	var errs []error
+	for _, d := range r.destinations {
+		if !d.filter.Match(event) {
+			continue
+		}
+		d.matched.Add(1)
+
+		routed := event
+		if d.route.OmitRaw {
+			routed = event.WithoutRaw()
+		}
+		if d.durable {
+			if err := d.route.Forwarder.Forward(routed); err != nil {
+				d.failed.Add(1)
+				errs = append(errs, fmt.Errorf("получатель %s: %w", d.route.Name, err))
+				continue
+			}
+			d.sent.Add(1)
+			continue
+		}
+		select {
+		case d.events <- routed:
+		default:
+			d.dropped.Add(1)
+			errs = append(errs, fmt.Errorf("получатель %s: буфер переполнен", d.route.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ForwardBatch передает несколько событий
+func (r *Router) ForwardBatch(events []*models.GOSTEvent) error {
+	var errs []error
+	for i, event := range events {
+		if err := r.Forward(event); err != nil {
+			errs = append(errs, fmt.Errorf("событие %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats возвращает счетчики всех получателей
+func (r *Router) Stats() []RouteStats {
+	stats := make([]RouteStats, 0, len(r.destinations))
+	for _, d := range r.destinations {
+		stats = append(stats, RouteStats{
+			Name:    d.route.Name,
+			Matched: d.matched.Load(),
+			Sent:    d.sent.Load(),
+			Failed:  d.failed.Load(),
+			Dropped: d.dropped.Load(),
+			Retries: d.retries.Load(),
+			Pending: len(d.events),
+		})
+	}
+	return stats
+}
+
+// Close прекращает прием событий, отправляет уже буферизованные (без
+// повторных попыток) и закрывает форвардеры получателей
+func (r *Router) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.closing.Store(true)
+	for _, d := range r.destinations {
+		if !d.durable {
+			close(d.events)
+		}
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	var errs []error
+	for _, d := range r.destinations {
+		if err := d.route.Forwarder.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("получатель %s: %w", d.route.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run отправляет события получателя по порядку
+func (r *Router) run(d *destination) {
+	defer r.wg.Done()
+
+	for event := range d.events {
+		if err := r.deliver(d, event); err != nil {
+			d.failed.Add(1)
+			log.Printf("siem: получатель %s: событие не отправлено: %v", d.route.Name, err)
+			continue
+		}
+		d.sent.Add(1)
+	}
+}
+
+// deliver отправляет событие с повторами и экспоненциальной паузой
+func (r *Router) deliver(d *destination, event *models.GOSTEvent) error {
+	delay := d.route.MinBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = d.route.Forwarder.Forward(event); err == nil {
+			return nil
+		}
+		if attempt >= d.route.MaxRetries || r.closing.Load() {
+			return err
+		}
+
+		d.retries.Add(1)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > d.route.MaxBackoff {
+			delay = d.route.MaxBackoff
+		}
+	}
+}
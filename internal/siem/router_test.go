@@ -0,0 +1,233 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+	"github.com/kxrty/loggerv2/internal/queue"
+)
+
+func TestFilter(t *testing.T) {
+	event := &models.GOSTEvent{
+		Severity: models.SeverityHigh,
+		Category: models.CategoryAuthentication,
+		Result:   models.ResultFailure,
+		Source:   models.Source{Hostname: "dc01.corp.local"},
+		AdditionalData: map[string]interface{}{
+			"event_id": 4625,
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"severity >= ВЫСОКИЙ", true},
+		{"Severity > ВЫСОКИЙ", false},
+		{"severity < СРЕДНИЙ", false},
+		{"category == АУТЕНТИФИКАЦИЯ && result == НЕУСПЕХ", true},
+		{"category == ДОСТУП || source.hostname ~= \"^dc[0-9]+\\.\"", true},
+		{"!(result == УСПЕХ)", true},
+		{"event_id >= 4624 && event_id <= 4634", true},
+		{"event_id == 4624", false},
+		{"missing_field != x", true},
+		{"missing_field == x", false},
+	}
+
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := filter.Match(event); got != tt.want {
+			t.Errorf("Filter %q: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"severity >=", "severity ?? x", "(severity == x", "a == b c", "host ~= \"[\""} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+type stubForwarder struct {
+	mu     sync.Mutex
+	fails  int
+	block  chan struct{}
+	events []*models.GOSTEvent
+	closed bool
+}
+
+func (s *stubForwarder) Forward(event *models.GOSTEvent) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("временная ошибка")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *stubForwarder) ForwardBatch(events []*models.GOSTEvent) error {
+	for _, event := range events {
+		if err := s.Forward(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stubForwarder) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *stubForwarder) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func TestRouter_FiltersRetriesAndIsolation(t *testing.T) {
+	archive := &stubForwarder{fails: 2}
+	oncall := &stubForwarder{}
+	slow := &stubForwarder{block: make(chan struct{})}
+
+	router, err := NewRouter(
+		Route{Name: "archive", Forwarder: archive, MinBackoff: time.Millisecond},
+		Route{Name: "oncall", Forwarder: oncall, Filter: "severity >= ВЫСОКИЙ"},
+		Route{Name: "slow", Forwarder: slow, BufferSize: 1},
+	)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+
+	events := []*models.GOSTEvent{
+		{Severity: models.SeverityInfo},
+		{Severity: models.SeverityCritical},
+		{Severity: models.SeverityLow},
+	}
+	err = router.ForwardBatch(events)
+	if err == nil {
+		t.Error("Expected buffer overflow error for the slow destination")
+	}
+
+	// Заблокированный получатель не мешает остальным
+	deadline := time.Now().Add(2 * time.Second)
+	for (archive.count() < 3 || oncall.count() < 1) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if archive.count() != 3 {
+		t.Errorf("Expected 3 events in archive, got %d", archive.count())
+	}
+	if oncall.count() != 1 || oncall.events[0].Severity != models.SeverityCritical {
+		t.Errorf("Expected only the critical event for oncall, got %d", oncall.count())
+	}
+
+	close(slow.block)
+	if err := router.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+
+	stats := map[string]RouteStats{}
+	for _, s := range router.Stats() {
+		stats[s.Name] = s
+	}
+	if s := stats["archive"]; s.Sent != 3 || s.Retries != 2 || s.Failed != 0 {
+		t.Errorf("Unexpected archive stats: %+v", s)
+	}
+	if s := stats["slow"]; s.Dropped == 0 || s.Sent+s.Dropped != 3 {
+		t.Errorf("Unexpected slow stats: %+v", s)
+	}
+	if !archive.closed || !oncall.closed || !slow.closed {
+		t.Error("Expected all forwarders to be closed")
+	}
+	if err := router.Forward(events[0]); err == nil {
+		t.Error("Expected error after Close")
+	}
+}
+
+func TestRouter_OmitRaw(t *testing.T) {
+	full := &stubForwarder{}
+	compact := &stubForwarder{}
+
+	router, err := NewRouter(
+		Route{Name: "full", Forwarder: full},
+		Route{Name: "compact", Forwarder: compact, OmitRaw: true},
+	)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+
+	event := &models.GOSTEvent{Origin: &models.Origin{Raw: "<13>raw line", Format: "syslog"}}
+	if err := router.Forward(event); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	if err := router.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if full.count() != 1 || full.events[0].Origin.Raw != "<13>raw line" {
+		t.Errorf("Expected raw line for full route, got %+v", full.events)
+	}
+	if compact.count() != 1 || compact.events[0].Origin.Raw != "" || compact.events[0].Origin.Format != "syslog" {
+		t.Errorf("Expected raw line to be omitted, got %+v", compact.events)
+	}
+	if event.Origin.Raw == "" {
+		t.Error("Original event must not be modified")
+	}
+}
+
+func TestRouter_QueuedRouteDoesNotDrop(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := queue.Open(dir, queue.Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	// SIEM недоступен, а буфер получателя меньше числа событий
+	router, err := NewRouter(Route{
+		Name:       "queued",
+		Forwarder:  NewQueuedForwarder(&recordingForwarder{fail: true}, q),
+		BufferSize: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := router.Forward(&models.GOSTEvent{Description: fmt.Sprintf("event-%d", i)}); err != nil {
+			t.Fatalf("Forward %d failed: %v", i, err)
+		}
+	}
+	stats := router.Stats()[0]
+	if stats.Dropped != 0 || stats.Failed != 0 || stats.Sent != 20 {
+		t.Errorf("Unexpected route stats: %+v", stats)
+	}
+	if err := router.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Все события сохранены в очереди на диске
+	q, err = queue.Open(dir, queue.Options{})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer q.Close()
+	if records := q.Stats().Records; records != 20 {
+		t.Errorf("Expected 20 queued events, got %d", records)
+	}
+}
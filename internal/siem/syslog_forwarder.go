@@ -1,64 +1,277 @@
 package siem
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kxrty/loggerv2/internal/models"
 )
 
-// SyslogForwarder отправляет нормализованные события в SIEM через Syslog
+// Способы кадрирования сообщений для TCP и TLS
+const (
+	// FramingNonTransparent - сообщение завершается LF (RFC 6587 раздел 3.4.2)
+	FramingNonTransparent = "non-transparent"
+	// FramingOctetCounting - сообщение предваряется длиной (RFC 5425, RFC 6587 раздел 3.4.1)
+	FramingOctetCounting = "octet-counting"
+)
+
+// Значения по умолчанию для SyslogConfig
+const (
+	DefaultFacility     = 16 // local0
+	DefaultAppName      = "loggerv2"
+	DefaultDialTimeout  = 5 * time.Second
+	DefaultWriteTimeout = 5 * time.Second
+	DefaultMinBackoff   = 500 * time.Millisecond
+	DefaultMaxBackoff   = 30 * time.Second
+	DefaultMaxRetries   = 3
+)
+
+// SyslogConfig описывает подключение SyslogForwarder к SIEM
+type SyslogConfig struct {
+	Host string
+	Port int
+	// Protocol - "udp", "tcp" или "tls"
+	Protocol string
+	// TLSConfig используется для протокола "tls"; клиентский сертификат
+	// задается через TLSConfig.Certificates (см. NewTLSConfig)
+	TLSConfig *tls.Config
+	// Framing - FramingNonTransparent или FramingOctetCounting. Для TLS по
+	// умолчанию используется octet-counting, для TCP - non-transparent.
+	// UDP отправляет одно сообщение в датаграмме без кадрирования.
+	Framing string
+	// Facility - syslog facility (1-23); 0 означает DefaultFacility
+	// (local0): kern (0) зарезервирована за ядром и не используется
+	Facility int
+	// AppName - APP-NAME для событий без Source.Application
+	AppName string
+
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MinBackoff и MaxBackoff ограничивают паузу между попытками переподключения
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRetries - число попыток записи одного сообщения (с переподключением
+	// после разрыва)
+	MaxRetries int
+}
+
+// SyslogForwarder отправляет нормализованные события в SIEM через Syslog.
+// Соединение устанавливается при первой отправке. При обрыве соединения
+// форвардер переподключается; после неудачного
+// подключения следующие попытки откладываются с экспоненциальной паузой,
+// а Forward до ее истечения сразу возвращает ошибку.
 type SyslogForwarder struct {
+	cfg SyslogConfig
+
+	mu       sync.Mutex
 	conn     net.Conn
-	host     string
-	port     int
-	protocol string
+	failures int
+	retryAt  time.Time
+	closed   bool
 }
 
-// NewSyslogForwarder создает новый форвардер
+// NewSyslogForwarder создает новый форвардер с параметрами по умолчанию
 func NewSyslogForwarder(host string, port int, protocol string) (*SyslogForwarder, error) {
-	address := fmt.Sprintf("%s:%d", host, port)
-	conn, err := net.Dial(protocol, address)
-	if err != nil {
-		return nil, fmt.Errorf("не удалось подключиться к SIEM: %w", err)
+	return NewSyslogForwarderWithConfig(SyslogConfig{
+		Host:     host,
+		Port:     port,
+		Protocol: protocol,
+	})
+}
+
+// NewSyslogForwarderWithConfig проверяет конфигурацию и создает форвардер.
+// Подключение к SIEM откладывается до первого Forward, поэтому недоступный
+// при запуске SIEM не является ошибкой.
+func NewSyslogForwarderWithConfig(cfg SyslogConfig) (*SyslogForwarder, error) {
+	cfg.Protocol = strings.ToLower(cfg.Protocol)
+	switch cfg.Protocol {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("неподдерживаемый протокол: %s", cfg.Protocol)
+	}
+
+	if cfg.Framing == "" {
+		cfg.Framing = FramingNonTransparent
+		if cfg.Protocol == "tls" {
+			cfg.Framing = FramingOctetCounting
+		}
+	}
+	if cfg.Framing != FramingNonTransparent && cfg.Framing != FramingOctetCounting {
+		return nil, fmt.Errorf("неподдерживаемое кадрирование: %s", cfg.Framing)
+	}
+	if cfg.Facility < 0 || cfg.Facility > 23 {
+		return nil, fmt.Errorf("facility должна быть в диапазоне 1-23: %d", cfg.Facility)
+	}
+	if cfg.Facility == 0 {
+		cfg.Facility = DefaultFacility
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = DefaultAppName
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+
+	return &SyslogForwarder{cfg: cfg}, nil
+}
+
+// NewTLSConfig создает конфигурацию TLS клиента: caFile - корневые
+// сертификаты SIEM, certFile и keyFile - клиентский сертификат (RFC 5425).
+// Пустые пути пропускаются.
+func NewTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в файле %s нет сертификатов", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки клиентского сертификата: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
 	}
 
-	return &SyslogForwarder{
-		conn:     conn,
-		host:     host,
-		port:     port,
-		protocol: protocol,
-	}, nil
+	return config, nil
 }
 
-// Forward отправляет событие в SIEM
+// Forward отправляет событие в SIEM, переподключаясь при необходимости
 func (f *SyslogForwarder) Forward(event *models.GOSTEvent) error {
 	message, err := f.formatMessage(event)
 	if err != nil {
 		return fmt.Errorf("ошибка форматирования сообщения: %w", err)
 	}
+	frame := f.frame(message)
 
-	_, err = f.conn.Write([]byte(message + "\n"))
-	if err != nil {
-		return fmt.Errorf("ошибка отправки в SIEM: %w", err)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("форвардер закрыт")
 	}
 
-	return nil
+	var lastErr error
+	for attempt := 0; attempt < f.cfg.MaxRetries; attempt++ {
+		if f.conn == nil {
+			if wait := time.Until(f.retryAt); wait > 0 {
+				if lastErr == nil {
+					lastErr = fmt.Errorf("SIEM недоступен, повторное подключение через %s", wait.Round(time.Millisecond))
+				}
+				break
+			}
+
+			conn, err := f.dial()
+			if err != nil {
+				f.failures++
+				f.retryAt = time.Now().Add(f.backoff())
+				lastErr = err
+				break
+			}
+			f.conn = conn
+		}
+
+		f.conn.SetWriteDeadline(time.Now().Add(f.cfg.WriteTimeout))
+		if _, err := f.conn.Write(frame); err != nil {
+			// Соединение разорвано - следующая попытка переподключится сразу
+			f.conn.Close()
+			f.conn = nil
+			lastErr = err
+			continue
+		}
+
+		f.failures = 0
+		return nil
+	}
+
+	return fmt.Errorf("ошибка отправки в SIEM: %w", lastErr)
 }
 
-// ForwardBatch отправляет несколько событий
-func (f *SyslogForwarder) ForwardBatch(events []*models.GOSTEvent) []error {
-	var errors []error
+// ForwardBatch отправляет несколько событий, объединяя ошибки по событиям
+func (f *SyslogForwarder) ForwardBatch(events []*models.GOSTEvent) error {
+	var errs []error
 
 	for i, event := range events {
 		if err := f.Forward(event); err != nil {
-			errors = append(errors, fmt.Errorf("событие %d: %w", i, err))
+			errs = append(errs, fmt.Errorf("событие %d: %w", i, err))
 		}
 	}
 
-	return errors
+	return errors.Join(errs...)
+}
+
+// dial устанавливает соединение согласно конфигурации
+func (f *SyslogForwarder) dial() (net.Conn, error) {
+	address := net.JoinHostPort(f.cfg.Host, strconv.Itoa(f.cfg.Port))
+	dialer := &net.Dialer{Timeout: f.cfg.DialTimeout}
+
+	if f.cfg.Protocol != "tls" {
+		return dialer.Dial(f.cfg.Protocol, address)
+	}
+
+	config := f.cfg.TLSConfig
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = f.cfg.Host
+	}
+	return tls.DialWithDialer(dialer, "tcp", address, config)
+}
+
+// backoff возвращает паузу перед следующим подключением с учетом числа
+// последовательных неудач
+func (f *SyslogForwarder) backoff() time.Duration {
+	delay := f.cfg.MinBackoff
+	for i := 1; i < f.failures && delay < f.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > f.cfg.MaxBackoff {
+		delay = f.cfg.MaxBackoff
+	}
+	return delay
+}
+
+// frame применяет кадрирование к сообщению
+func (f *SyslogForwarder) frame(message string) []byte {
+	switch {
+	case f.cfg.Protocol == "udp":
+		return []byte(message)
+	case f.cfg.Framing == FramingOctetCounting:
+		return []byte(strconv.Itoa(len(message)) + " " + message)
+	default:
+		return []byte(message + "\n")
+	}
 }
 
 // formatMessage форматирует событие ГОСТ в Syslog формат для SIEM
@@ -72,14 +285,8 @@ func (f *SyslogForwarder) formatMessage(event *models.GOSTEvent) (string, error)
 	// RFC 5424 формат: <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
 	priority := f.calculatePriority(event.Severity)
 	timestamp := event.Timestamp.Format(time.RFC3339)
-	hostname := event.Source.Hostname
-	if hostname == "" {
-		hostname = "unknown"
-	}
-	appName := event.Source.Application
-	if appName == "" {
-		appName = "loggerv2"
-	}
+	hostname := headerField(event.Source.Hostname, "unknown", 255)
+	appName := headerField(event.Source.Application, f.cfg.AppName, 48)
 
 	// Формируем сообщение
 	message := fmt.Sprintf("<%d>1 %s %s %s - - - GOST: %s",
@@ -92,9 +299,26 @@ func (f *SyslogForwarder) formatMessage(event *models.GOSTEvent) (string, error)
 	return message, nil
 }
 
+// headerField приводит значение к полю заголовка RFC 5424: без пробелов и
+// управляющих символов, не длиннее maxLen
+func headerField(value, fallback string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if value == "" {
+		value = fallback
+	}
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	return value
+}
+
 // calculatePriority вычисляет Syslog priority на основе ГОСТ критичности
 func (f *SyslogForwarder) calculatePriority(severity string) int {
-	facility := 16 // local0
 	var level int
 
 	switch severity {
@@ -112,13 +336,19 @@ func (f *SyslogForwarder) calculatePriority(severity string) int {
 		level = 6
 	}
 
-	return facility*8 + level
+	return f.cfg.Facility*8 + level
 }
 
 // Close закрывает соединение с SIEM
 func (f *SyslogForwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
 	if f.conn != nil {
-		return f.conn.Close()
+		err := f.conn.Close()
+		f.conn = nil
+		return err
 	}
 	return nil
 }
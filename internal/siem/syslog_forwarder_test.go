@@ -0,0 +1,168 @@
+package siem
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kxrty/loggerv2/internal/models"
+)
+
+func listenTCP(t *testing.T, addr string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	return ln
+}
+
+func testForwarderConfig(ln net.Listener) SyslogConfig {
+	addr := ln.Addr().(*net.TCPAddr)
+	return SyslogConfig{
+		Host:       "127.0.0.1",
+		Port:       addr.Port,
+		Protocol:   "tcp",
+		Framing:    FramingOctetCounting,
+		Facility:   4,
+		AppName:    "audit",
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	}
+}
+
+func TestSyslogForwarder_OctetCountingAndFacility(t *testing.T) {
+	ln := listenTCP(t, "127.0.0.1:0")
+	defer ln.Close()
+
+	forwarder, err := NewSyslogForwarderWithConfig(testForwarderConfig(ln))
+	if err != nil {
+		t.Fatalf("NewSyslogForwarderWithConfig failed: %v", err)
+	}
+	defer forwarder.Close()
+
+	event := &models.GOSTEvent{
+		Severity:    models.SeverityHigh,
+		Description: "line one\nline two",
+		Timestamp:   time.Date(2023, 10, 11, 22, 14, 15, 0, time.UTC),
+	}
+	if err := forwarder.Forward(event); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	prefix, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(prefix))
+	if err != nil {
+		t.Fatalf("Expected octet-counting prefix, got %q", prefix)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// facility 4 * 8 + error (3) = 35, APP-NAME из конфигурации
+	if !strings.HasPrefix(string(message), "<35>1 2023-10-11T22:14:15Z unknown audit - - - GOST: {") {
+		t.Errorf("Unexpected message: %q", message)
+	}
+	if !strings.HasSuffix(string(message), "}") {
+		t.Errorf("Expected complete JSON payload, got %q", message)
+	}
+}
+
+func TestSyslogForwarder_Reconnect(t *testing.T) {
+	ln := listenTCP(t, "127.0.0.1:0")
+	cfg := testForwarderConfig(ln)
+
+	forwarder, err := NewSyslogForwarderWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewSyslogForwarderWithConfig failed: %v", err)
+	}
+	defer forwarder.Close()
+
+	event := &models.GOSTEvent{Severity: models.SeverityInfo}
+	if err := forwarder.Forward(event); err != nil {
+		t.Fatalf("Forward failed: %v", err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+
+	// SIEM перезапускается: соединение и слушатель закрыты
+	conn.Close()
+	ln.Close()
+
+	var forwardErr error
+	for i := 0; i < 5 && forwardErr == nil; i++ {
+		forwardErr = forwarder.Forward(event)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if forwardErr == nil {
+		t.Fatal("Expected Forward to fail while SIEM is down")
+	}
+
+	ln = listenTCP(t, ln.Addr().String())
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if err := forwarder.Forward(event); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Forwarder did not reconnect")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Expected new connection")
+	}
+}
+
+func TestSyslogForwarder_LazyConnect(t *testing.T) {
+	// SIEM недоступен при запуске: форвардер создается, Forward возвращает ошибку
+	ln := listenTCP(t, "127.0.0.1:0")
+	cfg := testForwarderConfig(ln)
+	cfg.Facility = 0
+	ln.Close()
+
+	forwarder, err := NewSyslogForwarderWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("Expected forwarder without connection, got %v", err)
+	}
+	defer forwarder.Close()
+
+	if forwarder.cfg.Facility != DefaultFacility {
+		t.Errorf("Expected default facility %d, got %d", DefaultFacility, forwarder.cfg.Facility)
+	}
+	if err := forwarder.Forward(&models.GOSTEvent{Severity: models.SeverityInfo}); err == nil {
+		t.Error("Expected Forward to fail while SIEM is down")
+	}
+}